@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid member token")
+var ErrExpiredToken = fmt.Errorf("%w: expired", ErrInvalidToken)
+
+// Claims identify the member a token was issued to
+type Claims struct {
+	Code      string
+	MemberID  string
+	ExpiresAt time.Time
+}
+
+// Signer issues and verifies member tokens. A token is the session code, member ID
+// and expiry signed with HMAC-SHA256, so holding one proves the server let that
+// member in, and not so long ago that the token should have been thrown away.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration    // how long a token is good for
+	Now    func() time.Time // replaced in tests
+}
+
+func NewSigner(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{secret: secret, ttl: ttl, Now: time.Now}
+}
+
+// NewMemberID returns a random ID for a member joining a session
+func NewMemberID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Issue returns a token for a member of a session
+func (s *Signer) Issue(code string, memberID string) string {
+	exp := s.Now().Add(s.ttl).Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(code + ":" + memberID + ":" + strconv.FormatInt(exp, 10)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+}
+
+// Verify checks a token's signature and expiry and returns the member it was issued
+// to. Expired tokens fail with ErrExpiredToken.
+func (s *Signer) Verify(token string) (Claims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.sign(payload)) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	claims := Claims{Code: parts[0], MemberID: parts[1], ExpiresAt: time.Unix(exp, 0)}
+	if !s.Now().Before(claims.ExpiresAt) {
+		return Claims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (s *Signer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
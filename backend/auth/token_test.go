@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIssueVerifyRoundTrip(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+	claims, err := s.Verify(s.Issue("abc234", "m1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Code != "abc234" || claims.MemberID != "m1" {
+		t.Errorf("expected abc234/m1, got %s/%s", claims.Code, claims.MemberID)
+	}
+}
+
+func TestVerifyRejectsForgedTokens(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+	token := s.Issue("abc234", "m1")
+
+	cases := map[string]string{
+		"other secret": NewSigner([]byte("other"), time.Hour).Issue("abc234", "m1"),
+		"tampered":     NewSigner([]byte("secret"), time.Hour).Issue("abc234", "m2")[:len(token)-2] + token[len(token)-2:],
+		"no signature": token[:len(token)-44],
+		"empty":        "",
+		"garbage":      "not.a-token",
+	}
+	for name, forged := range cases {
+		if _, err := s.Verify(forged); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyRejectsExpiredTokens(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+	issued := time.Now()
+	s.Now = func() time.Time { return issued }
+	token := s.Issue("abc234", "m1")
+
+	s.Now = func() time.Time { return issued.Add(59 * time.Minute) }
+	if _, err := s.Verify(token); err != nil {
+		t.Errorf("expected the token still good, got %v", err)
+	}
+	s.Now = func() time.Time { return issued.Add(time.Hour) }
+	if _, err := s.Verify(token); !errors.Is(err, ErrExpiredToken) || !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestNewMemberIDIsUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		id := NewMemberID()
+		if seen[id] {
+			t.Fatalf("duplicate member ID %s", id)
+		}
+		seen[id] = true
+	}
+}
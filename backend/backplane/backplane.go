@@ -0,0 +1,26 @@
+// Package backplane carries messages between backend instances, so that a session's
+// members can be connected to different instances behind a load balancer and still
+// see one session.
+package backplane
+
+import "context"
+
+// Message is published by one instance to every instance, itself included
+type Message struct {
+	Origin  string `json:"origin" bson:"origin"`                     // instance that published it
+	Session string `json:"session" bson:"session"`                   // session code, empty for every session
+	Target  string `json:"target,omitempty" bson:"target,omitempty"` // member ID or "host" to deliver Frame to, empty for everyone
+	Frame   []byte `json:"frame,omitempty" bson:"frame,omitempty"`   // frame to send the session's clients
+	State   []byte `json:"state,omitempty" bson:"state,omitempty"`   // change to the session's hub state
+	Seq     uint64 `json:"-" bson:"-"`                               // set on delivery, see Backplane
+}
+
+type Backplane interface {
+	// Publish sends a message to every subscribed instance. Messages from one
+	// publisher arrive in the order they were published.
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe delivers every published message until ctx is done, when the
+	// channel is closed. Every subscriber gets the messages in the same order, with
+	// Seq numbering them in that order. Numbers increase but needn't be consecutive.
+	Subscribe(ctx context.Context) (<-chan Message, error)
+}
@@ -0,0 +1,52 @@
+package backplane
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Memory is a backplane within one process, for running several hubs side by side
+// in tests
+type Memory struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs []chan Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	msg.Seq = m.seq
+	for _, sub := range m.subs {
+		select {
+		case sub <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context) (<-chan Message, error) {
+	sub := make(chan Message, 256)
+
+	m.mu.Lock()
+	m.subs = append(m.subs, sub)
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		m.subs = slices.DeleteFunc(m.subs, func(s chan Message) bool { return s == sub })
+		m.mu.Unlock()
+		close(sub)
+	}()
+	return sub, nil
+}
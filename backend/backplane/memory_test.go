@@ -0,0 +1,40 @@
+package backplane
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryDeliversToEverySubscriber(t *testing.T) {
+	m := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	first, _ := m.Subscribe(ctx)
+	second, _ := m.Subscribe(context.Background())
+
+	for _, session := range []string{"a", "b"} {
+		if err := m.Publish(context.Background(), Message{Origin: "x", Session: session}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sub := range []<-chan Message{first, second} {
+		first, second := <-sub, <-sub
+		if first.Session != "a" {
+			t.Errorf("expected messages in order, got %s first", first.Session)
+		}
+		if first.Seq >= second.Seq {
+			t.Errorf("expected increasing numbers, got %d then %d", first.Seq, second.Seq)
+		}
+	}
+
+	cancel()
+	if _, ok := <-first; ok {
+		t.Error("expected the channel closed once its context is done")
+	}
+	if err := m.Publish(context.Background(), Message{Session: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-second; msg.Session != "c" {
+		t.Errorf("expected remaining subscriber to keep receiving, got %+v", msg)
+	}
+}
@@ -0,0 +1,97 @@
+package backplane
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// How long published messages are kept, long enough for every instance to read them
+const MONGO_MESSAGE_TTL_SECONDS = 60
+
+// Mongo publishes messages by inserting them into a collection that every instance
+// watches with a change stream. Change streams need MongoDB running as a replica set.
+type Mongo struct {
+	coll *mongo.Collection
+}
+
+type mongoMessage struct {
+	Message   `bson:",inline"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+func NewMongo(ctx context.Context, coll *mongo.Collection) (*Mongo, error) {
+	// Messages are only needed while they are being delivered
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"createdAt", 1}},
+		Options: options.Index().SetExpireAfterSeconds(MONGO_MESSAGE_TTL_SECONDS),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Mongo{coll: coll}, nil
+}
+
+func (m *Mongo) Publish(ctx context.Context, msg Message) error {
+	_, err := m.coll.InsertOne(ctx, mongoMessage{Message: msg, CreatedAt: time.Now()})
+	return err
+}
+
+func (m *Mongo) Subscribe(ctx context.Context) (<-chan Message, error) {
+	pipeline := mongo.Pipeline{{{"$match", bson.D{{"operationType", "insert"}}}}}
+	stream, err := m.coll.Watch(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Message, 256)
+	go func() {
+		defer close(out)
+		for {
+			for stream.Next(ctx) {
+				var change struct {
+					ClusterTime  bson.Timestamp `bson:"clusterTime"`
+					FullDocument mongoMessage   `bson:"fullDocument"`
+				}
+				if err := stream.Decode(&change); err != nil {
+					log.Printf("backplane: failed to decode message: %v", err)
+					continue
+				}
+				// The oplog orders writes the same way for every watcher. The number is
+				// kept under 2^53 so browsers can hold it, which allows for a million
+				// writes a second.
+				msg := change.FullDocument.Message
+				msg.Seq = uint64(change.ClusterTime.T)<<20 | uint64(change.ClusterTime.I)
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+				}
+			}
+
+			resumeToken := stream.ResumeToken()
+			streamErr := stream.Err()
+			stream.Close(context.Background())
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Pick up after the last message seen, so none are lost to a dropped connection
+			log.Printf("backplane: change stream ended, resuming: %v", streamErr)
+			for {
+				time.Sleep(time.Second)
+				opts := options.ChangeStream().SetResumeAfter(resumeToken)
+				if stream, err = m.coll.Watch(ctx, pipeline, opts); err == nil {
+					break
+				} else if ctx.Err() != nil {
+					return
+				}
+				log.Printf("backplane: failed to resume change stream: %v", err)
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"consensus/models"
+	"consensus/phase"
+	"consensus/projection"
+	"consensus/tally"
+	"consensus/websocket"
+)
+
+// rankingStore is the session storage tallying a round works from
+type rankingStore interface {
+	FindSessionByCode(ctx context.Context, code string) (*models.Session, error)
+	StartRunoff(ctx context.Context, code string, from string, completed models.VotingRound, finalists []models.Choice) error
+	SetPendingTie(ctx context.Context, code string, pending []string) error
+	SaveRankedChoices(ctx context.Context, code string, from string, round int, choices []models.Choice, tallyResult *tally.Result) error
+	SetPermalink(ctx context.Context, code string, permalink string) error
+	CloseSession(ctx context.Context, code string) error
+}
+
+// finalizer tallies voting rounds, starting runoffs or closing sessions on the result
+type finalizer struct {
+	sessions rankingStore
+	hub      *websocket.Hub
+}
+
+// startRunoff archives the round just tallied and opens another on the finalists
+func (f *finalizer) startRunoff(ctx context.Context, session *models.Session, candidates []string, result *tally.Result, finalists []string) {
+	keep := make(map[string]bool, len(finalists))
+	for _, id := range finalists {
+		keep[id] = true
+	}
+	choices := make([]models.Choice, 0, len(finalists))
+	for _, c := range session.FinalizedChoices {
+		if keep[c.ID] {
+			choices = append(choices, c)
+		}
+	}
+
+	completed := models.VotingRound{Number: session.Round, Choices: candidates, Tally: result}
+	if err := f.sessions.StartRunoff(ctx, session.Code, session.Phase, completed, choices); err != nil {
+		log.Printf("runoff: failed to start for session %s: %v", session.Code, err)
+		return
+	}
+	f.hub.SetPhase(session.Code, phase.Runoff)
+
+	f.hub.StartRunoff(session.Code)
+	f.hub.BroadcastToSession(session.Code, websocket.PhaseChangedMsg{
+		Type:    websocket.TypePhaseChanged,
+		Phase:   phase.Runoff,
+		Ready:   f.hub.GetReadyState(session.Code),
+		Choices: projection.Choices(session.Config, choices, ""),
+		Round:   completed.Number + 1,
+	})
+}
+
+// finalize tallies the votes and closes the session, unless a tie for first place
+// is waiting on the host. Only the first finalization of a round is saved: a second
+// one, racing it from the hub or the scheduler, fails to save and stops there.
+func (f *finalizer) finalize(sessionCode string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := f.sessions.FindSessionByCode(ctx, sessionCode)
+	if err != nil {
+		log.Printf("ranking: failed to fetch session %s: %v", sessionCode, err)
+		return
+	}
+
+	method, err := tally.ForMode(session.Config.VotingMode)
+	if err != nil {
+		log.Printf("ranking: session %s: %v", sessionCode, err)
+		return
+	}
+
+	candidates, ballots := session.Ballots()
+	result := method.Tally(candidates, ballots)
+	opts := tieBreakOptions(session)
+	pending := tally.BreakTies(&result, opts)
+
+	if finalists := runoffFinalists(session, &result, pending); len(finalists) > 0 {
+		f.startRunoff(ctx, session, candidates, &result, finalists)
+		return
+	}
+
+	if len(pending) > 0 && session.Config.TieBreak == tally.TieBreakRunoff {
+		// Out of runoff rounds: settle the tie at random
+		opts.Policy = tally.TieBreakRandom
+		pending = tally.BreakTies(&result, opts)
+	}
+	if len(pending) > 0 {
+		log.Printf("ranking: session %s has a tie waiting on the host: %v", sessionCode, pending)
+		if err := f.sessions.SetPendingTie(ctx, sessionCode, pending); err != nil {
+			log.Printf("ranking: failed to save pending tie for session %s: %v", sessionCode, err)
+		}
+		f.hub.SendToHost(sessionCode, websocket.TieDetectedMsg{
+			Type:    websocket.TypeTieDetected,
+			Policy:  session.Config.TieBreak,
+			Choices: pending,
+		})
+		return
+	}
+
+	// Choices knocked out by a runoff follow the finalists in their earlier order
+	for i := len(session.Rounds) - 1; i >= 0; i-- {
+		tally.ExtendRanking(&result, session.Rounds[i].Tally.Ranking)
+	}
+
+	byID := make(map[string]models.Choice, len(session.Choices))
+	for _, c := range session.Choices {
+		c.Votes = nil
+		byID[c.ID] = c
+	}
+	choices := make([]models.Choice, 0, len(result.Ranking))
+	for _, standing := range result.Ranking {
+		choice := byID[standing.Candidate]
+		choice.Rank = standing.Place
+		choice.Score = standing.Score
+		choices = append(choices, choice)
+	}
+
+	if err := f.sessions.SaveRankedChoices(ctx, sessionCode, session.Phase, session.Round, choices, &result); err != nil {
+		log.Printf("ranking: failed to save for session %s: %v", sessionCode, err)
+		return
+	}
+	f.hub.SetPhase(sessionCode, phase.Final)
+
+	// Generate permalink
+	permalinkID := generatePermalinkID()
+	if err := f.sessions.SetPermalink(ctx, sessionCode, permalinkID); err != nil {
+		log.Printf("permalink: failed to set for session %s: %v", sessionCode, err)
+	}
+
+	// Close the session
+	if err := f.sessions.CloseSession(ctx, sessionCode); err != nil {
+		log.Printf("close: failed for session %s: %v", sessionCode, err)
+	}
+
+	// Mark session closed so host transfer is skipped on disconnect
+	f.hub.MarkSessionClosed(sessionCode)
+
+	// Broadcast final phase with permalink, then disconnect all clients
+	f.hub.BroadcastToSession(sessionCode, websocket.PhaseChangedMsg{
+		Type:      websocket.TypePhaseChanged,
+		Phase:     phase.Final,
+		Ready:     f.hub.GetReadyState(sessionCode),
+		Choices:   projection.Choices(session.Config, choices, ""),
+		Permalink: permalinkID,
+	})
+
+}
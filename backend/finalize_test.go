@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"consensus/models"
+	"consensus/phase"
+	"consensus/tally"
+	"consensus/websocket"
+)
+
+// memoryRankings keeps one session in memory, saving a tally only while the session
+// is still in the round it was read in, as the repository's filter does
+type memoryRankings struct {
+	mu         sync.Mutex
+	session    models.Session
+	reads      sync.WaitGroup // held until every finalization has read the session
+	tallies    int
+	permalinks []string
+}
+
+func (m *memoryRankings) FindSessionByCode(ctx context.Context, code string) (*models.Session, error) {
+	m.mu.Lock()
+	session := m.session
+	m.mu.Unlock()
+	m.reads.Done()
+	m.reads.Wait()
+	return &session, nil
+}
+
+func (m *memoryRankings) StartRunoff(ctx context.Context, code string, from string, completed models.VotingRound, finalists []models.Choice) error {
+	return errors.New("unexpected runoff")
+}
+
+func (m *memoryRankings) SetPendingTie(ctx context.Context, code string, pending []string) error {
+	return errors.New("unexpected tie")
+}
+
+func (m *memoryRankings) SaveRankedChoices(ctx context.Context, code string, from string, round int, choices []models.Choice, tallyResult *tally.Result) error {
+	if err := phase.CheckTransition(from, phase.Final); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session.Phase != from || m.session.Round != round {
+		return errors.New("session has already moved on")
+	}
+	m.session.Phase = phase.Final
+	m.session.RankedChoices = choices
+	m.tallies++
+	return nil
+}
+
+func (m *memoryRankings) SetPermalink(ctx context.Context, code string, permalink string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.permalinks = append(m.permalinks, permalink)
+	return nil
+}
+
+func (m *memoryRankings) CloseSession(ctx context.Context, code string) error {
+	return nil
+}
+
+func TestFinalizeTakesOneFinalizationPerRound(t *testing.T) {
+	choices := []models.Choice{
+		{ID: "c1", Votes: []models.Vote{{MemberID: "a", Value: 1}, {MemberID: "b", Value: 1}}},
+		{ID: "c2", Votes: []models.Vote{{MemberID: "a", Value: 0}, {MemberID: "b", Value: 0}}},
+	}
+	store := &memoryRankings{session: models.Session{
+		Code:             "abc",
+		Phase:            phase.Results,
+		Config:           models.SessionConfig{VotingMode: tally.ModeYesNo},
+		Choices:          choices,
+		FinalizedChoices: choices,
+	}}
+	hub := websocket.NewHub()
+	go hub.Run()
+	f := &finalizer{sessions: store, hub: hub}
+
+	// As when the hub sees the last vote while the scheduler finds the deadline passed
+	store.reads.Add(2)
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.finalize("abc")
+		}()
+	}
+	wg.Wait()
+
+	if store.tallies != 1 {
+		t.Errorf("expected the round tallied once, got %d", store.tallies)
+	}
+	if len(store.permalinks) != 1 {
+		t.Errorf("expected one permalink, got %v", store.permalinks)
+	}
+}
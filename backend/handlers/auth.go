@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"consensus/models"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	memberKey  = "member"
+	sessionKey = "session"
+)
+
+// RequireMember authenticates the bearer token on a session route and loads the
+// member it was issued to, so handlers never trust a name sent by the client.
+func (h *SessionHandler) RequireMember(c *gin.Context) {
+	code := strings.ToLower(c.Param("code"))
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Member token required",
+		})
+		return
+	}
+
+	claims, err := h.signer.Verify(token)
+	if err != nil || claims.Code != code {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid member token",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
+	defer cancel()
+
+	session, err := h.repo.FindSessionByCode(ctx, code)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Session not found",
+		})
+		return
+	}
+
+	for i := range session.Members {
+		if session.Members[i].ID == claims.MemberID {
+			c.Set(memberKey, &session.Members[i])
+			c.Set(sessionKey, session)
+			c.Next()
+			return
+		}
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+		Error: "Member not in session",
+	})
+}
+
+// viewerID returns the member a bearer token on a public session route was issued to,
+// or "" if there is no valid token, for deciding what the caller may see
+func (h *SessionHandler) viewerID(c *gin.Context) string {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	claims, err := h.signer.Verify(token)
+	if err != nil || claims.Code != strings.ToLower(c.Param("code")) {
+		return ""
+	}
+	return claims.MemberID
+}
+
+// currentMember returns the member authenticated by RequireMember
+func currentMember(c *gin.Context) *models.Member {
+	return c.MustGet(memberKey).(*models.Member)
+}
+
+// currentConfig returns the config of the session RequireMember loaded, as of the
+// start of the request
+func currentConfig(c *gin.Context) models.SessionConfig {
+	return c.MustGet(sessionKey).(*models.Session).Config
+}
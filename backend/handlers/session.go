@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"consensus/auth"
 	"consensus/integrations"
 	"consensus/models"
+	"consensus/phase"
+	"consensus/projection"
 	"consensus/repository"
+	"consensus/tally"
 	"consensus/websocket"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,14 +23,24 @@ import (
 )
 
 type SessionHandler struct {
-	repo *repository.SessionRepository
-	hub  *websocket.Hub
+	repo     *repository.SessionRepository
+	sessions sessionFinder // repo, for lookups that can run without MongoDB in tests
+	hub      *websocket.Hub
+	signer   *auth.Signer
 }
 
-func NewSessionHandler(repo *repository.SessionRepository, hub *websocket.Hub) *SessionHandler {
+// sessionFinder looks sessions up by code or permalink
+type sessionFinder interface {
+	FindSessionByCode(ctx context.Context, code string) (*models.Session, error)
+	FindSessionByPermalink(ctx context.Context, permalink string) (*models.Session, error)
+}
+
+func NewSessionHandler(repo *repository.SessionRepository, hub *websocket.Hub, signer *auth.Signer) *SessionHandler {
 	return &SessionHandler{
-		repo: repo,
-		hub:  hub,
+		repo:     repo,
+		sessions: repo,
+		hub:      hub,
+		signer:   signer,
 	}
 }
 
@@ -61,6 +77,83 @@ func generateSessionCode(ctx context.Context, repo *repository.SessionRepository
 	return "", fmt.Errorf("Failed to generate unique session code after 5 attempts")
 }
 
+// errorStatus maps a repository error to a response status, treating writes
+// refused by the session's phase or its existing choices as conflicts
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, phase.ErrActionNotAllowed),
+		errors.Is(err, phase.ErrIllegalTransition),
+		errors.Is(err, repository.ErrAlreadyProposed),
+		errors.Is(err, repository.ErrRoundOver),
+		errors.Is(err, models.ErrTooManyChoices),
+		errors.Is(err, models.ErrSubmitted):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrEmptyVoter):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// validateBallot checks a member's votes against the choices in the current round
+// and the session's voting mode, returning an error for each offending field.
+func validateBallot(session *models.Session, votes []models.VoteValue) []models.FieldError {
+	candidates := make([]string, 0, len(session.FinalizedChoices))
+	for _, choice := range session.FinalizedChoices {
+		candidates = append(candidates, choice.ID)
+	}
+	entries := make([]tally.Entry, 0, len(votes))
+	for _, v := range votes {
+		entries = append(entries, tally.Entry{Candidate: v.ChoiceID, Value: v.Value})
+	}
+
+	var fields []models.FieldError
+	for _, e := range tally.ValidateBallot(session.Config.VotingMode, candidates, entries) {
+		field := "votes"
+		switch e.Field {
+		case tally.FieldCandidate:
+			field = fmt.Sprintf("votes[%d].choiceID", e.Entry)
+		case tally.FieldValue:
+			field = fmt.Sprintf("votes[%d].value", e.Entry)
+		}
+		fields = append(fields, models.FieldError{Field: field, Message: e.Message})
+	}
+	return fields
+}
+
+// announceChoice tells the session about a choice that was added or changed. It goes
+// to everyone, so it's shaped as it would be for someone outside the session.
+func (h *SessionHandler) announceChoice(code string, cfg models.SessionConfig, choice models.Choice, added bool) {
+	msgType := websocket.TypeChoiceUpdated
+	if added {
+		msgType = websocket.TypeChoiceAdded
+	}
+	h.hub.BroadcastToSession(code, websocket.ChoiceMsg{
+		Type:   msgType,
+		Choice: projection.Choice(cfg, choice, ""),
+	})
+}
+
+// announceDropped tells the session what became of choices a member stopped
+// proposing: still there for the other members who proposed them, or gone
+func (h *SessionHandler) announceDropped(ctx context.Context, code string, cfg models.SessionConfig, choiceIDs []string) {
+	session, err := h.repo.FindSessionByCode(ctx, code)
+	if err != nil {
+		log.Printf("choices: failed to fetch session %s to announce changes: %v", code, err)
+		return
+	}
+	for _, id := range choiceIDs {
+		i := slices.IndexFunc(session.Choices, func(c models.Choice) bool { return c.ID == id })
+		if i >= 0 {
+			h.announceChoice(code, cfg, session.Choices[i], false)
+			continue
+		}
+		h.hub.BroadcastToSession(code, websocket.ChoiceRemovedMsg{
+			Type:     websocket.TypeChoiceRemoved,
+			ChoiceID: id,
+		})
+	}
+}
+
 func (h *SessionHandler) CreateSession(c *gin.Context) {
 	var req models.CreateSessionRequest
 
@@ -97,6 +190,7 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 	}
 
 	host := models.Member{
+		ID:   auth.NewMemberID(),
 		Code: sessionCode,
 		Name: req.Name,
 		Host: true,
@@ -106,8 +200,9 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		Code:    sessionCode,
 		Members: []models.Member{host},
 		Title:   req.Title,
-		Phase:   "lobby",
+		Phase:   phase.Lobby,
 		Config:  req.Config,
+		Seed:    rand.Int63(),
 	}
 
 	err = h.repo.CreateSession(ctx, &newSession)
@@ -119,8 +214,9 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, models.CreateSessionResponse{
-		Msg:  "Session created",
-		Code: sessionCode,
+		Msg:   "Session created",
+		Code:  sessionCode,
+		Token: h.signer.Issue(sessionCode, host.ID),
 	})
 }
 
@@ -160,8 +256,8 @@ func (h *SessionHandler) JoinSession(c *gin.Context) {
 		return
 	}
 
-	if session.Phase != "" && session.Phase != "lobby" {
-		c.JSON(http.StatusForbidden, models.ErrorResponse{
+	if err := phase.Check(session.Phase, phase.Join); err != nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
 			Error: "Session is no longer accepting new members",
 		})
 		return
@@ -177,6 +273,7 @@ func (h *SessionHandler) JoinSession(c *gin.Context) {
 	}
 
 	joinee := models.Member{
+		ID:   auth.NewMemberID(),
 		Code: code,
 		Name: req.Name,
 		Host: false,
@@ -184,7 +281,7 @@ func (h *SessionHandler) JoinSession(c *gin.Context) {
 
 	err = h.repo.AddMemberToSession(ctx, code, joinee)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		c.JSON(errorStatus(err), models.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
@@ -201,24 +298,18 @@ func (h *SessionHandler) JoinSession(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.JoinSessionResponse{
 		Msg:     "Session joined",
-		Session: *session,
+		Session: projection.Session(*session, joinee.ID),
+		Token:   h.signer.Issue(code, joinee.ID),
 	})
 }
 
 func (h *SessionHandler) LeaveSession(c *gin.Context) {
-	var req models.LeaveSessionRequest
 	code := strings.ToLower(c.Param("code"))
+	leaver := currentMember(c)
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: err.Error(),
-		})
-		return
-	}
-
 	session, err := h.repo.FindSessionByCode(ctx, code)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -234,25 +325,9 @@ func (h *SessionHandler) LeaveSession(c *gin.Context) {
 		return
 	}
 
-	// Find the member to check if they exist and if they're the host
-	var memberExists bool
-	var isHost bool
-	for _, member := range session.Members {
-		if member.Name == req.Name {
-			memberExists = true
-			isHost = member.Host
-			break
-		}
-	}
+	isHost := leaver.Host
 
-	if !memberExists {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "Member not found in session",
-		})
-		return
-	}
-
-	err = h.repo.RemoveMemberFromSession(ctx, code, req.Name)
+	err = h.repo.RemoveMemberFromSession(ctx, code, leaver.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: err.Error(),
@@ -263,7 +338,7 @@ func (h *SessionHandler) LeaveSession(c *gin.Context) {
 	// Broadcast to connected WebSocket clients
 	h.hub.BroadcastToSession(code, websocket.MemberLeftMsg{
 		Type:       websocket.TypeMemberLeft,
-		MemberName: req.Name,
+		MemberName: leaver.Name,
 	})
 
 	// If host left, reassign to another member
@@ -271,13 +346,13 @@ func (h *SessionHandler) LeaveSession(c *gin.Context) {
 		// Re-fetch session to find remaining members
 		updatedSession, fetchErr := h.repo.FindSessionByCode(ctx, code)
 		if fetchErr == nil && len(updatedSession.Members) > 0 {
-			newHost := updatedSession.Members[0].Name
-			if transferErr := h.repo.TransferHost(ctx, code, newHost); transferErr != nil {
+			newHost := updatedSession.Members[0]
+			if transferErr := h.repo.TransferHost(ctx, code, newHost.ID); transferErr != nil {
 				log.Printf("host transfer on leave: failed for session %s: %v", code, transferErr)
 			} else {
 				h.hub.BroadcastToSession(code, websocket.HostChangedMsg{
 					Type:    websocket.TypeHostChanged,
-					NewHost: newHost,
+					NewHost: newHost.Name,
 				})
 			}
 		}
@@ -294,7 +369,7 @@ func (h *SessionHandler) GetSession(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
 
-	session, err := h.repo.FindSessionByCode(ctx, code)
+	session, err := h.sessions.FindSessionByCode(ctx, code)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: err.Error(),
@@ -304,7 +379,7 @@ func (h *SessionHandler) GetSession(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.GetSessionResponse{
 		Msg:     "Session retrieved",
-		Session: *session,
+		Session: projection.Session(*session, h.viewerID(c)),
 	})
 }
 
@@ -341,7 +416,7 @@ func (h *SessionHandler) GetSessions(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.GetSessionsResponse{
 		Msg:      msg,
-		Sessions: sessions,
+		Sessions: projection.Sessions(sessions),
 	})
 }
 
@@ -359,14 +434,22 @@ func (h *SessionHandler) UpdateSessionConfig(c *gin.Context) {
 		return
 	}
 
+	if !currentMember(c).Host {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: "Non host members are not authorized to update the session config",
+		})
+		return
+	}
+
 	oldConfig, err := h.repo.UpdateSessionConfig(ctx, code, &req.NewConfig)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		c.JSON(errorStatus(err), models.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
 	}
 
+	h.hub.SetConfig(code, req.NewConfig)
 	h.hub.BroadcastToSession(code, websocket.ConfigUpdatedMsg{
 		Type:   websocket.TypeConfigUpdated,
 		Config: req.NewConfig,
@@ -381,26 +464,12 @@ func (h *SessionHandler) UpdateSessionConfig(c *gin.Context) {
 
 func (h *SessionHandler) CloseSession(c *gin.Context) {
 	// TODO: check if session is active
-	var req models.CloseSessionRequest
 	code := strings.ToLower(c.Param("code"))
+	requestor := currentMember(c)
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: err.Error(),
-		})
-	}
-
-	requestor, err := h.repo.FindMember(ctx, code, req.Name)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: err.Error(),
-		})
-		return
-	}
-
 	if !requestor.Host {
 		c.JSON(http.StatusForbidden, models.ErrorResponse{
 			Error: "Non host members are not authorized to close sessions",
@@ -408,7 +477,7 @@ func (h *SessionHandler) CloseSession(c *gin.Context) {
 		return
 	}
 
-	err = h.repo.CloseSession(ctx, code)
+	err := h.repo.CloseSession(ctx, code)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: err.Error(),
@@ -430,7 +499,7 @@ func (h *SessionHandler) CloseSession(c *gin.Context) {
 func (h *SessionHandler) UpdateMember(c *gin.Context) {
 	var req models.UpdateMemberRequest
 	code := strings.ToLower(c.Param("code"))
-	name := c.Param("name")
+	member := currentMember(c)
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
@@ -464,8 +533,8 @@ func (h *SessionHandler) UpdateMember(c *gin.Context) {
 		return
 	}
 
-	for _, member := range session.Members {
-		if member.Name == req.NewName {
+	for _, m := range session.Members {
+		if m.Name == req.NewName {
 			c.JSON(http.StatusConflict, models.ErrorResponse{
 				Error: "Name already exists in this session",
 			})
@@ -473,7 +542,7 @@ func (h *SessionHandler) UpdateMember(c *gin.Context) {
 		}
 	}
 
-	err = h.repo.UpdateMember(ctx, code, name, req.NewName)
+	err = h.repo.UpdateMember(ctx, code, member.ID, req.NewName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: err.Error(),
@@ -481,11 +550,11 @@ func (h *SessionHandler) UpdateMember(c *gin.Context) {
 		return
 	}
 
-	h.hub.UpdateMemberName(code, name, req.NewName)
+	h.hub.UpdateMemberName(code, member.ID, req.NewName)
 
 	c.JSON(http.StatusOK, models.UpdateMemberResponse{
 		Msg:     "Member updated",
-		OldName: name,
+		OldName: member.Name,
 		NewName: req.NewName,
 	})
 
@@ -537,7 +606,7 @@ func (h *SessionHandler) GetMembers(c *gin.Context) {
 func (h *SessionHandler) AddMemberChoice(c *gin.Context) {
 	var req models.AddChoiceRequest
 	code := strings.ToLower(c.Param("code"))
-	name := c.Param("name")
+	member := currentMember(c)
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
@@ -557,7 +626,6 @@ func (h *SessionHandler) AddMemberChoice(c *gin.Context) {
 	}
 
 	choice := models.Choice{
-		MemberName:    name,
 		Title:         req.Title,
 		Comment:       req.Comment,
 		Integration:   req.Integration,
@@ -606,27 +674,36 @@ func (h *SessionHandler) AddMemberChoice(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.AddChoice(ctx, code, choice); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+	proposer := models.Proposer{MemberID: member.ID, MemberName: member.Name}
+	stored, err := h.repo.AddChoice(ctx, code, proposer, choice)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
 	}
 
+	merged := len(stored.Proposers) > 1
+	h.announceChoice(code, currentConfig(c), *stored, !merged)
+
+	msg := "Choice added"
+	if merged {
+		msg = "Choice merged with the same choice from another member"
+	}
 	c.JSON(http.StatusCreated, models.AddChoiceResponse{
-		Msg:    "Choice added",
-		Choice: choice,
+		Msg:    msg,
+		Choice: projection.Choice(currentConfig(c), *stored, member.ID),
 	})
 }
 
 func (h *SessionHandler) GetMemberChoices(c *gin.Context) {
 	code := strings.ToLower(c.Param("code"))
-	name := c.Param("name")
+	member := currentMember(c)
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
 
-	choices, err := h.repo.FindChoicesByMemberName(ctx, code, name)
+	choices, err := h.repo.FindChoicesByMemberID(ctx, code, member.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: err.Error(),
@@ -636,15 +713,15 @@ func (h *SessionHandler) GetMemberChoices(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.GetChoicesResponse{
 		Msg:     "Choices retrieved",
-		Choices: choices,
+		Choices: projection.Choices(currentConfig(c), choices, member.ID),
 	})
 }
 
 func (h *SessionHandler) UpdateMemberChoice(c *gin.Context) {
 	var req models.UpdateChoiceRequest
 	code := strings.ToLower(c.Param("code"))
-	name := c.Param("name")
-	title := c.Param("title")
+	member := currentMember(c)
+	choiceID := c.Param("id")
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
@@ -664,7 +741,6 @@ func (h *SessionHandler) UpdateMemberChoice(c *gin.Context) {
 	}
 
 	updatedChoice := models.Choice{
-		MemberName:    name,
 		Title:         req.Title,
 		Comment:       req.Comment,
 		Integration:   req.Integration,
@@ -672,35 +748,45 @@ func (h *SessionHandler) UpdateMemberChoice(c *gin.Context) {
 		Description:   req.Description,
 	}
 
-	err := h.repo.UpdateChoice(ctx, code, name, title, &updatedChoice)
+	stored, err := h.repo.UpdateChoice(ctx, code, member.ID, choiceID, &updatedChoice)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		c.JSON(errorStatus(err), models.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
 	}
 
+	// An edit that splits from a shared choice or matches another one moves the
+	// member's proposal to a different choice
+	if stored.ID == choiceID {
+		h.announceChoice(code, currentConfig(c), *stored, false)
+	} else {
+		h.announceDropped(ctx, code, currentConfig(c), []string{choiceID})
+		h.announceChoice(code, currentConfig(c), *stored, len(stored.Proposers) == 1)
+	}
+
 	c.JSON(http.StatusOK, models.UpdateChoiceResponse{
 		Msg:    "Choice updated",
-		Choice: updatedChoice,
+		Choice: projection.Choice(currentConfig(c), *stored, member.ID),
 	})
 }
 
 func (h *SessionHandler) RemoveMemberChoice(c *gin.Context) {
 	code := strings.ToLower(c.Param("code"))
-	name := c.Param("name")
-	title := c.Param("title")
+	member := currentMember(c)
+	choiceID := c.Param("id")
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
 
-	err := h.repo.RemoveChoice(ctx, code, name, title)
+	err := h.repo.RemoveChoice(ctx, code, member.ID, choiceID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		c.JSON(errorStatus(err), models.ErrorResponse{
 			Error: err.Error(),
 		})
 		return
 	}
+	h.announceDropped(ctx, code, currentConfig(c), []string{choiceID})
 
 	c.JSON(http.StatusOK, models.MsgResponse{
 		Msg: "Choice removed",
@@ -709,7 +795,7 @@ func (h *SessionHandler) RemoveMemberChoice(c *gin.Context) {
 
 func (h *SessionHandler) SubmitMemberVotes(c *gin.Context) {
 	code := strings.ToLower(c.Param("code"))
-	name := c.Param("name")
+	member := currentMember(c)
 	var req models.SubmitVotesRequest
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
@@ -720,25 +806,61 @@ func (h *SessionHandler) SubmitMemberVotes(c *gin.Context) {
 		return
 	}
 
+	session, err := h.repo.FindSessionByCode(ctx, code)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Session not found"})
+		return
+	}
+
+	if err := phase.Check(session.Phase, phase.SubmitVotes); err != nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !session.CanVote(member.ID) {
+		c.JSON(errorStatus(models.ErrEmptyVoter), models.ErrorResponse{Error: models.ErrEmptyVoter.Error()})
+		return
+	}
+
+	if fields := validateBallot(session, req.Votes); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, models.ValidationErrorResponse{
+			Error:  "Invalid ballot",
+			Fields: fields,
+		})
+		return
+	}
+
+	ballot := make(map[string]int, len(req.Votes))
 	for _, v := range req.Votes {
-		vote := models.Vote{MemberName: name, Value: v.Value}
-		if err := h.repo.AddVote(ctx, code, v.ChoiceTitle, vote); err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
-			return
-		}
+		ballot[v.ChoiceID] = v.Value
+	}
+	replayed, err := h.repo.SubmitBallot(ctx, code, member.ID, req.BallotID, session.Round, ballot)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "Votes submitted"})
+	// Tell the hub even on a replay, in case the first attempt stopped short of it
+	h.hub.MarkVoted(code, member.ID)
+
+	msg := "Votes submitted"
+	if replayed {
+		msg = "Ballot already submitted"
+	}
+	c.JSON(http.StatusOK, models.SubmitVotesResponse{
+		Msg:      msg,
+		BallotID: req.BallotID,
+	})
 }
 
 func (h *SessionHandler) ClearMemberChoices(c *gin.Context) {
 	code := strings.ToLower(c.Param("code"))
-	name := c.Param("name")
+	member := currentMember(c)
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
 
-	err := h.repo.RemoveAllChoicesByMemberName(ctx, code, name)
+	proposed, err := h.repo.FindChoicesByMemberID(ctx, code, member.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: err.Error(),
@@ -746,6 +868,20 @@ func (h *SessionHandler) ClearMemberChoices(c *gin.Context) {
 		return
 	}
 
+	err = h.repo.RemoveAllChoicesByMemberID(ctx, code, member.ID)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	ids := make([]string, 0, len(proposed))
+	for _, choice := range proposed {
+		ids = append(ids, choice.ID)
+	}
+	h.announceDropped(ctx, code, currentConfig(c), ids)
+
 	c.JSON(http.StatusOK, models.MsgResponse{
 		Msg: "Choices cleared",
 	})
@@ -757,7 +893,7 @@ func (h *SessionHandler) GetResultsByPermalink(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), REQUEST_TIMEOUT_SECONDS*time.Second)
 	defer cancel()
 
-	session, err := h.repo.FindSessionByPermalink(ctx, permalink)
+	session, err := h.sessions.FindSessionByPermalink(ctx, permalink)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error: "Results not found",
@@ -765,10 +901,32 @@ func (h *SessionHandler) GetResultsByPermalink(c *gin.Context) {
 		return
 	}
 
+	candidates, ballots := session.Ballots()
+	breakdowns := tally.Breakdowns(session.Config.VotingMode, candidates, ballots, !session.Config.Anonymity)
+
+	// Marks carry member IDs; the link is public, so show names instead
+	names := make(map[string]string, len(session.Members))
+	for _, m := range session.Members {
+		names[m.ID] = m.Name
+	}
+	for _, b := range breakdowns {
+		for i, mark := range b.Marks {
+			if name, ok := names[mark.Voter]; ok {
+				b.Marks[i].Voter = name
+			} else {
+				b.Marks[i].Voter = "Former member"
+			}
+		}
+		// Ordered by member ID until now, so order them by the names shown instead
+		slices.SortStableFunc(b.Marks, func(x, y tally.Mark) int { return strings.Compare(x.Voter, y.Voter) })
+	}
+
 	c.JSON(http.StatusOK, models.GetResultsResponse{
 		Msg:           "Results retrieved",
 		Title:         session.Title,
-		RankedChoices: session.RankedChoices,
+		RankedChoices: projection.Choices(session.Config, session.RankedChoices, ""),
+		Explanation:   session.Tally,
+		Breakdowns:    breakdowns,
 		VotingMode:    session.Config.VotingMode,
 		Permalink:     session.Permalink,
 		CreatedAt:     session.CreatedAt,
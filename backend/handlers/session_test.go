@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"consensus/auth"
+	"consensus/models"
+	"consensus/phase"
+	"consensus/tally"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oneSession finds a single session, whatever the code or permalink
+type oneSession models.Session
+
+func (s *oneSession) FindSessionByCode(ctx context.Context, code string) (*models.Session, error) {
+	session := models.Session(*s)
+	return &session, nil
+}
+
+func (s *oneSession) FindSessionByPermalink(ctx context.Context, permalink string) (*models.Session, error) {
+	return s.FindSessionByCode(ctx, "")
+}
+
+// getSession asks for the session as the member viewerID
+func getSession(t *testing.T, session models.Session, viewerID string) models.Session {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	signer := auth.NewSigner([]byte("secret"), time.Hour)
+	h := &SessionHandler{sessions: (*oneSession)(&session), signer: signer}
+	router := gin.New()
+	router.GET("/api/sessions/:code", h.GetSession)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions/"+session.Code, nil)
+	req.Header.Set("Authorization", "Bearer "+signer.Issue(session.Code, viewerID))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	var resp models.GetSessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Session
+}
+
+func votingSession(cfg models.SessionConfig) models.Session {
+	return models.Session{
+		Code:   "abc234",
+		Phase:  phase.Results,
+		Config: cfg,
+		Choices: []models.Choice{{
+			ID: "c1",
+			Votes: []models.Vote{
+				{MemberID: "alice", Value: 1},
+				{MemberID: "bob", Value: 0},
+			},
+		}},
+	}
+}
+
+func TestGetSessionHidesOthersVotesMidRound(t *testing.T) {
+	for name, cfg := range map[string]models.SessionConfig{
+		"named":                  {},
+		"anonymous":              {Anonymity: true},
+		"anonymous, live totals": {Anonymity: true, LiveTotals: true},
+	} {
+		got := getSession(t, votingSession(cfg), "alice")
+		votes := got.Choices[0].Votes
+		if len(votes) != 1 || votes[0].MemberID != "alice" || votes[0].Value != 1 {
+			t.Errorf("%s: expected only alice's own vote, got %+v", name, votes)
+		}
+	}
+}
+
+func TestGetSessionShowsLiveTotals(t *testing.T) {
+	got := getSession(t, votingSession(models.SessionConfig{LiveTotals: true}), "alice")
+	if votes := got.Choices[0].Votes; len(votes) != 2 {
+		t.Errorf("expected both votes with live totals, got %+v", votes)
+	}
+}
+
+func TestGetResultsOrdersMarksByName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	session := models.Session{
+		Phase:            phase.Final,
+		Config:           models.SessionConfig{VotingMode: tally.ModeYesNo},
+		Members:          []models.Member{{ID: "a1", Name: "Zoe"}, {ID: "b2", Name: "Adam"}},
+		FinalizedChoices: []models.Choice{{ID: "c1"}},
+		Choices: []models.Choice{{ID: "c1", Votes: []models.Vote{
+			{MemberID: "a1", Value: 1},
+			{MemberID: "b2", Value: 1},
+			{MemberID: "c3", Value: 0},
+		}}},
+	}
+	h := &SessionHandler{sessions: (*oneSession)(&session)}
+	router := gin.New()
+	router.GET("/api/results/:id", h.GetResultsByPermalink)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/results/xyz", nil))
+	var resp models.GetResultsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	var voters []string
+	for _, mark := range resp.Breakdowns["c1"].Marks {
+		voters = append(voters, mark.Voter)
+	}
+	if want := []string{"Adam", "Former member", "Zoe"}; !slices.Equal(voters, want) {
+		t.Errorf("expected marks %v, got %v", want, voters)
+	}
+}
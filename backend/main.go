@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	crand "crypto/rand"
+	"errors"
 	"log"
-	"math/rand"
+	"math/rand/v2"
 	"net/http"
 	"os"
-	"sort"
+	"slices"
 	"time"
 
+	"consensus/auth"
+	"consensus/backplane"
 	"consensus/database"
 	"consensus/handlers"
 	"consensus/models"
+	"consensus/phase"
+	"consensus/projection"
 	"consensus/repository"
+	"consensus/scheduler"
+	"consensus/tally"
 	"consensus/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -21,15 +29,71 @@ import (
 
 const DB_NAME = "dev"
 
+// Most runoffs a tie can go to before it is settled at random
+const MAX_RUNOFF_ROUNDS = 2
+
+// How often the scheduler checks for passed deadlines, finished async phases and
+// idle sessions
+const SCHEDULER_INTERVAL = 15 * time.Second
+
+// How long a session can go untouched before it is closed, unless SESSION_IDLE_TTL is set
+const DEFAULT_SESSION_IDLE_TTL = 24 * time.Hour
+
+// How long a member token is good for, unless MEMBER_TOKEN_TTL is set. Long enough to
+// see an async session through.
+const DEFAULT_MEMBER_TOKEN_TTL = 30 * 24 * time.Hour
+
 func generatePermalinkID() string {
 	const chars = "23456789abcdefghjkmnpqrstuvwxyz"
 	id := make([]byte, 10)
 	for i := range id {
-		id[i] = chars[rand.Intn(len(chars))]
+		id[i] = chars[rand.IntN(len(chars))]
 	}
 	return string(id)
 }
 
+// tieBreakOptions builds the tie-break settings for a session's tally
+func tieBreakOptions(session *models.Session) tally.TieBreakOptions {
+	opts := tally.TieBreakOptions{
+		Policy: session.Config.TieBreak,
+		Seed:   session.Seed,
+		Order:  make(map[string]int),
+	}
+
+	switch opts.Policy {
+	case tally.TieBreakEarliestSubmission:
+		choices := slices.Clone(session.FinalizedChoices)
+		slices.SortStableFunc(choices, func(a, b models.Choice) int { return a.CreatedAt.Compare(b.CreatedAt) })
+		for i, c := range choices {
+			opts.Order[c.ID] = i
+		}
+	case tally.TieBreakHost, tally.TieBreakRunoff:
+		for i, id := range session.TieOrder {
+			opts.Order[id] = i
+		}
+	}
+	return opts
+}
+
+// runoffFinalists picks the choices for another round of voting, or nil if the tally stands.
+// A runoff is held on a tie for first under the runoff policy, and once on the top
+// choices when the session asks for it.
+func runoffFinalists(session *models.Session, result *tally.Result, pending []string) []string {
+	if len(pending) > 0 && session.Config.TieBreak == tally.TieBreakRunoff && session.Round < MAX_RUNOFF_ROUNDS {
+		return pending
+	}
+
+	n := session.Config.RunoffTopN
+	if session.Round == 0 && n > 1 && n < len(result.Ranking) {
+		finalists := make([]string, 0, n)
+		for _, s := range result.Ranking[:n] {
+			finalists = append(finalists, s.Candidate)
+		}
+		return finalists
+	}
+	return nil
+}
+
 func CORSMiddleware(allowedOrigin string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
@@ -69,6 +133,33 @@ func main() {
 		allowedOrigin = "http://localhost:3000"
 	}
 
+	tokenSecret := []byte(os.Getenv("MEMBER_TOKEN_SECRET"))
+	if len(tokenSecret) == 0 {
+		log.Println("MEMBER_TOKEN_SECRET environment variable not found. Using a random secret, member tokens won't survive a restart")
+		tokenSecret = make([]byte, 32)
+		if _, err := crand.Read(tokenSecret); err != nil {
+			log.Fatalf("MEMBER_TOKEN_SECRET: %v", err)
+		}
+	}
+
+	tokenTTL := DEFAULT_MEMBER_TOKEN_TTL
+	if v := os.Getenv("MEMBER_TOKEN_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("MEMBER_TOKEN_TTL: %v", err)
+		}
+		tokenTTL = ttl
+	}
+
+	idleTTL := DEFAULT_SESSION_IDLE_TTL
+	if v := os.Getenv("SESSION_IDLE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("SESSION_IDLE_TTL: %v", err)
+		}
+		idleTTL = ttl
+	}
+
 	router := gin.Default()
 	router.Use(CORSMiddleware(allowedOrigin))
 
@@ -79,187 +170,293 @@ func main() {
 	})
 
 	sessionRepo := repository.NewSessionRepository(DB_NAME)
+	if err := sessionRepo.MigrateMemberIDs(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := sessionRepo.MigrateChoiceIDs(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
 	// Initialize WebSocket hub
 	hub := websocket.NewHub()
+	// Replicas behind a load balancer share sessions through MongoDB, which has to run
+	// as a replica set for the change streams this needs
+	if os.Getenv("BACKPLANE") == "mongo" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		bp, err := backplane.NewMongo(ctx, database.GetCollection(DB_NAME, "backplane"))
+		cancel()
+		if err != nil {
+			log.Fatal(err)
+		}
+		hub.Backplane = bp
+	}
 	go hub.Run()
 
 	hub.OnAllReady = func(sessionCode string) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if err := sessionRepo.UpdateSessionPhase(ctx, sessionCode, "voting"); err != nil {
+		if err := sessionRepo.TransitionPhase(ctx, sessionCode, phase.Lobby, phase.Voting); err != nil {
 			log.Printf("phase update: failed to set voting for session %s: %v", sessionCode, err)
 		}
 	}
 
-	hub.OnMemberSubmitted = func(sessionCode, memberName string) {
+	// Saved so a restarted backend resumes each session as it was
+	hub.OnReadyChanged = func(sessionCode, memberID string, ready bool) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if err := sessionRepo.SetMemberSubmitted(ctx, sessionCode, memberName, true); err != nil {
-			log.Printf("member submitted: failed for %s in session %s: %v", memberName, sessionCode, err)
+		if err := sessionRepo.SetMemberReady(ctx, sessionCode, memberID, ready); err != nil {
+			log.Printf("member ready: failed for %s in session %s: %v", memberID, sessionCode, err)
 		}
 	}
 
-	hub.OnAllSubmitted = func(sessionCode string) {
+	hub.OnCountdown = func(sessionCode string, countdown *models.Countdown) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
+		if err := sessionRepo.SetCountdown(ctx, sessionCode, countdown); err != nil {
+			log.Printf("countdown: failed to save for session %s: %v", sessionCode, err)
+		}
+	}
 
+	hub.CheckSubmitChoices = func(sessionCode, memberID string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 		session, err := sessionRepo.FindSessionByCode(ctx, sessionCode)
 		if err != nil {
-			log.Printf("finalize: failed to fetch session %s: %v", sessionCode, err)
-			return
+			return err
 		}
+		return session.Config.CheckChoiceCount(session.ChoiceCount(memberID))
+	}
 
-		choices := make([]models.Choice, len(session.Choices))
-		copy(choices, session.Choices)
-		rand.Shuffle(len(choices), func(i, j int) { choices[i], choices[j] = choices[j], choices[i] })
-
-		if err := sessionRepo.SaveFinalizedChoices(ctx, sessionCode, choices); err != nil {
-			log.Printf("finalize: failed to save for session %s: %v", sessionCode, err)
-			return
+	hub.SaveVote = func(sessionCode, memberID, choiceID string, value *int) (int, int, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		session, err := sessionRepo.FindSessionByCode(ctx, sessionCode)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !slices.ContainsFunc(session.FinalizedChoices, func(c models.Choice) bool { return c.ID == choiceID }) {
+			return 0, 0, errors.New("not a choice in this round")
+		}
+		if value != nil && *value != 0 && *value != 1 {
+			return 0, 0, errors.New("vote must be 0 or 1")
+		}
+		if !session.CanVote(memberID) {
+			return 0, 0, models.ErrEmptyVoter
 		}
 
-		if err := sessionRepo.UpdateSessionPhase(ctx, sessionCode, "results"); err != nil {
-			log.Printf("phase update: failed to set results for session %s: %v", sessionCode, err)
+		session, err = sessionRepo.CastVote(ctx, sessionCode, memberID, session.Round, choiceID, value)
+		if err != nil {
+			return 0, 0, err
+		}
+		cast, total := session.VoteProgress(memberID)
+		if value != nil && cast == total {
+			if err := sessionRepo.SetMemberVoted(ctx, sessionCode, memberID, true); err != nil {
+				log.Printf("member voted: failed for %s in session %s: %v", memberID, sessionCode, err)
+			}
 		}
+		return cast, total, nil
+	}
 
-		hub.BroadcastToSession(sessionCode, struct {
-			Type    string          `json:"type"`
-			Phase   string          `json:"phase"`
-			Ready   map[string]bool `json:"ready"`
-			Choices []models.Choice `json:"choices"`
-		}{
-			Type:    websocket.TypePhaseChanged,
-			Phase:   "results",
-			Ready:   hub.GetReadyState(sessionCode),
-			Choices: choices,
-		})
+	// Never with marks, so running totals don't say who voted for what
+	hub.RunningTotals = func(sessionCode string) (map[string]tally.Breakdown, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		session, err := sessionRepo.FindSessionByCode(ctx, sessionCode)
+		if err != nil {
+			return nil, err
+		}
+		candidates, ballots := session.Ballots()
+		return tally.Breakdowns(session.Config.VotingMode, candidates, ballots, false), nil
 	}
 
-	hub.OnMemberVoted = func(sessionCode, memberName string) {
+	hub.OnMemberSubmitted = func(sessionCode, memberID string) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if err := sessionRepo.SetMemberVoted(ctx, sessionCode, memberName, true); err != nil {
-			log.Printf("member voted: failed for %s in session %s: %v", memberName, sessionCode, err)
+		if err := sessionRepo.SetMemberSubmitted(ctx, sessionCode, memberID, true); err != nil {
+			log.Printf("member submitted: failed for %s in session %s: %v", memberID, sessionCode, err)
 		}
 	}
 
-	hub.OnHostDisconnected = func(sessionCode, newHostName string) {
+	hub.OnMemberUnsubmit = func(sessionCode, memberID string, action phase.Action) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if err := sessionRepo.TransferHost(ctx, sessionCode, newHostName); err != nil {
-			log.Printf("host transfer: failed for session %s to %s: %v", sessionCode, newHostName, err)
+		var err error
+		if action == phase.SubmitChoices {
+			err = sessionRepo.SetMemberSubmitted(ctx, sessionCode, memberID, false)
 		} else {
-			log.Printf("host transfer: %s is now host of session %s", newHostName, sessionCode)
+			err = sessionRepo.SetMemberVoted(ctx, sessionCode, memberID, false)
+		}
+		if err != nil {
+			log.Printf("member unsubmitted: failed for %s in session %s: %v", memberID, sessionCode, err)
 		}
 	}
 
-	hub.OnAllVoted = func(sessionCode string) {
+	hub.OnAllSubmitted = func(sessionCode string) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
 		session, err := sessionRepo.FindSessionByCode(ctx, sessionCode)
 		if err != nil {
-			log.Printf("ranking: failed to fetch session %s: %v", sessionCode, err)
+			log.Printf("finalize: failed to fetch session %s: %v", sessionCode, err)
 			return
 		}
 
-		scores := make(map[string]int)
-		numChoices := len(session.FinalizedChoices)
-
-		if session.Config.VotingMode == "ranked_choice" {
-			// Borda count: rank 1 → numChoices points, rank N → 1 point
-			for _, c := range session.Choices {
-				for _, v := range c.Votes {
-					scores[c.Title] += numChoices - v.Value + 1
-				}
-			}
-		} else {
-			// yes_no: count yes votes (value == 1)
-			for _, c := range session.Choices {
-				for _, v := range c.Votes {
-					if v.Value == 1 {
-						scores[c.Title]++
-					}
-				}
+		// Nothing was proposed, so there's nothing to vote on: close the session rather
+		// than open a vote on nothing
+		if len(session.Choices) == 0 {
+			if err := sessionRepo.CloseSession(ctx, sessionCode); err != nil {
+				log.Printf("finalize: failed to close session %s with no choices: %v", sessionCode, err)
+				return
 			}
+			hub.MarkSessionClosed(sessionCode)
+			hub.BroadcastToSession(sessionCode, websocket.SessionClosedMsg{
+				Type: websocket.TypeSessionClosed,
+			})
+			return
 		}
 
-		choices := make([]models.Choice, len(session.FinalizedChoices))
-		copy(choices, session.FinalizedChoices)
-		for i := range choices {
-			choices[i].Rank = scores[choices[i].Title]
+		// Seeded so the order is the same however many times the session is finalized
+		choices := make([]models.Choice, len(session.Choices))
+		copy(choices, session.Choices)
+		rng := rand.New(rand.NewPCG(uint64(session.Seed), 1))
+		rng.Shuffle(len(choices), func(i, j int) { choices[i], choices[j] = choices[j], choices[i] })
+
+		if err := sessionRepo.FinalizeChoices(ctx, sessionCode, choices); err != nil {
+			log.Printf("finalize: failed to save for session %s: %v", sessionCode, err)
+			return
 		}
-		sort.Slice(choices, func(i, j int) bool {
-			if choices[i].Rank != choices[j].Rank {
-				return choices[i].Rank > choices[j].Rank
+
+		// Voting doesn't wait on members who can't vote
+		var emptyVoters []string
+		for _, m := range session.Members {
+			if !session.CanVote(m.ID) {
+				emptyVoters = append(emptyVoters, m.ID)
 			}
-			return choices[i].Title < choices[j].Title
+		}
+		hub.MarkEmptyVoters(sessionCode, emptyVoters)
+		hub.SetPhase(sessionCode, phase.Results)
+
+		hub.BroadcastToSession(sessionCode, websocket.PhaseChangedMsg{
+			Type:    websocket.TypePhaseChanged,
+			Phase:   phase.Results,
+			Ready:   hub.GetReadyState(sessionCode),
+			Choices: projection.Choices(session.Config, choices, ""),
 		})
+	}
 
-		if err := sessionRepo.SaveRankedChoices(ctx, sessionCode, choices); err != nil {
-			log.Printf("ranking: failed to save for session %s: %v", sessionCode, err)
-			return
+	hub.OnHostDisconnected = func(sessionCode, newHostID string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := sessionRepo.TransferHost(ctx, sessionCode, newHostID); err != nil {
+			log.Printf("host transfer: failed for session %s to %s: %v", sessionCode, newHostID, err)
+		} else {
+			log.Printf("host transfer: %s is now host of session %s", newHostID, sessionCode)
 		}
+	}
 
-		if err := sessionRepo.UpdateSessionPhase(ctx, sessionCode, "final"); err != nil {
-			log.Printf("phase update: failed to set final for session %s: %v", sessionCode, err)
+	finalizer := &finalizer{sessions: sessionRepo, hub: hub}
+	finalizeSession := finalizer.finalize
+
+	hub.OnAllVoted = finalizeSession
+
+	hub.OnTieResolved = func(sessionCode string, order []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		session, err := sessionRepo.FindSessionByCode(ctx, sessionCode)
+		if err != nil {
+			log.Printf("tie resolution: failed to fetch session %s: %v", sessionCode, err)
+			return errors.New("session not found")
 		}
 
-		// Generate permalink
-		permalinkID := generatePermalinkID()
-		if err := sessionRepo.SetPermalink(ctx, sessionCode, permalinkID); err != nil {
-			log.Printf("permalink: failed to set for session %s: %v", sessionCode, err)
+		if !session.ClosedAt.IsZero() || session.Config.TieBreak != tally.TieBreakHost {
+			return errors.New("session does not accept a manual tie break")
 		}
 
-		// Close the session
-		if err := sessionRepo.CloseSession(ctx, sessionCode); err != nil {
-			log.Printf("close: failed for session %s: %v", sessionCode, err)
+		// The order has to cover exactly the tied choices, each once
+		pending := make(map[string]bool, len(session.PendingTie))
+		for _, id := range session.PendingTie {
+			pending[id] = true
+		}
+		if len(pending) == 0 {
+			return repository.ErrNoTiePending
+		}
+		if len(order) != len(pending) {
+			return errors.New("order must list each tied choice once")
+		}
+		for _, id := range order {
+			if !pending[id] {
+				return errors.New("order must list each tied choice once")
+			}
+			delete(pending, id)
 		}
 
-		// Mark session closed so host transfer is skipped on disconnect
-		hub.MarkSessionClosed(sessionCode)
+		if err := sessionRepo.SetTieOrder(ctx, sessionCode, order); err != nil {
+			log.Printf("tie resolution: failed to save for session %s: %v", sessionCode, err)
+			return err
+		}
 
-		// Broadcast final phase with permalink, then disconnect all clients
-		hub.BroadcastToSession(sessionCode, struct {
-			Type      string          `json:"type"`
-			Phase     string          `json:"phase"`
-			Ready     map[string]bool `json:"ready"`
-			Choices   []models.Choice `json:"choices"`
-			Permalink string          `json:"permalink"`
-		}{
-			Type:      websocket.TypePhaseChanged,
-			Phase:     "final",
-			Ready:     hub.GetReadyState(sessionCode),
-			Choices:   choices,
-			Permalink: permalinkID,
-		})
+		finalizeSession(sessionCode)
+		return nil
+	}
 
+	// Sessions move on when their deadline passes, and async sessions when the
+	// scheduler finds their members done rather than when the hub sees everyone
+	// connected finish
+	sched := scheduler.New(sessionRepo, repository.NewLeaseRepository(DB_NAME), SCHEDULER_INTERVAL, idleTTL)
+	sched.OnLobbyDone = func(sessionCode string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := sessionRepo.TransitionPhase(ctx, sessionCode, phase.Lobby, phase.Voting); err != nil {
+			log.Printf("scheduler: failed to start voting for session %s: %v", sessionCode, err)
+			return
+		}
+		hub.SetPhase(sessionCode, phase.Voting)
+		hub.BroadcastToSession(sessionCode, websocket.PhaseChangedMsg{
+			Type:  websocket.TypePhaseChanged,
+			Phase: phase.Voting,
+			Ready: hub.GetReadyState(sessionCode),
+		})
 	}
+	sched.OnChoicesDone = hub.OnAllSubmitted
+	sched.OnVotingDone = finalizeSession
+	sched.OnIdleClosed = func(sessionCode string) {
+		hub.MarkSessionClosed(sessionCode)
+		hub.BroadcastToSession(sessionCode, websocket.SessionClosedMsg{
+			Type: websocket.TypeSessionClosed,
+		})
+	}
+	go sched.Run(context.Background())
 
-	sessionHandler := handlers.NewSessionHandler(sessionRepo, hub)
-	wsHandler := websocket.NewHandler(hub, sessionRepo)
+	signer := auth.NewSigner(tokenSecret, tokenTTL)
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, hub, signer)
+	wsHandler := websocket.NewHandler(hub, sessionRepo, signer)
 	sessionRoutes := router.Group("/api/session")
 	{
 		sessionRoutes.POST("/", sessionHandler.CreateSession)
 		sessionRoutes.GET("/", sessionHandler.GetSessions)
 		sessionRoutes.POST("/:code/join", sessionHandler.JoinSession)
-		sessionRoutes.POST("/:code/leave", sessionHandler.LeaveSession)
 		sessionRoutes.GET("/:code", sessionHandler.GetSession)
-		sessionRoutes.PUT("/:code/config", sessionHandler.UpdateSessionConfig)
-		sessionRoutes.PUT("/:code/close", sessionHandler.CloseSession)
 
 		sessionRoutes.GET("/:code/member", sessionHandler.GetMembers)
-		sessionRoutes.GET("/:code/member/:name", sessionHandler.GetMember)    // TODO: convert name from path param to query param
-		sessionRoutes.PUT("/:code/member/:name", sessionHandler.UpdateMember) // TODO: convert name from path param to query param
+		sessionRoutes.GET("/:code/member/:name", sessionHandler.GetMember) // TODO: convert name from path param to query param
 		sessionRoutes.GET("/:code/ws", wsHandler.HandleWebSocket)
+	}
 
-		sessionRoutes.POST("/:code/member/:name/choice", sessionHandler.AddMemberChoice)
-		sessionRoutes.GET("/:code/member/:name/choice", sessionHandler.GetMemberChoices)
-		sessionRoutes.PUT("/:code/member/:name/choice/:title", sessionHandler.UpdateMemberChoice)
-		sessionRoutes.DELETE("/:code/member/:name/choice/:title", sessionHandler.RemoveMemberChoice)
-		sessionRoutes.DELETE("/:code/member/:name/choice", sessionHandler.ClearMemberChoices)
-		sessionRoutes.POST("/:code/member/:name/votes", sessionHandler.SubmitMemberVotes)
+	// Routes acting as a member take their identity from the member's token
+	memberRoutes := router.Group("/api/session/:code", sessionHandler.RequireMember)
+	{
+		memberRoutes.POST("/leave", sessionHandler.LeaveSession)
+		memberRoutes.PUT("/config", sessionHandler.UpdateSessionConfig)
+		memberRoutes.PUT("/close", sessionHandler.CloseSession)
+		memberRoutes.PUT("/me", sessionHandler.UpdateMember)
+
+		memberRoutes.POST("/me/choice", sessionHandler.AddMemberChoice)
+		memberRoutes.GET("/me/choice", sessionHandler.GetMemberChoices)
+		memberRoutes.PUT("/me/choice/:id", sessionHandler.UpdateMemberChoice)
+		memberRoutes.DELETE("/me/choice/:id", sessionHandler.RemoveMemberChoice)
+		memberRoutes.DELETE("/me/choice", sessionHandler.ClearMemberChoices)
+		memberRoutes.POST("/me/votes", sessionHandler.SubmitMemberVotes)
 	}
 
 	router.GET("/api/results/:id", sessionHandler.GetResultsByPermalink)
@@ -1,69 +1,227 @@
 package models
 
 import (
+	"consensus/tally"
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 )
 
+var (
+	ErrTooManyChoices = errors.New("too many choices")
+	ErrTooFewChoices  = errors.New("too few choices")
+	ErrEmptyVoter     = errors.New("members without choices can't vote in this session")
+	ErrSubmitted      = errors.New("choices are submitted; unsubmit to change them")
+)
+
 type Session struct {
-	Code      string        `json:"code" bson:"code"`
-	Members   []Member      `json:"members" bson:"members"`
+	Code             string        `json:"code" bson:"code"`
+	Members          []Member      `json:"members" bson:"members"`
 	Choices          []Choice      `json:"choices" bson:"choices"`
 	FinalizedChoices []Choice      `json:"finalizedChoices" bson:"finalizedChoices"`
 	RankedChoices    []Choice      `json:"rankedChoices" bson:"rankedChoices"`
-	Title     string        `json:"title" bson:"title"`
-	Phase     string        `json:"phase" bson:"phase"`
-	Permalink string        `json:"permalink" bson:"permalink"`
-	Config    SessionConfig `json:"config" bson:"config"`
-	CreatedAt time.Time     `json:"createdAt" bson:"createdAt"`
-	UpdatedAt time.Time     `json:"updatedAt" bson:"updatedAt"`
-	ClosedAt  time.Time     `json:"closedAt" bson:"closedAt"`
+	Tally            *tally.Result `json:"tally,omitempty" bson:"tally,omitempty"`
+	TieOrder         []string      `json:"tieOrder,omitempty" bson:"tieOrder,omitempty"`     // manual ordering of tied choices
+	PendingTie       []string      `json:"pendingTie,omitempty" bson:"pendingTie,omitempty"` // tied choices waiting on the host to order them
+	Round            int           `json:"round" bson:"round"`                               // 0 for the first vote, then one per runoff
+	Rounds           []VotingRound `json:"rounds" bson:"rounds"`                             // completed rounds before the current one
+	Seed             int64         `json:"-" bson:"seed"`                                    // drives shuffles and random tie breaks
+	Title            string        `json:"title" bson:"title"`
+	Phase            string        `json:"phase" bson:"phase"`
+	Deadline         time.Time     `json:"deadline" bson:"deadline"`                       // when the current phase ends, zero for never
+	Countdown        *Countdown    `json:"countdown,omitempty" bson:"countdown,omitempty"` // force start or grace period under way
+	Permalink        string        `json:"permalink" bson:"permalink"`
+	Config           SessionConfig `json:"config" bson:"config"`
+	CreatedAt        time.Time     `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time     `json:"updatedAt" bson:"updatedAt"`
+	ClosedAt         time.Time     `json:"closedAt" bson:"closedAt"`
 }
 
 type SessionConfig struct {
-	Anonymity          bool      `json:"anonymity" bson:"anonymity"`
-	VotingMode         string    `json:"voting_mode" binding:"required,oneof=yes_no ranked_choice" bson:"votingMode"`
-	MinChoices         int       `json:"min_choices" binding:"min=0" bson:"minChoices"`
-	MaxChoices         int       `json:"max_choices" binding:"required,gtefield=MinChoices" bson:"maxChoices"`
-	GracePeriodSeconds int       `json:"grace_period_seconds" binding:"min=0,max=30" bson:"gracePeriodSeconds"`
-	AllowEmptyVoters   bool      `json:"allow_empty_voters" bson:"allowEmptyVoters"`
-	Integration        string    `json:"integration" bson:"integration"`
-	CreatedAt          time.Time `json:"createdAt" bson:"createdAt"`
-	UpdatedAt          time.Time `json:"updatedAt" bson:"updatedAt"`
+	Anonymity          bool   `json:"anonymity" bson:"anonymity"`
+	VotingMode         string `json:"voting_mode" binding:"required,oneof=yes_no ranked_choice instant_runoff condorcet score star" bson:"votingMode"`
+	MinChoices         int    `json:"min_choices" binding:"min=0" bson:"minChoices"`
+	MaxChoices         int    `json:"max_choices" binding:"required,gtefield=MinChoices" bson:"maxChoices"`
+	GracePeriodSeconds int    `json:"grace_period_seconds" binding:"min=0,max=30" bson:"gracePeriodSeconds"`
+	AllowEmptyVoters   bool   `json:"allow_empty_voters" bson:"allowEmptyVoters"`
+	TieBreak           string `json:"tie_break" binding:"omitempty,oneof=random host earliest_submission runoff" bson:"tieBreak"`
+	RunoffTopN         int    `json:"runoff_top_n" binding:"omitempty,min=2" bson:"runoffTopN"` // re-vote on the top N after the first round
+	Integration        string `json:"integration" bson:"integration"`
+	LiveTotals         bool   `json:"live_totals" bson:"liveTotals"` // show votes so far while voting, for casual sessions; ignored when anonymous
+	// Async sessions run over hours or days: phases move on when every member is done
+	// or the phase's deadline passes, rather than when everyone connected is
+	Async           bool           `json:"async" bson:"async"`
+	DeadlineMinutes map[string]int `json:"deadline_minutes,omitempty" binding:"omitempty,dive,keys,oneof=lobby voting results runoff,endkeys,min=1" bson:"deadlineMinutes,omitempty"` // by phase
+	CreatedAt       time.Time      `json:"createdAt" bson:"createdAt"`
+	UpdatedAt       time.Time      `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CheckChoiceCount returns an error if a member can't submit n choices: fewer than
+// MinChoices, or none at all unless AllowEmptyVoters is set.
+func (cfg *SessionConfig) CheckChoiceCount(n int) error {
+	if n == 0 && cfg.AllowEmptyVoters {
+		return nil
+	}
+	if least := max(cfg.MinChoices, 1); n < least {
+		return fmt.Errorf("%w: add at least %d", ErrTooFewChoices, least)
+	}
+	if cfg.MaxChoices > 0 && n > cfg.MaxChoices {
+		return fmt.Errorf("%w: at most %d per member", ErrTooManyChoices, cfg.MaxChoices)
+	}
+	return nil
+}
+
+// DeadlineFor returns when a phase starting at start should end, or zero if it
+// has no deadline
+func (cfg *SessionConfig) DeadlineFor(p string, start time.Time) time.Time {
+	minutes := cfg.DeadlineMinutes[p]
+	if minutes <= 0 {
+		return time.Time{}
+	}
+	return start.Add(time.Duration(minutes) * time.Minute)
+}
+
+// ChoiceCount returns how many choices a member has proposed
+func (s *Session) ChoiceCount(memberID string) int {
+	n := 0
+	for i := range s.Choices {
+		if s.Choices[i].HasProposer(memberID) {
+			n++
+		}
+	}
+	return n
+}
+
+// CanVote reports whether a member can vote: everyone can when AllowEmptyVoters is
+// set, and otherwise only members who proposed a choice
+func (s *Session) CanVote(memberID string) bool {
+	return s.Config.AllowEmptyVoters || s.ChoiceCount(memberID) > 0
+}
+
+// HasSubmitted reports whether a member has submitted their choices
+func (s *Session) HasSubmitted(memberID string) bool {
+	return slices.ContainsFunc(s.Members, func(m Member) bool { return m.ID == memberID && m.Submitted })
+}
+
+// Ballots collects each member's votes in the current round into a ballot keyed by
+// choice ID. Votes are stored on the session's choices, while the candidates are the
+// finalized choices.
+func (s *Session) Ballots() ([]string, []tally.Ballot) {
+	candidates := make([]string, 0, len(s.FinalizedChoices))
+	for _, c := range s.FinalizedChoices {
+		candidates = append(candidates, c.ID)
+	}
+
+	byVoter := make(map[string]map[string]int)
+	var voters []string
+	for _, c := range s.Choices {
+		for _, v := range c.Votes {
+			if v.Round != s.Round {
+				continue
+			}
+			if byVoter[v.MemberID] == nil {
+				byVoter[v.MemberID] = make(map[string]int)
+				voters = append(voters, v.MemberID)
+			}
+			byVoter[v.MemberID][c.ID] = v.Value
+		}
+	}
+
+	ballots := make([]tally.Ballot, 0, len(voters))
+	for _, voter := range voters {
+		ballots = append(ballots, tally.Ballot{Voter: voter, Values: byVoter[voter]})
+	}
+	return candidates, ballots
+}
+
+// VoteProgress returns how many of the current round's choices a member has voted
+// on, and how many there are
+func (s *Session) VoteProgress(memberID string) (cast, total int) {
+	for _, finalized := range s.FinalizedChoices {
+		for _, c := range s.Choices {
+			if c.ID == finalized.ID && slices.ContainsFunc(c.Votes, func(v Vote) bool {
+				return v.MemberID == memberID && v.Round == s.Round
+			}) {
+				cast++
+			}
+		}
+	}
+	return cast, len(s.FinalizedChoices)
 }
 
 type Member struct {
+	ID        string    `json:"id" bson:"id"` // subject of the member's token
 	Code      string    `json:"code" bson:"code"`
 	Name      string    `json:"name" bson:"name"`
 	Host      bool      `json:"host" bson:"host"`
+	Ready     bool      `json:"ready" bson:"ready"` // in the lobby
 	Submitted bool      `json:"submitted" bson:"submitted"`
 	Voted     bool      `json:"voted" bson:"voted"`
+	BallotID  string    `json:"-" bson:"ballotID"` // client ID of the latest ballot in this round
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
 }
 
 type Vote struct {
-	MemberName string    `json:"memberName" bson:"memberName"`
-	Value      int       `json:"value" bson:"value"` // rank # for ranked_choice, 1/0 for yes_no
-	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt" bson:"updatedAt"`
+	MemberID  string    `json:"memberID" bson:"memberID"`
+	Value     int       `json:"value" bson:"value"` // rank # for ranked modes, 1/0 for yes_no, 0-5 for score/star
+	Round     int       `json:"round" bson:"round"` // the voting round the vote was cast in
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
 }
 
 type Choice struct {
-	MemberName    string    `json:"memberName" bson:"memberName"`
-	Title         string    `json:"title" bson:"title"`
-	Comment       string    `json:"comment" bson:"comment"`
-	Integration   string    `json:"integration" bson:"integration"`
-	IntegrationID string    `json:"integrationID" bson:"integrationID"`
-	Description   string    `json:"description" bson:"description"`
-	PosterPath    string    `json:"posterPath" bson:"posterPath"`
-	ReleaseDate   string    `json:"releaseDate" bson:"releaseDate"`
-	VoteAverage   float64   `json:"voteAverage" bson:"voteAverage"`
-	Genres        []string  `json:"genres" bson:"genres"`
-	Runtime       int       `json:"runtime" bson:"runtime"`
-	Language      string    `json:"language" bson:"language"`
-	Director      string    `json:"director" bson:"director"`
-	Votes         []Vote    `json:"votes" bson:"votes"`
-	Rank          int       `json:"rank" bson:"rank"` // populated after voting
-	CreatedAt     time.Time `json:"createdAt" bson:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt" bson:"updatedAt"`
+	ID            string                  `json:"id" bson:"id"`
+	Proposers     []Proposer              `json:"proposers" bson:"proposers"` // members who added the choice, in the order they added it
+	TitleKey      string                  `json:"-" bson:"titleKey"`          // normalized title, for spotting duplicates
+	Title         string                  `json:"title" bson:"title"`
+	Comment       string                  `json:"comment" bson:"comment"`
+	Integration   string                  `json:"integration" bson:"integration"`
+	IntegrationID string                  `json:"integrationID" bson:"integrationID"`
+	Description   string                  `json:"description" bson:"description"`
+	PosterPath    string                  `json:"posterPath" bson:"posterPath"`
+	ReleaseDate   string                  `json:"releaseDate" bson:"releaseDate"`
+	VoteAverage   float64                 `json:"voteAverage" bson:"voteAverage"`
+	Genres        []string                `json:"genres" bson:"genres"`
+	Runtime       int                     `json:"runtime" bson:"runtime"`
+	Language      string                  `json:"language" bson:"language"`
+	Director      string                  `json:"director" bson:"director"`
+	Votes         []Vote                  `json:"votes" bson:"votes"`
+	Breakdowns    map[int]tally.Breakdown `json:"breakdowns,omitempty" bson:"-"` // by round, in place of others' votes once tallied in an anonymous session
+	Rank          int                     `json:"rank" bson:"rank"`              // final place, populated after voting
+	Score         int                     `json:"score" bson:"score"`            // points from the tally, populated after voting
+	CreatedAt     time.Time               `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time               `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Proposer is a member who added a choice. Members adding the same choice are
+// merged into one choice with several proposers.
+type Proposer struct {
+	MemberID   string `json:"memberID" bson:"memberID"`
+	MemberName string `json:"memberName" bson:"memberName"` // kept in step by UpdateMember
+}
+
+// HasProposer reports whether a member proposed the choice
+func (c *Choice) HasProposer(memberID string) bool {
+	for _, p := range c.Proposers {
+		if p.MemberID == memberID {
+			return true
+		}
+	}
+	return false
+}
+
+// Countdown is a force start or grace period counting down in a session, saved so a
+// restarted backend picks it up where it left off
+type Countdown struct {
+	Action string    `json:"action" bson:"action"` // force_start, or the submission the grace period follows
+	EndsAt time.Time `json:"endsAt" bson:"endsAt"`
+}
+
+// VotingRound is a completed round of voting that led to a runoff
+type VotingRound struct {
+	Number  int           `json:"number" bson:"number"`
+	Choices []string      `json:"choices" bson:"choices"` // IDs of the choices voted on
+	Tally   *tally.Result `json:"tally" bson:"tally"`
 }
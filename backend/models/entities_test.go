@@ -0,0 +1,56 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckChoiceCount(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  SessionConfig
+		n    int
+		want error
+	}{
+		{"within limits", SessionConfig{MinChoices: 2, MaxChoices: 3}, 2, nil},
+		{"under minimum", SessionConfig{MinChoices: 2, MaxChoices: 3}, 1, ErrTooFewChoices},
+		{"over maximum", SessionConfig{MinChoices: 2, MaxChoices: 3}, 4, ErrTooManyChoices},
+		{"empty voter not allowed", SessionConfig{MaxChoices: 3}, 0, ErrTooFewChoices},
+		{"empty voter allowed", SessionConfig{MinChoices: 2, MaxChoices: 3, AllowEmptyVoters: true}, 0, nil},
+		{"empty voter allowed still needs minimum", SessionConfig{MinChoices: 2, MaxChoices: 3, AllowEmptyVoters: true}, 1, ErrTooFewChoices},
+	}
+	for _, c := range cases {
+		if err := c.cfg.CheckChoiceCount(c.n); !errors.Is(err, c.want) || (c.want == nil && err != nil) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestVoteProgress(t *testing.T) {
+	s := Session{
+		Round: 1,
+		Choices: []Choice{
+			{ID: "a", Votes: []Vote{{MemberID: "m1", Value: 1, Round: 1}, {MemberID: "m2", Round: 1}}},
+			{ID: "b", Votes: []Vote{{MemberID: "m1", Value: 1, Round: 0}}},
+			{ID: "c", Votes: []Vote{{MemberID: "m1", Round: 1}}},
+		},
+		FinalizedChoices: []Choice{{ID: "a"}, {ID: "b"}},
+	}
+	if cast, total := s.VoteProgress("m1"); cast != 1 || total != 2 {
+		t.Errorf("expected only this round's votes on finalized choices counted, got %d of %d", cast, total)
+	}
+}
+
+func TestCanVote(t *testing.T) {
+	session := Session{
+		Members: []Member{{ID: "m1"}, {ID: "m2"}},
+		Choices: []Choice{{ID: "c1", Proposers: []Proposer{{MemberID: "m1"}}}},
+	}
+	if !session.CanVote("m1") || session.CanVote("m2") {
+		t.Error("expected only the member with a choice to vote")
+	}
+	session.Config.AllowEmptyVoters = true
+	if !session.CanVote("m2") {
+		t.Error("expected empty voters to vote when the session allows them")
+	}
+}
@@ -10,18 +10,10 @@ type JoinSessionRequest struct {
 	Name string `json:"name" binding:"required"`
 }
 
-type LeaveSessionRequest struct {
-	Name string `json:"name" binding:"required"`
-}
-
 type UpdateSessionConfigRequest struct {
 	NewConfig SessionConfig `json:"newConfig" binding:"required"`
 }
 
-type CloseSessionRequest struct {
-	Name string `json:"name" binding:"required"`
-}
-
 type UpdateMemberRequest struct {
 	NewName string `json:"newName" binding:"required"`
 }
@@ -41,12 +33,13 @@ type AddChoiceRequest struct {
 }
 
 type VoteValue struct {
-	ChoiceTitle string `json:"choiceTitle" binding:"required"`
-	Value       int    `json:"value" binding:"min=0"`
+	ChoiceID string `json:"choiceID" binding:"required"`
+	Value    int    `json:"value"` // checked against the voting mode by the handler
 }
 
 type SubmitVotesRequest struct {
-	Votes []VoteValue `json:"votes" binding:"required"`
+	BallotID string      `json:"ballotID" binding:"required,max=64"` // chosen by the client, so a retried submission is only counted once
+	Votes    []VoteValue `json:"votes" binding:"required"`
 }
 
 type UpdateChoiceRequest struct {
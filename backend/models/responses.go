@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"consensus/tally"
+	"time"
+)
 
 type ErrorResponse struct {
 	Error string
@@ -10,9 +13,22 @@ type MsgResponse struct {
 	Msg string
 }
 
+// FieldError points at the part of a request body that failed validation, such
+// as "votes[2].value"
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+type ValidationErrorResponse struct {
+	Error  string
+	Fields []FieldError
+}
+
 type CreateSessionResponse struct {
-	Msg  string
-	Code string
+	Msg   string
+	Code  string
+	Token string
 }
 
 type GetSessionResponse struct {
@@ -34,6 +50,7 @@ type UpdateSessionConfigResponse struct {
 type JoinSessionResponse struct {
 	Msg     string
 	Session Session
+	Token   string
 }
 
 type GetMemberResponse struct {
@@ -88,11 +105,20 @@ type UpdateChoiceResponse struct {
 	Choice Choice `json:"choice"`
 }
 
+type SubmitVotesResponse struct {
+	Msg      string `json:"msg"`
+	BallotID string `json:"ballotID"`
+}
+
 type GetResultsResponse struct {
-	Msg           string    `json:"msg"`
-	Title         string    `json:"title"`
-	RankedChoices []Choice  `json:"rankedChoices"`
-	VotingMode    string    `json:"votingMode"`
-	Permalink     string    `json:"permalink"`
-	CreatedAt     time.Time `json:"createdAt"`
+	Msg           string        `json:"msg"`
+	Title         string        `json:"title"`
+	RankedChoices []Choice      `json:"rankedChoices"`
+	Explanation   *tally.Result `json:"explanation"`
+	// Breakdowns of the final round's votes by choice ID. Choices knocked out in an
+	// earlier round have none.
+	Breakdowns map[string]tally.Breakdown `json:"breakdowns"`
+	VotingMode string                     `json:"votingMode"`
+	Permalink  string                     `json:"permalink"`
+	CreatedAt  time.Time                  `json:"createdAt"`
 }
@@ -0,0 +1,92 @@
+package phase
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Session phases, in the order a session moves through them
+const (
+	Lobby   = "lobby"   // members join and ready up
+	Voting  = "voting"  // members add choices
+	Results = "results" // members vote on the finalized choices
+	Runoff  = "runoff"  // members vote again on the finalists
+	Final   = "final"   // results are in and the session is closed
+)
+
+// Action is a mutation a member can make to a session
+type Action string
+
+const (
+	Join          Action = "join"
+	UpdateConfig  Action = "update_config"
+	SetReady      Action = "set_ready"
+	ForceStart    Action = "force_start"
+	EditChoices   Action = "edit_choices"
+	SubmitChoices Action = "submit_choices"
+	SubmitVotes   Action = "submit_votes"
+	ResolveTie    Action = "resolve_tie"
+)
+
+var ErrActionNotAllowed = errors.New("action not allowed in this phase")
+var ErrIllegalTransition = errors.New("illegal phase transition")
+
+// transitions lists the phases each phase can move to
+var transitions = map[string][]string{
+	Lobby:   {Voting},
+	Voting:  {Results},
+	Results: {Runoff, Final},
+	Runoff:  {Runoff, Final},
+	Final:   {},
+}
+
+// allowed lists the phases each action can be taken in
+var allowed = map[Action][]string{
+	Join:          {Lobby},
+	UpdateConfig:  {Lobby},
+	SetReady:      {Lobby},
+	ForceStart:    {Lobby},
+	EditChoices:   {Voting},
+	SubmitChoices: {Voting},
+	SubmitVotes:   {Results, Runoff},
+	ResolveTie:    {Results, Runoff},
+}
+
+// Normalize maps the empty phase of sessions created before phases existed to Lobby
+func Normalize(p string) string {
+	if p == "" {
+		return Lobby
+	}
+	return p
+}
+
+// Check returns ErrActionNotAllowed if the action can't be taken in the current phase
+func Check(current string, action Action) error {
+	if !slices.Contains(allowed[action], Normalize(current)) {
+		return fmt.Errorf("%w: cannot %s during %s", ErrActionNotAllowed, action, Normalize(current))
+	}
+	return nil
+}
+
+// CheckTransition returns ErrIllegalTransition if a session can't move from one phase to another
+func CheckTransition(from, to string) error {
+	if !slices.Contains(transitions[Normalize(from)], to) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, Normalize(from), to)
+	}
+	return nil
+}
+
+// Stored returns the values a phase may be stored as, for matching in queries
+func Stored(phases ...string) []string {
+	out := slices.Clone(phases)
+	if slices.Contains(phases, Lobby) {
+		out = append(out, "")
+	}
+	return out
+}
+
+// AllowedPhases returns the phases an action can be taken in
+func AllowedPhases(action Action) []string {
+	return slices.Clone(allowed[action])
+}
@@ -0,0 +1,77 @@
+package phase
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		phase  string
+		action Action
+		ok     bool
+	}{
+		{"", Join, true},
+		{Lobby, Join, true},
+		{Voting, Join, false},
+		{Lobby, EditChoices, false},
+		{Voting, EditChoices, true},
+		{Results, EditChoices, false},
+		{Voting, SubmitVotes, false},
+		{Results, SubmitVotes, true},
+		{Runoff, SubmitVotes, true},
+		{Final, SubmitVotes, false},
+		{Final, ResolveTie, false},
+		{Results, UpdateConfig, false},
+	}
+	for _, c := range cases {
+		err := Check(c.phase, c.action)
+		if c.ok && err != nil {
+			t.Errorf("%s during %q: unexpected error: %v", c.action, c.phase, err)
+		}
+		if !c.ok && !errors.Is(err, ErrActionNotAllowed) {
+			t.Errorf("%s during %q: expected ErrActionNotAllowed, got %v", c.action, c.phase, err)
+		}
+	}
+}
+
+func TestCheckTransition(t *testing.T) {
+	legal := [][2]string{
+		{"", Voting},
+		{Lobby, Voting},
+		{Voting, Results},
+		{Results, Runoff},
+		{Results, Final},
+		{Runoff, Runoff},
+		{Runoff, Final},
+	}
+	for _, tr := range legal {
+		if err := CheckTransition(tr[0], tr[1]); err != nil {
+			t.Errorf("%q to %s: unexpected error: %v", tr[0], tr[1], err)
+		}
+	}
+
+	illegal := [][2]string{
+		{Lobby, Results},
+		{Voting, Voting},
+		{Voting, Lobby},
+		{Results, Voting},
+		{Final, Lobby},
+		{Final, Final},
+	}
+	for _, tr := range illegal {
+		if err := CheckTransition(tr[0], tr[1]); !errors.Is(err, ErrIllegalTransition) {
+			t.Errorf("%q to %s: expected ErrIllegalTransition, got %v", tr[0], tr[1], err)
+		}
+	}
+}
+
+func TestStoredIncludesLegacyLobby(t *testing.T) {
+	if got := Stored(Lobby); !slices.Equal(got, []string{Lobby, ""}) {
+		t.Errorf("expected lobby and empty phase, got %v", got)
+	}
+	if got := Stored(Results, Runoff); !slices.Equal(got, []string{Results, Runoff}) {
+		t.Errorf("expected results and runoff, got %v", got)
+	}
+}
@@ -0,0 +1,117 @@
+// Package projection shapes sessions for the clients that receive them. While a
+// round is being voted on, members only see their own votes in it, unless the
+// session shows live totals. In an anonymous session it hides who proposed each
+// choice, except from the member themselves, and sends only the member's own votes,
+// with totals for each round once it's tallied, so the server never sends what the
+// UI hides.
+package projection
+
+import (
+	"consensus/models"
+	"consensus/phase"
+	"consensus/tally"
+	"slices"
+)
+
+// Session returns the session as viewerID may see it. viewerID is the member
+// receiving it, or "" when it goes to everyone or to someone outside the session.
+func Session(s models.Session, viewerID string) models.Session {
+	if s.Config.Anonymity {
+		s.Choices = withBreakdowns(s)
+	}
+	s.Choices = Choices(s.Config, hideOpenRound(s, viewerID), viewerID)
+	s.FinalizedChoices = Choices(s.Config, s.FinalizedChoices, viewerID)
+	s.RankedChoices = Choices(s.Config, s.RankedChoices, viewerID)
+	return s
+}
+
+// Sessions returns sessions as anyone may see them
+func Sessions(sessions []models.Session) []models.Session {
+	out := make([]models.Session, len(sessions))
+	for i, s := range sessions {
+		out[i] = Session(s, "")
+	}
+	return out
+}
+
+// hideOpenRound returns the session's choices without other members' votes in the
+// round being voted on, so no one's votes sway the rest. Live totals show them, but
+// only when voters are named.
+func hideOpenRound(s models.Session, viewerID string) []models.Choice {
+	if s.Choices == nil || phase.Check(s.Phase, phase.SubmitVotes) != nil || (s.Config.LiveTotals && !s.Config.Anonymity) {
+		return s.Choices
+	}
+	out := make([]models.Choice, len(s.Choices))
+	for i, c := range s.Choices {
+		if c.Votes != nil {
+			c.Votes = slices.DeleteFunc(slices.Clone(c.Votes), func(v models.Vote) bool {
+				return v.Round == s.Round && (viewerID == "" || v.MemberID != viewerID)
+			})
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// withBreakdowns returns the session's choices with the votes of each tallied round
+// summed up
+func withBreakdowns(s models.Session) []models.Choice {
+	if s.Choices == nil {
+		return nil
+	}
+	tallied := func(round int) bool { return round < s.Round || s.Tally != nil }
+
+	out := make([]models.Choice, len(s.Choices))
+	for i, c := range s.Choices {
+		byRound := make(map[int][]tally.Ballot)
+		for _, v := range c.Votes {
+			if tallied(v.Round) {
+				byRound[v.Round] = append(byRound[v.Round], tally.Ballot{Values: map[string]int{c.ID: v.Value}})
+			}
+		}
+		if len(byRound) > 0 {
+			c.Breakdowns = make(map[int]tally.Breakdown, len(byRound))
+			for round, ballots := range byRound {
+				c.Breakdowns[round] = tally.Breakdowns(s.Config.VotingMode, []string{c.ID}, ballots, false)[c.ID]
+			}
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// Choices returns choices from a session with the given config as viewerID may see them
+func Choices(cfg models.SessionConfig, choices []models.Choice, viewerID string) []models.Choice {
+	if choices == nil {
+		return nil
+	}
+	out := make([]models.Choice, len(choices))
+	for i, c := range choices {
+		out[i] = Choice(cfg, c, viewerID)
+	}
+	return out
+}
+
+// Choice returns a choice from a session with the given config as viewerID may see it
+func Choice(cfg models.SessionConfig, c models.Choice, viewerID string) models.Choice {
+	if !cfg.Anonymity {
+		return c
+	}
+
+	proposers := []models.Proposer{}
+	for _, p := range c.Proposers {
+		if viewerID != "" && p.MemberID == viewerID {
+			proposers = append(proposers, p)
+		}
+	}
+	c.Proposers = proposers
+
+	// Even without voters, values from one ballot line up across choices, so only
+	// the viewer's own votes are sent
+	if c.Votes != nil {
+		c.Votes = slices.DeleteFunc(slices.Clone(c.Votes), func(v models.Vote) bool {
+			return viewerID == "" || v.MemberID != viewerID
+		})
+	}
+	return c
+}
@@ -0,0 +1,113 @@
+package projection
+
+import (
+	"consensus/models"
+	"consensus/phase"
+	"consensus/tally"
+	"testing"
+	"time"
+)
+
+func choice() models.Choice {
+	now := time.Now()
+	return models.Choice{
+		ID:        "c1",
+		Proposers: []models.Proposer{{MemberID: "alice", MemberName: "Alice"}, {MemberID: "bob", MemberName: "Bob"}},
+		Votes: []models.Vote{
+			{MemberID: "alice", Value: 3, CreatedAt: now},
+			{MemberID: "bob", Value: 1, CreatedAt: now},
+		},
+	}
+}
+
+func TestChoiceLeavesNamedSessionsAlone(t *testing.T) {
+	got := Choice(models.SessionConfig{}, choice(), "")
+	if len(got.Proposers) != 2 || got.Votes[0].MemberID != "alice" {
+		t.Errorf("expected choice unchanged, got %+v", got)
+	}
+}
+
+func TestChoiceRedactsOthersWhenAnonymous(t *testing.T) {
+	cfg := models.SessionConfig{Anonymity: true}
+
+	got := Choice(cfg, choice(), "")
+	if len(got.Proposers) != 0 {
+		t.Errorf("expected no proposers, got %+v", got.Proposers)
+	}
+	if len(got.Votes) != 0 {
+		t.Errorf("expected no votes, got %+v", got.Votes)
+	}
+
+	got = Choice(cfg, choice(), "alice")
+	if len(got.Proposers) != 1 || got.Proposers[0].MemberID != "alice" {
+		t.Errorf("expected only the viewer as proposer, got %+v", got.Proposers)
+	}
+	if len(got.Votes) != 1 || got.Votes[0].MemberID != "alice" {
+		t.Errorf("expected only the viewer's vote, got %+v", got.Votes)
+	}
+}
+
+func TestSessionDoesNotModifyOriginal(t *testing.T) {
+	s := models.Session{Config: models.SessionConfig{Anonymity: true}, Choices: []models.Choice{choice()}}
+	Session(s, "")
+	if s.Choices[0].Votes[0].MemberID != "alice" || len(s.Choices[0].Proposers) != 2 {
+		t.Errorf("expected original untouched, got %+v", s.Choices[0])
+	}
+}
+
+func TestSessionHidesOthersVotesWhileVoting(t *testing.T) {
+	s := models.Session{Phase: phase.Results, Choices: []models.Choice{choice()}}
+
+	if votes := Session(s, "alice").Choices[0].Votes; len(votes) != 1 || votes[0].MemberID != "alice" {
+		t.Errorf("expected only the viewer's vote while voting, got %+v", votes)
+	}
+	if votes := Session(s, "").Choices[0].Votes; len(votes) != 0 {
+		t.Errorf("expected no votes for someone outside the session, got %+v", votes)
+	}
+
+	s.Config.LiveTotals = true
+	if votes := Session(s, "alice").Choices[0].Votes; len(votes) != 2 {
+		t.Errorf("expected every vote with live totals, got %+v", votes)
+	}
+
+	s.Config.LiveTotals = false
+	s.Phase = phase.Final
+	if votes := Session(s, "alice").Choices[0].Votes; len(votes) != 2 {
+		t.Errorf("expected every vote once the round is over, got %+v", votes)
+	}
+}
+
+func TestSessionSumsUpTalliedRoundsWhenAnonymous(t *testing.T) {
+	c := models.Choice{ID: "c1", Votes: []models.Vote{
+		{MemberID: "alice", Value: 1, Round: 0},
+		{MemberID: "bob", Value: 0, Round: 0},
+		{MemberID: "alice", Value: 1, Round: 1},
+		{MemberID: "bob", Value: 1, Round: 1},
+	}}
+	s := models.Session{
+		Phase:   phase.Runoff,
+		Round:   1,
+		Config:  models.SessionConfig{Anonymity: true, VotingMode: tally.ModeYesNo},
+		Choices: []models.Choice{c},
+	}
+
+	got := Session(s, "alice").Choices[0]
+	for _, v := range got.Votes {
+		if v.MemberID != "alice" {
+			t.Errorf("expected only the viewer's votes, got %+v", got.Votes)
+		}
+	}
+	if len(got.Breakdowns) != 1 || got.Breakdowns[0].Yes != 1 || got.Breakdowns[0].No != 1 {
+		t.Errorf("expected totals for the tallied first round only, got %+v", got.Breakdowns)
+	}
+
+	s.Phase = phase.Final
+	s.Tally = &tally.Result{}
+	got = Session(s, "").Choices[0]
+	if len(got.Votes) != 0 {
+		t.Errorf("expected no votes for someone outside the session, got %+v", got.Votes)
+	}
+	if len(got.Breakdowns) != 2 || got.Breakdowns[1].Yes != 2 {
+		t.Errorf("expected totals for both rounds once tallied, got %+v", got.Breakdowns)
+	}
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"consensus/models"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// newChoiceID returns a random ID for a choice
+func newChoiceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// normalizeTitle reduces a title to lowercase letters and digits separated by
+// single spaces, so "Dune: Part Two" and "dune part two" compare equal.
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// isDuplicate reports whether two choices are the same thing. Choices from the same
+// integration item always are. Otherwise matching titles are, unless both choices
+// point at different integration items, like two films sharing a name.
+func isDuplicate(a, b *models.Choice) bool {
+	aLinked := a.Integration != "" && a.IntegrationID != ""
+	bLinked := b.Integration != "" && b.IntegrationID != ""
+	if aLinked && bLinked {
+		return a.Integration == b.Integration && a.IntegrationID == b.IntegrationID
+	}
+	return a.TitleKey != "" && a.TitleKey == b.TitleKey
+}
+
+// findDuplicate returns the choice that duplicates c, if there is one
+func findDuplicate(choices []models.Choice, c *models.Choice) *models.Choice {
+	for i := range choices {
+		if choices[i].ID != c.ID && isDuplicate(&choices[i], c) {
+			return &choices[i]
+		}
+	}
+	return nil
+}
+
+// duplicateQuery matches a choice element that isDuplicate would consider the same
+// as c, or returns false if nothing could be
+func duplicateQuery(c *models.Choice) (bson.D, bool) {
+	var or bson.A
+	linked := c.Integration != "" && c.IntegrationID != ""
+	if linked {
+		or = append(or, bson.D{{"integration", c.Integration}, {"integrationID", c.IntegrationID}})
+	}
+	if c.TitleKey != "" {
+		if linked {
+			or = append(or, bson.D{{"titleKey", c.TitleKey}, {"integrationID", ""}})
+		} else {
+			or = append(or, bson.D{{"titleKey", c.TitleKey}})
+		}
+	}
+	if len(or) == 0 {
+		return nil, false
+	}
+	return bson.D{{"$or", or}, {"id", bson.D{{"$ne", c.ID}}}}, true
+}
+
+// noDuplicateOf matches sessions with no choice duplicating c
+func noDuplicateOf(c *models.Choice) bson.D {
+	query, ok := duplicateQuery(c)
+	if !ok {
+		return bson.D{}
+	}
+	return bson.D{{"choices", bson.D{{"$not", bson.D{{"$elemMatch", query}}}}}}
+}
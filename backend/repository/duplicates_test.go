@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"consensus/models"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	cases := map[string]string{
+		"Dune":             "dune",
+		"  DUNE  ":         "dune",
+		"Dune: Part Two":   "dune part two",
+		"dune -- part two": "dune part two",
+		"Amélie":           "amélie",
+		"!!!":              "",
+	}
+	for in, want := range cases {
+		if got := normalizeTitle(in); got != want {
+			t.Errorf("normalizeTitle(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	choice := func(title, integration, integrationID string) *models.Choice {
+		return &models.Choice{
+			Title:         title,
+			TitleKey:      normalizeTitle(title),
+			Integration:   integration,
+			IntegrationID: integrationID,
+		}
+	}
+
+	cases := []struct {
+		name string
+		a, b *models.Choice
+		want bool
+	}{
+		{"same title", choice("Dune", "", ""), choice("dune!", "", ""), true},
+		{"different title", choice("Dune", "", ""), choice("Arrival", "", ""), false},
+		{"same integration item", choice("Dune", "tmdb", "438631"), choice("Dune (2021)", "tmdb", "438631"), true},
+		{"different integration items", choice("Dune", "tmdb", "438631"), choice("Dune", "tmdb", "841"), false},
+		{"typed title matches integration item", choice("Dune", "", ""), choice("Dune", "tmdb", "438631"), true},
+	}
+	for _, c := range cases {
+		if got := isDuplicate(c.a, c.b); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+		if got := isDuplicate(c.b, c.a); got != c.want {
+			t.Errorf("%s (reversed): expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
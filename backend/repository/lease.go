@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"consensus/database"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// LeaseRepository hands out named leases, so that work like the scheduler's runs on
+// only one backend replica at a time
+type LeaseRepository struct {
+	lease *mongo.Collection
+}
+
+func NewLeaseRepository(dbName string) *LeaseRepository {
+	return &LeaseRepository{
+		lease: database.GetCollection(dbName, "lease"),
+	}
+}
+
+// Acquire gives holder the named lease until now+ttl, extending it if holder already
+// has it. It reports false while another holder's lease hasn't expired.
+func (repo *LeaseRepository) Acquire(ctx context.Context, name string, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	filter := bson.D{
+		{"_id", bson.D{{"$eq", name}}},
+		{"$or", bson.A{
+			bson.D{{"holder", bson.D{{"$eq", holder}}}},
+			bson.D{{"expiresAt", bson.D{{"$lte", now}}}},
+		}},
+	}
+	update := bson.D{{"$set", bson.D{
+		{"holder", holder},
+		{"expiresAt", now.Add(ttl)},
+	}}}
+
+	_, err := repo.lease.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Someone else holds it, so the filter missed and the upsert clashed with their lease
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Release gives up holder's lease early so another replica can take over
+func (repo *LeaseRepository) Release(ctx context.Context, name string, holder string) error {
+	filter := bson.D{
+		{"_id", bson.D{{"$eq", name}}},
+		{"holder", bson.D{{"$eq", holder}}},
+	}
+	_, err := repo.lease.DeleteOne(ctx, filter)
+	return err
+}
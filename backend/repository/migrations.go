@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"consensus/auth"
+	"consensus/models"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// legacySession holds just the fields of a session that referred to members by name
+type legacySession struct {
+	ID      bson.ObjectID `bson:"_id"`
+	Code    string        `bson:"code"`
+	Members []struct {
+		ID   string `bson:"id"`
+		Name string `bson:"name"`
+	} `bson:"members"`
+	Choices          []legacyChoice `bson:"choices"`
+	FinalizedChoices []legacyChoice `bson:"finalizedChoices"`
+	RankedChoices    []legacyChoice `bson:"rankedChoices"`
+}
+
+type legacyChoice struct {
+	ID         string `bson:"id"`
+	Title      string `bson:"title"`
+	MemberID   string `bson:"memberID"`
+	MemberName string `bson:"memberName"`
+	Votes      []struct {
+		MemberID   string `bson:"memberID"`
+		MemberName string `bson:"memberName"`
+	} `bson:"votes"`
+}
+
+// missing matches documents with an element of an array field lacking all the keys
+func missing(array string, keys ...string) bson.D {
+	absent := bson.D{}
+	for _, key := range keys {
+		absent = append(absent, bson.E{key, bson.D{{"$exists", false}}})
+	}
+	return bson.D{{array, bson.D{{"$elemMatch", absent}}}}
+}
+
+// MigrateMemberIDs gives members from before member IDs existed an ID, and points
+// their choices and votes at it instead of at their display name. Names that no
+// longer belong to a member, because they left, still get an ID each so their
+// votes stay grouped. Sessions already migrated are skipped, so it is safe to run
+// on every startup.
+func (repo *SessionRepository) MigrateMemberIDs(ctx context.Context) error {
+	filter := bson.D{{"$or", bson.A{
+		missing("members", "id"),
+		missing("choices", "memberID", "id"),
+		missing("choices.votes", "memberID"),
+		missing("finalizedChoices", "memberID", "id"),
+		missing("rankedChoices", "memberID", "id"),
+	}}}
+
+	cursor, err := repo.session.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []legacySession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		ids := make(map[string]string) // display name → member ID
+		for _, m := range session.Members {
+			if m.ID != "" {
+				ids[m.Name] = m.ID
+			}
+		}
+		idFor := func(name string) string {
+			if ids[name] == "" {
+				ids[name] = auth.NewMemberID()
+			}
+			return ids[name]
+		}
+
+		set := bson.D{}
+		unset := bson.D{}
+		for i, m := range session.Members {
+			if m.ID == "" {
+				set = append(set, bson.E{"members." + strconv.Itoa(i) + ".id", idFor(m.Name)})
+			}
+		}
+		for field, choices := range map[string][]legacyChoice{
+			"choices":          session.Choices,
+			"finalizedChoices": session.FinalizedChoices,
+			"rankedChoices":    session.RankedChoices,
+		} {
+			for i, c := range choices {
+				path := field + "." + strconv.Itoa(i)
+				if c.MemberID == "" && c.ID == "" {
+					set = append(set, bson.E{path + ".memberID", idFor(c.MemberName)})
+				}
+				for j, v := range c.Votes {
+					if v.MemberID == "" {
+						votePath := path + ".votes." + strconv.Itoa(j)
+						set = append(set, bson.E{votePath + ".memberID", idFor(v.MemberName)})
+						unset = append(unset, bson.E{votePath + ".memberName", ""})
+					}
+				}
+			}
+		}
+
+		update := bson.D{{"$set", set}}
+		if len(unset) > 0 {
+			update = append(update, bson.E{"$unset", unset})
+		}
+		if _, err := repo.session.UpdateOne(ctx, bson.D{{"_id", session.ID}}, update); err != nil {
+			return fmt.Errorf("failed to migrate session %s: %w", session.Code, err)
+		}
+	}
+
+	if len(sessions) > 0 {
+		log.Printf("migration: gave members IDs in %d sessions", len(sessions))
+	}
+	return nil
+}
+
+// MigrateChoiceIDs gives choices from before choice IDs existed an ID, and replaces
+// the member who added each with a list of proposers. Copies of a choice in the
+// finalized and ranked choices get the same ID as the original. Duplicates that were
+// already added are left as they are rather than merged, since votes may be on both.
+// It must run after MigrateMemberIDs, and is safe to run on every startup.
+func (repo *SessionRepository) MigrateChoiceIDs(ctx context.Context) error {
+	filter := bson.D{{"$or", bson.A{
+		missing("choices", "id"),
+		missing("finalizedChoices", "id"),
+		missing("rankedChoices", "id"),
+	}}}
+
+	cursor, err := repo.session.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []legacySession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		ids := make(map[[2]string]string) // member ID and title → choice ID
+		set := bson.D{}
+		unset := bson.D{}
+		for _, field := range []string{"choices", "finalizedChoices", "rankedChoices"} {
+			choices := map[string][]legacyChoice{
+				"choices":          session.Choices,
+				"finalizedChoices": session.FinalizedChoices,
+				"rankedChoices":    session.RankedChoices,
+			}[field]
+			for i, c := range choices {
+				if c.ID != "" {
+					continue
+				}
+				key := [2]string{c.MemberID, c.Title}
+				if ids[key] == "" {
+					ids[key] = newChoiceID()
+				}
+
+				path := field + "." + strconv.Itoa(i)
+				set = append(set,
+					bson.E{path + ".id", ids[key]},
+					bson.E{path + ".titleKey", normalizeTitle(c.Title)},
+					bson.E{path + ".proposers", bson.A{models.Proposer{MemberID: c.MemberID, MemberName: c.MemberName}}},
+				)
+				unset = append(unset,
+					bson.E{path + ".memberID", ""},
+					bson.E{path + ".memberName", ""},
+				)
+			}
+		}
+
+		update := bson.D{{"$set", set}, {"$unset", unset}}
+		if _, err := repo.session.UpdateOne(ctx, bson.D{{"_id", session.ID}}, update); err != nil {
+			return fmt.Errorf("failed to migrate session %s: %w", session.Code, err)
+		}
+	}
+
+	if len(sessions) > 0 {
+		log.Printf("migration: gave choices IDs in %d sessions", len(sessions))
+	}
+	return nil
+}
@@ -3,7 +3,10 @@ package repository
 import (
 	"consensus/database"
 	"consensus/models"
+	"consensus/phase"
+	"consensus/tally"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -13,6 +16,17 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+// Most times a choice write is retried after losing a race with another member's
+const MAX_CHOICE_WRITE_ATTEMPTS = 3
+
+var ErrAlreadyProposed = errors.New("member already added this choice")
+
+var ErrRoundOver = errors.New("voting round is over")
+
+var ErrNoChoices = errors.New("no choices to vote on")
+
+var ErrNoTiePending = errors.New("no tie is waiting to be ordered")
+
 type SessionRepository struct {
 	session *mongo.Collection
 }
@@ -23,12 +37,70 @@ func NewSessionRepository(dbName string) *SessionRepository {
 	}
 }
 
+// inPhase matches sessions in a phase that allows the action
+func inPhase(action phase.Action) bson.E {
+	return bson.E{"phase", bson.D{{"$in", phase.Stored(phase.AllowedPhases(action)...)}}}
+}
+
+// phaseConflict explains why an update guarded by inPhase matched nothing: it returns
+// the phase error if the session is in the wrong phase, and fallback otherwise.
+func (repo *SessionRepository) phaseConflict(ctx context.Context, code string, action phase.Action, fallback error) error {
+	session, err := repo.FindSessionByCode(ctx, code)
+	if err != nil {
+		return fallback
+	}
+	if err := phase.Check(session.Phase, action); err != nil {
+		return err
+	}
+	return fallback
+}
+
+// transition moves a session between phases along with any other updates, as long as
+// it is still in the from phase and matches where.
+func (repo *SessionRepository) transition(ctx context.Context, code string, from string, to string, where bson.D, set bson.D, push bson.D) error {
+	if err := phase.CheckTransition(from, to); err != nil {
+		return err
+	}
+
+	// The deadline depends only on the config, which is fixed once the lobby closes
+	session, err := repo.FindSessionByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{
+		{"code", bson.D{{"$eq", code}}},
+		{"phase", bson.D{{"$in", phase.Stored(from)}}},
+	}
+	filter = append(filter, where...)
+	now := time.Now()
+	set = append(bson.D{
+		{"phase", to},
+		{"deadline", session.Config.DeadlineFor(to, now)},
+		{"countdown", nil}, // whatever was counting down ended with the phase
+		{"updatedAt", now},
+	}, set...)
+	update := bson.D{{"$set", set}}
+	if len(push) > 0 {
+		update = append(update, bson.E{"$push", push})
+	}
+
+	result, err := repo.session.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: session has already moved on from %s", phase.ErrIllegalTransition, phase.Normalize(from))
+	}
+	return nil
+}
+
 func (repo *SessionRepository) CreateSession(ctx context.Context, session *models.Session) (err error) {
 	now := time.Now()
 	session.CreatedAt = now
 	session.UpdatedAt = now
 	session.Config.CreatedAt = now
 	session.Config.UpdatedAt = now
+	session.Deadline = session.Config.DeadlineFor(session.Phase, now)
 	for i := range session.Members {
 		session.Members[i].CreatedAt = now
 		session.Members[i].UpdatedAt = now
@@ -76,6 +148,10 @@ func (repo *SessionRepository) UpdateSessionConfig(ctx context.Context, code str
 		return nil, fmt.Errorf("failed to find session: %w", err)
 	}
 
+	if err := phase.Check(session.Phase, phase.UpdateConfig); err != nil {
+		return nil, err
+	}
+
 	oldConfig = &session.Config
 
 	currentTime := time.Now()
@@ -85,15 +161,17 @@ func (repo *SessionRepository) UpdateSessionConfig(ctx context.Context, code str
 	update := bson.D{
 		{"$set", bson.D{
 			{"config", newConfig},
+			{"deadline", newConfig.DeadlineFor(phase.Lobby, currentTime)},
 			{"updatedAt", currentTime},
 		}},
 	}
 
+	filter = append(filter, inPhase(phase.UpdateConfig))
 	result, err := repo.session.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return nil, err
 	} else if result.MatchedCount == 0 {
-		return nil, fmt.Errorf("failed to find session")
+		return nil, repo.phaseConflict(ctx, code, phase.UpdateConfig, fmt.Errorf("failed to find session"))
 	}
 
 	return oldConfig, nil
@@ -122,19 +200,10 @@ func (repo *SessionRepository) CloseSession(ctx context.Context, code string) (e
 	return nil
 }
 
-func (repo *SessionRepository) UpdateSessionPhase(ctx context.Context, code string, phase string) error {
-	filter := bson.D{{"code", bson.D{{"$eq", code}}}}
-	update := bson.D{{"$set", bson.D{
-		{"phase", phase},
-		{"updatedAt", time.Now()},
-	}}}
-	result, err := repo.session.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return err
-	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("session not found")
-	}
-	return nil
+// TransitionPhase moves a session from one phase to another, failing if the transition
+// is illegal or the session has already left the from phase.
+func (repo *SessionRepository) TransitionPhase(ctx context.Context, code string, from string, to string) error {
+	return repo.transition(ctx, code, from, to, nil, nil, nil)
 }
 
 func (repo *SessionRepository) SetPermalink(ctx context.Context, code string, permalink string) error {
@@ -162,19 +231,14 @@ func (repo *SessionRepository) FindSessionByPermalink(ctx context.Context, perma
 	return &session, nil
 }
 
-func (repo *SessionRepository) SaveFinalizedChoices(ctx context.Context, code string, choices []models.Choice) error {
-	filter := bson.D{{"code", bson.D{{"$eq", code}}}}
-	update := bson.D{{"$set", bson.D{
-		{"finalizedChoices", choices},
-		{"updatedAt", time.Now()},
-	}}}
-	result, err := repo.session.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return err
-	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("session not found")
+// FinalizeChoices saves the choices to vote on and moves the session on to voting on them
+func (repo *SessionRepository) FinalizeChoices(ctx context.Context, code string, choices []models.Choice) error {
+	if len(choices) == 0 {
+		return ErrNoChoices
 	}
-	return nil
+	return repo.transition(ctx, code, phase.Voting, phase.Results, nil, bson.D{
+		{"finalizedChoices", choices},
+	}, nil)
 }
 
 func (repo *SessionRepository) DeleteSession(ctx context.Context, code string) (err error) {
@@ -202,6 +266,52 @@ func (repo *SessionRepository) FindAllSessions(ctx context.Context) (sessions []
 	return sessions, nil
 }
 
+// FindScheduledSessions returns the open sessions the scheduler may need to act on:
+// async sessions, sessions whose deadline passed by now, and sessions untouched
+// since idleBefore
+func (repo *SessionRepository) FindScheduledSessions(ctx context.Context, now time.Time, idleBefore time.Time) (sessions []models.Session, err error) {
+	filter := bson.D{
+		{"closedAt", bson.D{{"$eq", time.Time{}}}},
+		{"$or", bson.A{
+			bson.D{{"config.async", bson.D{{"$eq", true}}}},
+			bson.D{{"deadline", bson.D{{"$gt", time.Time{}}, {"$lte", now}}}},
+			bson.D{{"updatedAt", bson.D{{"$lt", idleBefore}}}},
+		}},
+	}
+
+	cursor, err := repo.session.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// CloseIdleSession closes a session at now if it is still untouched since idleBefore
+// and has no deadline still to come. It reports whether the session was closed.
+func (repo *SessionRepository) CloseIdleSession(ctx context.Context, code string, idleBefore time.Time, now time.Time) (bool, error) {
+	filter := bson.D{
+		{"code", bson.D{{"$eq", code}}},
+		{"closedAt", bson.D{{"$eq", time.Time{}}}},
+		{"updatedAt", bson.D{{"$lt", idleBefore}}},
+		{"deadline", bson.D{{"$not", bson.D{{"$gt", now}}}}},
+	}
+	update := bson.D{{"$set", bson.D{
+		{"closedAt", now},
+		{"updatedAt", now},
+	}}}
+
+	result, err := repo.session.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
 func (repo *SessionRepository) FindActiveSessions(ctx context.Context) (activeSessions []models.Session, err error) {
 	filter := bson.D{{"closedAt", bson.D{{"$eq", time.Time{}}}}}
 
@@ -220,7 +330,7 @@ func (repo *SessionRepository) FindActiveSessions(ctx context.Context) (activeSe
 	return activeSessions, nil
 }
 
-func (repo *SessionRepository) TransferHost(ctx context.Context, code string, newHost string) error {
+func (repo *SessionRepository) TransferHost(ctx context.Context, code string, newHostID string) error {
 	filter := bson.D{{"code", bson.D{{"$eq", code}}}}
 	now := time.Now()
 
@@ -238,7 +348,7 @@ func (repo *SessionRepository) TransferHost(ctx context.Context, code string, ne
 	result, err := repo.session.UpdateOne(ctx,
 		bson.D{
 			{"code", bson.D{{"$eq", code}}},
-			{"members.name", bson.D{{"$eq", newHost}}},
+			{"members.id", bson.D{{"$eq", newHostID}}},
 		},
 		bson.D{
 			{"$set", bson.D{
@@ -257,14 +367,14 @@ func (repo *SessionRepository) TransferHost(ctx context.Context, code string, ne
 	return nil
 }
 
-func (repo *SessionRepository) RemoveMemberFromSession(ctx context.Context, code string, name string) error {
+func (repo *SessionRepository) RemoveMemberFromSession(ctx context.Context, code string, memberID string) error {
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
 	}
 
 	update := bson.D{
 		{"$pull", bson.D{
-			{"members", bson.D{{"name", name}}},
+			{"members", bson.D{{"id", memberID}}},
 		}},
 		{"$set", bson.D{
 			{"updatedAt", time.Now()},
@@ -288,6 +398,7 @@ func (repo *SessionRepository) AddMemberToSession(ctx context.Context, code stri
 
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
+		inPhase(phase.Join),
 	}
 
 	update := bson.D{
@@ -303,28 +414,35 @@ func (repo *SessionRepository) AddMemberToSession(ctx context.Context, code stri
 	if err != nil {
 		return err
 	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find session")
+		return repo.phaseConflict(ctx, code, phase.Join, fmt.Errorf("failed to find session"))
 	}
 
 	return nil
 }
 
-func (repo *SessionRepository) UpdateMember(ctx context.Context, code string, name string, newName string) (err error) {
+// UpdateMember renames a member, along with the name shown on the choices they proposed
+func (repo *SessionRepository) UpdateMember(ctx context.Context, code string, memberID string, newName string) (err error) {
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
-		{"members.name", bson.D{{"$eq", name}}},
+		{"members.id", bson.D{{"$eq", memberID}}},
 	}
 
 	currentTime := time.Now()
 	update := bson.D{
 		{"$set", bson.D{
-			{"members.$.name", newName},
-			{"members.$.updatedAt", currentTime},
+			{"members.$[member].name", newName},
+			{"members.$[member].updatedAt", currentTime},
+			{"choices.$[].proposers.$[proposer].memberName", newName},
 			{"updatedAt", currentTime},
 		}},
 	}
 
-	result, err := repo.session.UpdateOne(ctx, filter, update)
+	arrayFilters := []any{
+		bson.D{{"member.id", memberID}},
+		bson.D{{"proposer.memberID", memberID}},
+	}
+
+	result, err := repo.session.UpdateOne(ctx, filter, update, options.UpdateOne().SetArrayFilters(arrayFilters))
 	if err != nil {
 		return err
 	} else if result.MatchedCount == 0 {
@@ -334,10 +452,10 @@ func (repo *SessionRepository) UpdateMember(ctx context.Context, code string, na
 	return nil
 }
 
-func (repo *SessionRepository) SetMemberSubmitted(ctx context.Context, code string, name string, submitted bool) error {
+func (repo *SessionRepository) SetMemberSubmitted(ctx context.Context, code string, memberID string, submitted bool) error {
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
-		{"members.name", bson.D{{"$eq", name}}},
+		{"members.id", bson.D{{"$eq", memberID}}},
 	}
 	now := time.Now()
 	update := bson.D{{"$set", bson.D{
@@ -354,14 +472,15 @@ func (repo *SessionRepository) SetMemberSubmitted(ctx context.Context, code stri
 	return nil
 }
 
-func (repo *SessionRepository) SetMemberVoted(ctx context.Context, code string, name string, voted bool) error {
+// SetMemberReady sets a member's ready flag in the lobby
+func (repo *SessionRepository) SetMemberReady(ctx context.Context, code string, memberID string, ready bool) error {
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
-		{"members.name", bson.D{{"$eq", name}}},
+		{"members.id", bson.D{{"$eq", memberID}}},
 	}
 	now := time.Now()
 	update := bson.D{{"$set", bson.D{
-		{"members.$.voted", voted},
+		{"members.$.ready", ready},
 		{"members.$.updatedAt", now},
 		{"updatedAt", now},
 	}}}
@@ -374,6 +493,48 @@ func (repo *SessionRepository) SetMemberVoted(ctx context.Context, code string,
 	return nil
 }
 
+// SetCountdown saves the countdown under way in a session, or clears it when nil
+func (repo *SessionRepository) SetCountdown(ctx context.Context, code string, countdown *models.Countdown) error {
+	filter := bson.D{{"code", bson.D{{"$eq", code}}}}
+	update := bson.D{{"$set", bson.D{
+		{"countdown", countdown},
+		{"updatedAt", time.Now()},
+	}}}
+	result, err := repo.session.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// SetMemberVoted sets a member's voted flag. Clearing it also forgets the member's
+// ballot ID, so the same ballot can be submitted again.
+func (repo *SessionRepository) SetMemberVoted(ctx context.Context, code string, memberID string, voted bool) error {
+	filter := bson.D{
+		{"code", bson.D{{"$eq", code}}},
+		{"members.id", bson.D{{"$eq", memberID}}},
+	}
+	now := time.Now()
+	set := bson.D{
+		{"members.$.voted", voted},
+		{"members.$.updatedAt", now},
+		{"updatedAt", now},
+	}
+	if !voted {
+		set = append(set, bson.E{"members.$.ballotID", ""})
+	}
+	update := bson.D{{"$set", set}}
+	result, err := repo.session.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return fmt.Errorf("failed to find member")
+	}
+	return nil
+}
+
 func (repo *SessionRepository) FindMember(ctx context.Context, code string, name string) (member *models.Member, err error) {
 	session, err := repo.FindSessionByCode(ctx, code)
 	if err != nil {
@@ -389,6 +550,21 @@ func (repo *SessionRepository) FindMember(ctx context.Context, code string, name
 	return nil, fmt.Errorf("member not found")
 }
 
+func (repo *SessionRepository) FindMemberByID(ctx context.Context, code string, id string) (member *models.Member, err error) {
+	session, err := repo.FindSessionByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range session.Members {
+		if m.ID == id {
+			return &m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("member not found")
+}
+
 func (repo *SessionRepository) FindAllMembers(ctx context.Context, code string) (members []models.Member, err error) {
 	session, err := repo.FindSessionByCode(ctx, code)
 	if err != nil {
@@ -398,36 +574,145 @@ func (repo *SessionRepository) FindAllMembers(ctx context.Context, code string)
 	return session.Members, nil
 }
 
-func (repo *SessionRepository) AddChoice(ctx context.Context, code string, choice models.Choice) error {
+// belowChoiceLimit matches sessions where a member has proposed fewer than limit
+// choices, so a member racing their own adds can't go over it
+func belowChoiceLimit(memberID string, limit int) bson.E {
+	proposed := bson.D{{"$filter", bson.D{
+		{"input", "$choices"},
+		{"as", "choice"},
+		{"cond", bson.D{{"$in", bson.A{
+			memberID,
+			bson.D{{"$ifNull", bson.A{"$$choice.proposers.memberID", bson.A{}}}},
+		}}}},
+	}}}
+	return bson.E{"$expr", bson.D{{"$lt", bson.A{bson.D{{"$size", proposed}}, limit}}}}
+}
+
+// notSubmitted matches sessions where a member hasn't submitted their choices, which
+// stay as they were submitted until the member takes them back
+func notSubmitted(memberID string) bson.E {
+	return bson.E{"members", bson.D{{"$not", bson.D{{"$elemMatch", bson.D{
+		{"id", memberID},
+		{"submitted", true},
+	}}}}}}
+}
+
+// choiceConflict explains why a choice edit guarded by inPhase and notSubmitted
+// matched nothing, like phaseConflict
+func (repo *SessionRepository) choiceConflict(ctx context.Context, code string, memberID string, fallback error) error {
+	session, err := repo.FindSessionByCode(ctx, code)
+	if err != nil {
+		return fallback
+	}
+	if err := phase.Check(session.Phase, phase.EditChoices); err != nil {
+		return err
+	}
+	if session.HasSubmitted(memberID) {
+		return models.ErrSubmitted
+	}
+	return fallback
+}
+
+// AddChoice adds a choice proposed by a member. If another member already added the
+// same choice, the member joins its proposers instead. Either way it counts towards
+// the member's MaxChoices. It returns the choice as stored.
+func (repo *SessionRepository) AddChoice(ctx context.Context, code string, proposer models.Proposer, choice models.Choice) (*models.Choice, error) {
 	now := time.Now()
+	choice.ID = newChoiceID()
+	choice.Proposers = []models.Proposer{proposer}
+	choice.TitleKey = normalizeTitle(choice.Title)
+	choice.Votes = []models.Vote{}
 	choice.CreatedAt = now
 	choice.UpdatedAt = now
-	choice.Votes = []models.Vote{}
 
-	filter := bson.D{
-		{"code", bson.D{{"$eq", code}}},
-	}
+	// Another member may add the same choice between reading the session and writing
+	// to it, in which case the write matches nothing and we look again
+	for range MAX_CHOICE_WRITE_ATTEMPTS {
+		session, err := repo.FindSessionByCode(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		if err := phase.Check(session.Phase, phase.EditChoices); err != nil {
+			return nil, err
+		}
+		if session.HasSubmitted(proposer.MemberID) {
+			return nil, models.ErrSubmitted
+		}
+		limit := session.Config.MaxChoices
+
+		if existing := findDuplicate(session.Choices, &choice); existing != nil {
+			if existing.HasProposer(proposer.MemberID) {
+				return nil, ErrAlreadyProposed
+			}
+			if limit > 0 && session.ChoiceCount(proposer.MemberID) >= limit {
+				return nil, fmt.Errorf("%w: at most %d per member", models.ErrTooManyChoices, limit)
+			}
+
+			filter := bson.D{
+				{"code", bson.D{{"$eq", code}}},
+				inPhase(phase.EditChoices),
+				{"choices", bson.D{{"$elemMatch", bson.D{
+					{"id", existing.ID},
+					{"proposers.memberID", bson.D{{"$ne", proposer.MemberID}}},
+				}}}},
+				notSubmitted(proposer.MemberID),
+			}
+			if limit > 0 {
+				filter = append(filter, belowChoiceLimit(proposer.MemberID, limit))
+			}
+			update := bson.D{
+				{"$push", bson.D{
+					{"choices.$.proposers", proposer},
+				}},
+				{"$set", bson.D{
+					{"choices.$.updatedAt", now},
+					{"updatedAt", now},
+				}},
+			}
+
+			result, err := repo.session.UpdateOne(ctx, filter, update)
+			if err != nil {
+				return nil, err
+			} else if result.MatchedCount > 0 {
+				existing.Proposers = append(existing.Proposers, proposer)
+				return existing, nil
+			}
+			continue
+		}
 
-	update := bson.D{
-		{"$push", bson.D{
-			{"choices", choice},
-		}},
-		{"$set", bson.D{
-			{"updatedAt", now},
-		}},
-	}
+		if limit > 0 && session.ChoiceCount(proposer.MemberID) >= limit {
+			return nil, fmt.Errorf("%w: at most %d per member", models.ErrTooManyChoices, limit)
+		}
+		filter := bson.D{
+			{"code", bson.D{{"$eq", code}}},
+			inPhase(phase.EditChoices),
+			notSubmitted(proposer.MemberID),
+		}
+		filter = append(filter, noDuplicateOf(&choice)...)
+		if limit > 0 {
+			filter = append(filter, belowChoiceLimit(proposer.MemberID, limit))
+		}
+		update := bson.D{
+			{"$push", bson.D{
+				{"choices", choice},
+			}},
+			{"$set", bson.D{
+				{"updatedAt", now},
+			}},
+		}
 
-	result, err := repo.session.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return err
-	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find session")
+		result, err := repo.session.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return nil, err
+		} else if result.MatchedCount > 0 {
+			return &choice, nil
+		}
 	}
 
-	return nil
+	return nil, repo.choiceConflict(ctx, code, proposer.MemberID, fmt.Errorf("failed to add choice"))
 }
 
-func (repo *SessionRepository) FindChoicesByMemberName(ctx context.Context, code string, memberName string) ([]models.Choice, error) {
+func (repo *SessionRepository) FindChoicesByMemberID(ctx context.Context, code string, memberID string) ([]models.Choice, error) {
 	session, err := repo.FindSessionByCode(ctx, code)
 	if err != nil {
 		return nil, err
@@ -435,7 +720,7 @@ func (repo *SessionRepository) FindChoicesByMemberName(ctx context.Context, code
 
 	var choices []models.Choice
 	for _, c := range session.Choices {
-		if c.MemberName == memberName {
+		if c.HasProposer(memberID) {
 			choices = append(choices, c)
 		}
 	}
@@ -452,52 +737,113 @@ func (repo *SessionRepository) FindAllChoices(ctx context.Context, code string)
 	return session.Choices, nil
 }
 
-func (repo *SessionRepository) UpdateChoice(ctx context.Context, code string, memberName string, title string, newChoice *models.Choice) error {
-	filter := bson.D{
-		{"code", bson.D{{"$eq", code}}},
-		{"choices.memberName", bson.D{{"$eq", memberName}}},
-		{"choices.title", bson.D{{"$eq", title}}},
-	}
+// UpdateChoice edits a member's choice. A choice only the member proposed is edited in
+// place. If others proposed it too, or the edit makes it a duplicate of another choice,
+// the member withdraws from it and proposes the edited choice instead, which may merge
+// it into the other. It returns the choice as stored.
+func (repo *SessionRepository) UpdateChoice(ctx context.Context, code string, memberID string, choiceID string, newChoice *models.Choice) (*models.Choice, error) {
+	for range MAX_CHOICE_WRITE_ATTEMPTS {
+		session, err := repo.FindSessionByCode(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		if err := phase.Check(session.Phase, phase.EditChoices); err != nil {
+			return nil, err
+		}
+		if session.HasSubmitted(memberID) {
+			return nil, models.ErrSubmitted
+		}
 
-	now := time.Now()
-	update := bson.D{
-		{"$set", bson.D{
-			{"choices.$[choice].title", newChoice.Title},
-			{"choices.$[choice].integration", newChoice.Integration},
-			{"choices.$[choice].integrationID", newChoice.IntegrationID},
-			{"choices.$[choice].description", newChoice.Description},
-			{"choices.$[choice].updatedAt", now},
-			{"updatedAt", now},
-		}},
-	}
+		var current *models.Choice
+		for i := range session.Choices {
+			if session.Choices[i].ID == choiceID && session.Choices[i].HasProposer(memberID) {
+				current = &session.Choices[i]
+				break
+			}
+		}
+		if current == nil {
+			return nil, fmt.Errorf("failed to find choice")
+		}
 
-	arrayFilters := []any{
-		bson.D{
-			{"choice.memberName", memberName},
-			{"choice.title", title},
-		},
-	}
+		now := time.Now()
+		updated := *current
+		updated.Title = newChoice.Title
+		updated.TitleKey = normalizeTitle(newChoice.Title)
+		updated.Comment = newChoice.Comment
+		updated.Integration = newChoice.Integration
+		updated.IntegrationID = newChoice.IntegrationID
+		updated.Description = newChoice.Description
+		updated.UpdatedAt = now
+
+		if len(current.Proposers) > 1 || findDuplicate(session.Choices, &updated) != nil {
+			var proposer models.Proposer
+			for _, p := range current.Proposers {
+				if p.MemberID == memberID {
+					proposer = p
+				}
+			}
+			if err := repo.RemoveChoice(ctx, code, memberID, choiceID); err != nil {
+				return nil, err
+			}
+			return repo.AddChoice(ctx, code, proposer, *newChoice)
+		}
 
-	result, err := repo.session.UpdateOne(ctx, filter, update, options.UpdateOne().SetArrayFilters(arrayFilters))
-	if err != nil {
-		return err
-	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find choice")
+		filter := bson.D{
+			{"code", bson.D{{"$eq", code}}},
+			inPhase(phase.EditChoices),
+			{"$and", bson.A{
+				bson.D{{"choices", bson.D{{"$elemMatch", bson.D{
+					{"id", choiceID},
+					{"proposers", bson.D{{"$size", 1}}},
+					{"proposers.memberID", memberID},
+				}}}}},
+				noDuplicateOf(&updated),
+			}},
+			notSubmitted(memberID),
+		}
+		update := bson.D{
+			{"$set", bson.D{
+				{"choices.$[choice].title", updated.Title},
+				{"choices.$[choice].titleKey", updated.TitleKey},
+				{"choices.$[choice].comment", updated.Comment},
+				{"choices.$[choice].integration", updated.Integration},
+				{"choices.$[choice].integrationID", updated.IntegrationID},
+				{"choices.$[choice].description", updated.Description},
+				{"choices.$[choice].updatedAt", now},
+				{"updatedAt", now},
+			}},
+		}
+		arrayFilters := []any{
+			bson.D{{"choice.id", choiceID}},
+		}
+
+		result, err := repo.session.UpdateOne(ctx, filter, update, options.UpdateOne().SetArrayFilters(arrayFilters))
+		if err != nil {
+			return nil, err
+		} else if result.MatchedCount > 0 {
+			return &updated, nil
+		}
 	}
 
-	return nil
+	return nil, repo.choiceConflict(ctx, code, memberID, fmt.Errorf("failed to update choice"))
 }
 
-func (repo *SessionRepository) RemoveChoice(ctx context.Context, code string, memberName string, title string) error {
+// RemoveChoice withdraws a member from a choice, removing the choice once nobody proposes it
+func (repo *SessionRepository) RemoveChoice(ctx context.Context, code string, memberID string, choiceID string) error {
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
+		inPhase(phase.EditChoices),
+		{"choices", bson.D{{"$elemMatch", bson.D{
+			{"id", choiceID},
+			{"proposers.memberID", memberID},
+		}}}},
+		notSubmitted(memberID),
 	}
 
 	update := bson.D{
 		{"$pull", bson.D{
-			{"choices", bson.D{
-				{"memberName", memberName},
-				{"title", title},
+			{"choices.$.proposers", bson.D{
+				{"memberID", memberID},
 			}},
 		}},
 		{"$set", bson.D{
@@ -509,21 +855,24 @@ func (repo *SessionRepository) RemoveChoice(ctx context.Context, code string, me
 	if err != nil {
 		return err
 	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find session")
+		return repo.choiceConflict(ctx, code, memberID, fmt.Errorf("failed to find choice"))
 	}
 
-	return nil
+	return repo.pruneChoices(ctx, code)
 }
 
-func (repo *SessionRepository) RemoveAllChoicesByMemberName(ctx context.Context, code string, memberName string) error {
+// RemoveAllChoicesByMemberID withdraws a member from every choice they proposed
+func (repo *SessionRepository) RemoveAllChoicesByMemberID(ctx context.Context, code string, memberID string) error {
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
+		inPhase(phase.EditChoices),
+		notSubmitted(memberID),
 	}
 
 	update := bson.D{
 		{"$pull", bson.D{
-			{"choices", bson.D{
-				{"memberName", memberName},
+			{"choices.$[].proposers", bson.D{
+				{"memberID", memberID},
 			}},
 		}},
 		{"$set", bson.D{
@@ -535,134 +884,261 @@ func (repo *SessionRepository) RemoveAllChoicesByMemberName(ctx context.Context,
 	if err != nil {
 		return err
 	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find session")
+		return repo.choiceConflict(ctx, code, memberID, fmt.Errorf("failed to find session"))
 	}
 
-	return nil
+	return repo.pruneChoices(ctx, code)
 }
 
-func (repo *SessionRepository) SaveRankedChoices(ctx context.Context, code string, choices []models.Choice) error {
+// pruneChoices removes choices nobody proposes any more
+func (repo *SessionRepository) pruneChoices(ctx context.Context, code string) error {
 	filter := bson.D{{"code", bson.D{{"$eq", code}}}}
-	update := bson.D{{"$set", bson.D{
+	update := bson.D{
+		{"$pull", bson.D{
+			{"choices", bson.D{
+				{"proposers", bson.D{{"$size", 0}}},
+			}},
+		}},
+	}
+
+	_, err := repo.session.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// SaveRankedChoices saves the final ranking and tally, moving the session from the
+// voting round it was tallied in to final. Only one tally of the round is saved.
+func (repo *SessionRepository) SaveRankedChoices(ctx context.Context, code string, from string, round int, choices []models.Choice, tallyResult *tally.Result) error {
+	return repo.transition(ctx, code, from, phase.Final, bson.D{
+		{"round", bson.D{{"$eq", round}}},
+	}, bson.D{
 		{"rankedChoices", choices},
+		{"tally", tallyResult},
+	}, nil)
+}
+
+// StartRunoff archives the completed round and opens the next one on the finalists,
+// clearing every member's voted flag. Only one runoff follows the completed round.
+func (repo *SessionRepository) StartRunoff(ctx context.Context, code string, from string, completed models.VotingRound, finalists []models.Choice) error {
+	return repo.transition(ctx, code, from, phase.Runoff, bson.D{
+		{"round", bson.D{{"$eq", completed.Number}}},
+	}, bson.D{
+		{"round", completed.Number + 1},
+		{"finalizedChoices", finalists},
+		{"members.$[].voted", false},
+		{"members.$[].ballotID", ""},
+	}, bson.D{
+		{"rounds", completed},
+	})
+}
+
+// SetPendingTie records tied choices the host needs to order, so they can be asked
+// again when they next connect
+func (repo *SessionRepository) SetPendingTie(ctx context.Context, code string, pending []string) error {
+	filter := bson.D{
+		{"code", bson.D{{"$eq", code}}},
+		inPhase(phase.ResolveTie),
+	}
+	update := bson.D{{"$set", bson.D{
+		{"pendingTie", pending},
 		{"updatedAt", time.Now()},
 	}}}
 	result, err := repo.session.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("session not found")
+		return repo.phaseConflict(ctx, code, phase.ResolveTie, fmt.Errorf("session not found"))
 	}
 	return nil
 }
 
-// Vote operations
-
-func (repo *SessionRepository) AddVote(ctx context.Context, code string, choiceTitle string, vote models.Vote) error {
-	now := time.Now()
-	vote.CreatedAt = now
-	vote.UpdatedAt = now
-
+// SetTieOrder saves the host's order for the pending tie, as long as it is still the
+// tie waiting on them, so only one order is ever taken for it
+func (repo *SessionRepository) SetTieOrder(ctx context.Context, code string, order []string) error {
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
-		{"choices.title", bson.D{{"$eq", choiceTitle}}},
+		inPhase(phase.ResolveTie),
+		{"pendingTie", bson.D{{"$all", order}, {"$size", len(order)}}},
 	}
-
 	update := bson.D{
-		{"$push", bson.D{
-			{"choices.$[choice].votes", vote},
-		}},
 		{"$set", bson.D{
-			{"choices.$[choice].updatedAt", now},
-			{"updatedAt", now},
+			{"tieOrder", order},
+			{"updatedAt", time.Now()},
+		}},
+		{"$unset", bson.D{
+			{"pendingTie", ""},
 		}},
 	}
-
-	arrayFilters := []any{
-		bson.D{
-			{"choice.title", choiceTitle},
-		},
-	}
-
-	result, err := repo.session.UpdateOne(ctx, filter, update, options.UpdateOne().SetArrayFilters(arrayFilters))
+	result, err := repo.session.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find choice")
+		return repo.phaseConflict(ctx, code, phase.ResolveTie, ErrNoTiePending)
 	}
-
 	return nil
 }
 
-func (repo *SessionRepository) UpdateVote(ctx context.Context, code string, choiceTitle string, memberName string, newValue int) error {
+// Vote operations
+
+// SubmitBallot swaps a member's votes in a round for a new ballot, keyed by choice
+// ID, and marks the member voted, all in one write so a crash can't leave half a
+// ballot behind. Ballot IDs come from the client: resubmitting the member's latest
+// ballot changes nothing and returns true. It fails with ErrRoundOver if the session
+// has moved on from the round.
+func (repo *SessionRepository) SubmitBallot(ctx context.Context, code string, memberID string, ballotID string, round int, ballot map[string]int) (replayed bool, err error) {
 	now := time.Now()
 
-	filter := bson.D{
-		{"code", bson.D{{"$eq", code}}},
-		{"choices.title", bson.D{{"$eq", choiceTitle}}},
-		{"choices.votes.memberName", bson.D{{"$eq", memberName}}},
+	type entry struct {
+		ChoiceID string      `bson:"choiceID"`
+		Vote     models.Vote `bson:"vote"`
 	}
-
-	update := bson.D{
-		{"$set", bson.D{
-			{"choices.$[choice].votes.$[vote].value", newValue},
-			{"choices.$[choice].votes.$[vote].updatedAt", now},
-			{"choices.$[choice].updatedAt", now},
-			{"updatedAt", now},
-		}},
+	entries := bson.A{}
+	for choiceID, value := range ballot {
+		entries = append(entries, entry{choiceID, models.Vote{
+			MemberID:  memberID,
+			Value:     value,
+			Round:     round,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}})
 	}
 
-	arrayFilters := []any{
-		bson.D{
-			{"choice.title", choiceTitle},
-		},
-		bson.D{
-			{"vote.memberName", memberName},
-		},
-	}
+	filter := bson.D{
+		{"code", bson.D{{"$eq", code}}},
+		{"round", bson.D{{"$eq", round}}},
+		{"members", bson.D{{"$elemMatch", bson.D{
+			{"id", memberID},
+			{"ballotID", bson.D{{"$ne", ballotID}}},
+		}}}},
+		inPhase(phase.SubmitVotes),
+	}
+
+	// For each choice, drop the member's votes from this round and add the new one
+	kept := bson.D{{"$filter", bson.D{
+		{"input", bson.D{{"$ifNull", bson.A{"$$choice.votes", bson.A{}}}}},
+		{"as", "vote"},
+		{"cond", bson.D{{"$not", bson.A{bson.D{{"$and", bson.A{
+			bson.D{{"$eq", bson.A{"$$vote.memberID", memberID}}},
+			bson.D{{"$eq", bson.A{"$$vote.round", round}}},
+		}}}}}}},
+	}}}
+	added := bson.D{{"$map", bson.D{
+		{"input", bson.D{{"$filter", bson.D{
+			{"input", bson.D{{"$literal", entries}}},
+			{"as", "entry"},
+			{"cond", bson.D{{"$eq", bson.A{"$$entry.choiceID", "$$choice.id"}}}},
+		}}}},
+		{"as", "entry"},
+		{"in", "$$entry.vote"},
+	}}}
+	update := bson.A{bson.D{{"$set", bson.D{
+		{"choices", bson.D{{"$map", bson.D{
+			{"input", "$choices"},
+			{"as", "choice"},
+			{"in", bson.D{{"$mergeObjects", bson.A{
+				"$$choice",
+				bson.D{{"votes", bson.D{{"$concatArrays", bson.A{kept, added}}}}},
+			}}}},
+		}}}},
+		{"members", bson.D{{"$map", bson.D{
+			{"input", "$members"},
+			{"as", "member"},
+			{"in", bson.D{{"$cond", bson.A{
+				bson.D{{"$eq", bson.A{"$$member.id", memberID}}},
+				bson.D{{"$mergeObjects", bson.A{"$$member", bson.D{
+					{"voted", true},
+					{"ballotID", bson.D{{"$literal", ballotID}}},
+					{"updatedAt", now},
+				}}}},
+				"$$member",
+			}}}},
+		}}}},
+		{"updatedAt", now},
+	}}}}
 
-	result, err := repo.session.UpdateOne(ctx, filter, update, options.UpdateOne().SetArrayFilters(arrayFilters))
+	result, err := repo.session.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return err
-	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find vote")
+		return false, err
+	} else if result.MatchedCount > 0 {
+		return false, nil
 	}
 
-	return nil
+	member, err := repo.FindMemberByID(ctx, code, memberID)
+	if err == nil && member.BallotID == ballotID {
+		return true, nil
+	}
+	return false, repo.phaseConflict(ctx, code, phase.SubmitVotes, ErrRoundOver)
 }
 
-func (repo *SessionRepository) RemoveVote(ctx context.Context, code string, choiceTitle string, memberName string) error {
+// CastVote sets a member's vote on one choice in a round, or takes it back when
+// value is nil, for voting a card at a time. Taking a vote back also takes back the
+// member being done voting. It returns the session as updated, and fails with
+// ErrRoundOver if the session has moved on from the round.
+func (repo *SessionRepository) CastVote(ctx context.Context, code string, memberID string, round int, choiceID string, value *int) (*models.Session, error) {
 	now := time.Now()
 
 	filter := bson.D{
 		{"code", bson.D{{"$eq", code}}},
-		{"choices.title", bson.D{{"$eq", choiceTitle}}},
-	}
-
-	update := bson.D{
-		{"$pull", bson.D{
-			{"choices.$[choice].votes", bson.D{
-				{"memberName", memberName},
-			}},
-		}},
-		{"$set", bson.D{
-			{"choices.$[choice].updatedAt", now},
-			{"updatedAt", now},
-		}},
-	}
-
-	arrayFilters := []any{
-		bson.D{
-			{"choice.title", choiceTitle},
-		},
-	}
+		{"round", bson.D{{"$eq", round}}},
+		{"members.id", bson.D{{"$eq", memberID}}},
+		{"finalizedChoices.id", bson.D{{"$eq", choiceID}}},
+		inPhase(phase.SubmitVotes),
+	}
+
+	// Drop the member's vote on the choice from this round, and add the new one
+	votes := bson.D{{"$filter", bson.D{
+		{"input", bson.D{{"$ifNull", bson.A{"$$choice.votes", bson.A{}}}}},
+		{"as", "vote"},
+		{"cond", bson.D{{"$not", bson.A{bson.D{{"$and", bson.A{
+			bson.D{{"$eq", bson.A{"$$vote.memberID", memberID}}},
+			bson.D{{"$eq", bson.A{"$$vote.round", round}}},
+		}}}}}}},
+	}}}
+	if value != nil {
+		votes = bson.D{{"$concatArrays", bson.A{votes, bson.A{bson.D{{"$literal", models.Vote{
+			MemberID:  memberID,
+			Value:     *value,
+			Round:     round,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}}}}}}}
+	}
+
+	// A ballot sent afterwards is never a replay of one from before
+	member := bson.D{{"ballotID", ""}, {"updatedAt", now}}
+	if value == nil {
+		member = append(member, bson.E{"voted", false})
+	}
+
+	update := bson.A{bson.D{{"$set", bson.D{
+		{"choices", bson.D{{"$map", bson.D{
+			{"input", "$choices"},
+			{"as", "choice"},
+			{"in", bson.D{{"$cond", bson.A{
+				bson.D{{"$eq", bson.A{"$$choice.id", choiceID}}},
+				bson.D{{"$mergeObjects", bson.A{"$$choice", bson.D{
+					{"votes", votes},
+					{"updatedAt", now},
+				}}}},
+				"$$choice",
+			}}}},
+		}}}},
+		{"members", bson.D{{"$map", bson.D{
+			{"input", "$members"},
+			{"as", "member"},
+			{"in", bson.D{{"$cond", bson.A{
+				bson.D{{"$eq", bson.A{"$$member.id", memberID}}},
+				bson.D{{"$mergeObjects", bson.A{"$$member", member}}},
+				"$$member",
+			}}}},
+		}}}},
+		{"updatedAt", now},
+	}}}}
 
-	result, err := repo.session.UpdateOne(ctx, filter, update, options.UpdateOne().SetArrayFilters(arrayFilters))
+	result, err := repo.session.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return err
+		return nil, err
 	} else if result.MatchedCount == 0 {
-		return fmt.Errorf("failed to find choice")
+		return nil, repo.phaseConflict(ctx, code, phase.SubmitVotes, ErrRoundOver)
 	}
-
-	return nil
+	return repo.FindSessionByCode(ctx, code)
 }
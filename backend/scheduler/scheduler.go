@@ -0,0 +1,232 @@
+// Package scheduler does the session housekeeping nobody is connected to trigger: it
+// ends phases whose deadline passed, moves async sessions on once their members are
+// done, and closes sessions left idle. Members of an async session take part over
+// hours or days and may never be connected at the same time, so the scheduler goes
+// by persisted member flags rather than the hub's view of who is connected.
+package scheduler
+
+import (
+	"consensus/models"
+	"consensus/phase"
+	"context"
+	crand "crypto/rand"
+	"log"
+	"os"
+	"time"
+)
+
+// Name of the lease that picks which backend replica runs the scheduler
+const LEASE_NAME = "scheduler"
+
+// Longest the scheduler waits before trying again to end a phase that didn't end
+const MAX_RETRY_BACKOFF = time.Hour
+
+// Sessions is the session storage the scheduler works from
+type Sessions interface {
+	FindScheduledSessions(ctx context.Context, now time.Time, idleBefore time.Time) ([]models.Session, error)
+	CloseIdleSession(ctx context.Context, code string, idleBefore time.Time, now time.Time) (bool, error)
+}
+
+// Leases keeps the scheduler to one replica at a time
+type Leases interface {
+	Acquire(ctx context.Context, name string, holder string, now time.Time, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, name string, holder string) error
+}
+
+type Scheduler struct {
+	sessions      Sessions
+	leases        Leases
+	holder        string // identifies this replica to the lease
+	interval      time.Duration
+	idleTTL       time.Duration            // zero to never close idle sessions
+	Now           func() time.Time         // replaced in tests
+	OnLobbyDone   func(sessionCode string) // start adding choices
+	OnChoicesDone func(sessionCode string) // finalize the choices and start voting
+	OnVotingDone  func(sessionCode string) // tally the round
+	OnIdleClosed  func(sessionCode string) // tell anyone still connected
+	attempts      map[string]attempt       // sessionCode → last try at ending its phase, while it hasn't moved on
+}
+
+// attempt is a try at ending a session's phase. Until the session moves on from the
+// phase, round and deadline it was in, the phase didn't end and is tried again later.
+type attempt struct {
+	phase    string
+	round    int
+	deadline time.Time
+	tries    int
+	wait     time.Duration // before trying again, doubled each try
+	next     time.Time     // when to try again
+}
+
+func New(sessions Sessions, leases Leases, interval time.Duration, idleTTL time.Duration) *Scheduler {
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		sessions: sessions,
+		leases:   leases,
+		holder:   hostname + "-" + crand.Text(),
+		interval: interval,
+		idleTTL:  idleTTL,
+		Now:      time.Now,
+		attempts: make(map[string]attempt),
+	}
+}
+
+// Run checks sessions every interval until ctx is done, while this replica holds the
+// lease
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Let another replica take over without waiting out the lease
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := s.leases.Release(releaseCtx, LEASE_NAME, s.holder); err != nil {
+				log.Printf("scheduler: failed to release lease: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	now := s.Now()
+
+	// Outlives a few missed ticks, so a replica that stops is replaced soon after.
+	// Everything done below is compare-and-set, so a tick overrunning the lease
+	// can't move a session on twice.
+	held, err := s.leases.Acquire(ctx, LEASE_NAME, s.holder, now, 3*s.interval)
+	if err != nil {
+		log.Printf("scheduler: failed to acquire lease: %v", err)
+		return
+	} else if !held {
+		return
+	}
+
+	idleBefore := now.Add(-s.idleTTL)
+	if s.idleTTL <= 0 {
+		idleBefore = time.Time{}
+	}
+	sessions, err := s.sessions.FindScheduledSessions(ctx, now, idleBefore)
+	if err != nil {
+		log.Printf("scheduler: failed to fetch sessions: %v", err)
+		return
+	}
+
+	due := make(map[string]bool)
+	for i := range sessions {
+		session := &sessions[i]
+		if Due(session, now) {
+			due[session.Code] = true
+			s.endPhase(session, now)
+		} else if Idle(session, now, s.idleTTL) {
+			s.closeIdle(ctx, session.Code, idleBefore, now)
+		}
+	}
+	for code := range s.attempts {
+		if !due[code] {
+			delete(s.attempts, code) // moved on, or closed
+		}
+	}
+}
+
+// endPhase ends a due session's phase. If an earlier try left the session where it
+// was, it waits twice as long as last time before trying again.
+func (s *Scheduler) endPhase(session *models.Session, now time.Time) {
+	var done func(string)
+	p := phase.Normalize(session.Phase)
+	switch p {
+	case phase.Lobby:
+		done = s.OnLobbyDone
+	case phase.Voting:
+		done = s.OnChoicesDone
+	case phase.Results, phase.Runoff:
+		done = s.OnVotingDone
+	}
+	if done == nil {
+		return
+	}
+
+	a, tried := s.attempts[session.Code]
+	if tried && a.phase == p && a.round == session.Round && a.deadline.Equal(session.Deadline) {
+		if now.Before(a.next) {
+			return
+		}
+		a.tries++
+		a.wait = min(2*a.wait, MAX_RETRY_BACKOFF)
+		log.Printf("scheduler: %s for session %s didn't end, trying again (%d)", p, session.Code, a.tries)
+	} else {
+		a = attempt{phase: p, round: session.Round, deadline: session.Deadline, wait: s.interval}
+		log.Printf("scheduler: ending %s for session %s", p, session.Code)
+	}
+	a.next = now.Add(a.wait)
+	s.attempts[session.Code] = a
+	done(session.Code)
+}
+
+func (s *Scheduler) closeIdle(ctx context.Context, code string, idleBefore time.Time, now time.Time) {
+	closed, err := s.sessions.CloseIdleSession(ctx, code, idleBefore, now)
+	if err != nil {
+		log.Printf("scheduler: failed to close idle session %s: %v", code, err)
+		return
+	} else if !closed {
+		return // touched since it was fetched
+	}
+
+	log.Printf("scheduler: closed idle session %s", code)
+	if s.OnIdleClosed != nil {
+		s.OnIdleClosed(code)
+	}
+}
+
+// Due reports whether a session's current phase should end at now, because its
+// deadline has passed or, in an async session, every member who can take part is
+// done. An async lobby only ends at its deadline, or when the host starts the
+// session, and nothing moves on while a tie waits on the host.
+func Due(s *models.Session, now time.Time) bool {
+	if !s.ClosedAt.IsZero() || len(s.PendingTie) > 0 {
+		return false
+	}
+	if !s.Deadline.IsZero() && !now.Before(s.Deadline) {
+		return true
+	}
+	if !s.Config.Async {
+		return false // live sessions move on through the hub
+	}
+
+	switch phase.Normalize(s.Phase) {
+	case phase.Voting:
+		for _, m := range s.Members {
+			if !m.Submitted {
+				return false
+			}
+		}
+		return len(s.Members) > 0
+	case phase.Results, phase.Runoff:
+		voters := 0
+		for _, m := range s.Members {
+			if !s.CanVote(m.ID) {
+				continue // can't vote, so isn't waited on
+			}
+			if !m.Voted {
+				return false
+			}
+			voters++
+		}
+		return voters > 0
+	}
+	return false
+}
+
+// Idle reports whether an open session has gone untouched for ttl at now. A session
+// with a deadline still to come is waiting on it, so isn't idle.
+func Idle(s *models.Session, now time.Time, ttl time.Duration) bool {
+	if ttl <= 0 || !s.ClosedAt.IsZero() || s.Deadline.After(now) {
+		return false
+	}
+	return now.Sub(s.UpdatedAt) >= ttl
+}
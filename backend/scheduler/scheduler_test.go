@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"consensus/models"
+	"consensus/phase"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func asyncSession(p string, members ...models.Member) *models.Session {
+	return &models.Session{
+		Phase:   p,
+		Members: members,
+		Config:  models.SessionConfig{Async: true},
+		Choices: []models.Choice{{ID: "c1", Proposers: []models.Proposer{{MemberID: "a"}}}},
+	}
+}
+
+func TestDueOnDeadline(t *testing.T) {
+	now := time.Now()
+	s := asyncSession(phase.Lobby, models.Member{ID: "a"})
+	if Due(s, now) {
+		t.Error("lobby without a deadline should wait for the host")
+	}
+
+	s.Deadline = now.Add(time.Minute)
+	if Due(s, now) {
+		t.Error("deadline hasn't passed yet")
+	}
+	if !Due(s, now.Add(time.Minute)) {
+		t.Error("expected due once the deadline is reached")
+	}
+
+	s.Config.Async = false
+	if !Due(s, now.Add(time.Hour)) {
+		t.Error("expected live sessions due at their deadline too")
+	}
+}
+
+func TestDueWhenEveryoneSubmitted(t *testing.T) {
+	now := time.Now()
+	s := asyncSession(phase.Voting, models.Member{ID: "a", Submitted: true}, models.Member{ID: "b"})
+	if Due(s, now) {
+		t.Error("b hasn't submitted")
+	}
+	s.Members[1].Submitted = true
+	if !Due(s, now) {
+		t.Error("expected due once everyone submitted")
+	}
+
+	s.Config.Async = false
+	if Due(s, now) {
+		t.Error("live sessions move on through the hub, not the scheduler")
+	}
+}
+
+func TestDueWhenEveryVoterVoted(t *testing.T) {
+	now := time.Now()
+	// b proposed nothing, so can't vote unless empty voters are allowed
+	s := asyncSession(phase.Results, models.Member{ID: "a", Voted: true}, models.Member{ID: "b"})
+	if !Due(s, now) {
+		t.Error("expected due without waiting on b")
+	}
+
+	s.Config.AllowEmptyVoters = true
+	if Due(s, now) {
+		t.Error("b can vote, so should be waited on")
+	}
+
+	s.Config.AllowEmptyVoters = false
+	s.PendingTie = []string{"c1", "c2"}
+	if Due(s, now) {
+		t.Error("a tie waiting on the host holds the session")
+	}
+}
+
+func TestIdle(t *testing.T) {
+	now := time.Now()
+	s := asyncSession(phase.Voting)
+	s.UpdatedAt = now.Add(-2 * time.Hour)
+
+	if !Idle(s, now, time.Hour) {
+		t.Error("expected idle after the ttl")
+	}
+	if Idle(s, now, 0) {
+		t.Error("a zero ttl never closes sessions")
+	}
+	s.Deadline = now.Add(time.Minute)
+	if Idle(s, now, time.Hour) {
+		t.Error("a session waiting on its deadline isn't idle")
+	}
+}
+
+type fakeSessions struct {
+	sessions []models.Session
+	closed   []string
+}
+
+func (f *fakeSessions) FindScheduledSessions(ctx context.Context, now time.Time, idleBefore time.Time) ([]models.Session, error) {
+	return f.sessions, nil
+}
+
+func (f *fakeSessions) CloseIdleSession(ctx context.Context, code string, idleBefore time.Time, now time.Time) (bool, error) {
+	f.closed = append(f.closed, code)
+	return true, nil
+}
+
+// fakeLeases holds one lease in memory, the way the lease collection does
+type fakeLeases struct {
+	holder    string
+	expiresAt time.Time
+}
+
+func (f *fakeLeases) Acquire(ctx context.Context, name string, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	if f.holder != holder && now.Before(f.expiresAt) {
+		return false, nil
+	}
+	f.holder, f.expiresAt = holder, now.Add(ttl)
+	return true, nil
+}
+
+func (f *fakeLeases) Release(ctx context.Context, name string, holder string) error {
+	if f.holder == holder {
+		f.holder, f.expiresAt = "", time.Time{}
+	}
+	return nil
+}
+
+func TestTick(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	deadlinePassed := asyncSession(phase.Results)
+	deadlinePassed.Code = "due"
+	deadlinePassed.Config.Async = false
+	deadlinePassed.Deadline = now.Add(-time.Second)
+	deadlinePassed.UpdatedAt = now.Add(-48 * time.Hour)
+
+	idle := asyncSession(phase.Lobby)
+	idle.Code = "idle"
+	idle.UpdatedAt = now.Add(-48 * time.Hour)
+
+	waiting := asyncSession(phase.Lobby)
+	waiting.Code = "waiting"
+	waiting.UpdatedAt = now.Add(-time.Minute)
+
+	sessions := &fakeSessions{sessions: []models.Session{*deadlinePassed, *idle, *waiting}}
+	leases := &fakeLeases{}
+	s := New(sessions, leases, time.Second, 24*time.Hour)
+	s.Now = func() time.Time { return now }
+
+	var ended, closed []string
+	s.OnVotingDone = func(code string) { ended = append(ended, code) }
+	s.OnLobbyDone = func(code string) { ended = append(ended, code) }
+	s.OnIdleClosed = func(code string) { closed = append(closed, code) }
+
+	s.tick(context.Background())
+	if !slices.Equal(ended, []string{"due"}) {
+		t.Errorf("expected only the session past its deadline ended, got %v", ended)
+	}
+	if !slices.Equal(closed, []string{"idle"}) || !slices.Equal(sessions.closed, []string{"idle"}) {
+		t.Errorf("expected only the idle session closed, got %v", closed)
+	}
+
+	// Another replica does nothing while the lease is held
+	other := New(sessions, leases, time.Second, 24*time.Hour)
+	other.Now = s.Now
+	other.OnVotingDone = func(code string) { t.Errorf("unexpected tick on a second replica for %s", code) }
+	other.tick(context.Background())
+
+	// ...and takes over once it runs out
+	taken := false
+	other.Now = func() time.Time { return now.Add(time.Minute) }
+	other.OnVotingDone = func(code string) { taken = true }
+	other.tick(context.Background())
+	if !taken {
+		t.Error("expected the second replica to take over an expired lease")
+	}
+}
+
+func TestTickBacksOffEndsThatFail(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	stuck := asyncSession(phase.Results)
+	stuck.Code = "stuck"
+	stuck.Deadline = start.Add(-time.Second)
+	stuck.UpdatedAt = start
+
+	sessions := &fakeSessions{sessions: []models.Session{*stuck}}
+	s := New(sessions, &fakeLeases{}, time.Second, 24*time.Hour)
+	var tries []time.Duration
+	var now time.Time
+	s.OnVotingDone = func(code string) { tries = append(tries, now.Sub(start)) } // and the session stays put
+	s.Now = func() time.Time { return now }
+
+	for tick := range 8 {
+		now = start.Add(time.Duration(tick) * time.Second)
+		s.tick(context.Background())
+	}
+	if want := []time.Duration{0, time.Second, 3 * time.Second, 7 * time.Second}; !slices.Equal(tries, want) {
+		t.Errorf("expected tries at %v, got %v", want, tries)
+	}
+
+	// Moving on to a runoff is a new phase to end, tried straight away
+	sessions.sessions[0].Phase = phase.Runoff
+	sessions.sessions[0].Round = 1
+	tries = nil
+	s.tick(context.Background())
+	if len(tries) != 1 {
+		t.Errorf("expected the runoff ended straight away, got %v", tries)
+	}
+}
@@ -0,0 +1,25 @@
+package tally
+
+// Approval counts one point for every yes (value 1) a candidate receives.
+type Approval struct{}
+
+func (Approval) Name() string { return "approval" }
+
+func (Approval) Tally(candidates []string, ballots []Ballot) Result {
+	scores := make(map[string]int, len(candidates))
+	for _, b := range ballots {
+		for _, c := range candidates {
+			if b.Values[c] == 1 {
+				scores[c]++
+			}
+		}
+	}
+
+	result := Result{
+		Method:  "approval",
+		Ranking: rankByScore(candidates, scores),
+		Rounds:  []Round{{Number: 1, Scores: scores}},
+	}
+	result.recordTies()
+	return result
+}
@@ -0,0 +1,19 @@
+package tally
+
+import "testing"
+
+func TestApproval(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "alice", Values: map[string]int{"A": 1, "B": 1, "C": 0}},
+		{Voter: "bob", Values: map[string]int{"A": 0, "B": 1, "C": 0}},
+		{Voter: "carol", Values: map[string]int{"A": 1, "B": 1}},
+	}
+
+	result := Approval{}.Tally([]string{"A", "B", "C"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "B", Score: 3, Place: 1},
+		Standing{Candidate: "A", Score: 2, Place: 2},
+		Standing{Candidate: "C", Score: 0, Place: 3},
+	)
+}
@@ -0,0 +1,89 @@
+package tally
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Entry is one vote on a submitted ballot
+type Entry struct {
+	Candidate string
+	Value     int
+}
+
+// Fields of an entry a BallotError can point at
+const (
+	FieldCandidate = "candidate"
+	FieldValue     = "value"
+)
+
+// BallotError is a problem with one entry of a submitted ballot, or with the
+// ballot as a whole when Entry is -1.
+type BallotError struct {
+	Entry   int
+	Field   string
+	Message string
+}
+
+func (e BallotError) Error() string {
+	if e.Entry < 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("entry %d %s: %s", e.Entry, e.Field, e.Message)
+}
+
+// IsRanked reports whether ballots in a voting mode rank the candidates
+func IsRanked(mode string) bool {
+	return mode == ModeRankedChoice || mode == ModeInstantRunoff || mode == ModeCondorcet
+}
+
+// ValidateBallot checks that a ballot has exactly one vote on every candidate, and
+// that the values suit the voting mode: a permutation of ranks 1..n for ranked
+// modes, 0 or 1 for yes_no, and 0..MaxScore for score and STAR.
+func ValidateBallot(mode string, candidates []string, entries []Entry) []BallotError {
+	var errs []BallotError
+	if _, err := ForMode(mode); err != nil {
+		return []BallotError{{Entry: -1, Message: err.Error()}}
+	}
+
+	seen := make(map[string]bool, len(entries))
+	ranks := make(map[int]bool, len(entries))
+	for i, e := range entries {
+		switch {
+		case !slices.Contains(candidates, e.Candidate):
+			errs = append(errs, BallotError{i, FieldCandidate, "not a choice in this round"})
+		case seen[e.Candidate]:
+			errs = append(errs, BallotError{i, FieldCandidate, "voted on more than once"})
+		}
+		seen[e.Candidate] = true
+
+		switch {
+		case IsRanked(mode):
+			if e.Value < 1 || e.Value > len(candidates) {
+				errs = append(errs, BallotError{i, FieldValue, fmt.Sprintf("rank must be between 1 and %d", len(candidates))})
+			} else if ranks[e.Value] {
+				errs = append(errs, BallotError{i, FieldValue, fmt.Sprintf("rank %d given to more than one choice", e.Value)})
+			}
+			ranks[e.Value] = true
+		case mode == ModeYesNo:
+			if e.Value != 0 && e.Value != 1 {
+				errs = append(errs, BallotError{i, FieldValue, "must be 0 or 1"})
+			}
+		default:
+			if e.Value < 0 || e.Value > MaxScore {
+				errs = append(errs, BallotError{i, FieldValue, fmt.Sprintf("score must be between 0 and %d", MaxScore)})
+			}
+		}
+	}
+
+	var unvoted int
+	for _, c := range candidates {
+		if !seen[c] {
+			unvoted++
+		}
+	}
+	if unvoted > 0 {
+		errs = append(errs, BallotError{-1, "", fmt.Sprintf("missing votes on %d of %d choices", unvoted, len(candidates))})
+	}
+	return errs
+}
@@ -0,0 +1,49 @@
+package tally
+
+import "testing"
+
+func TestValidateBallot(t *testing.T) {
+	candidates := []string{"A", "B", "C"}
+	entries := func(values ...int) []Entry {
+		out := make([]Entry, len(values))
+		for i, v := range values {
+			out[i] = Entry{Candidate: candidates[i], Value: v}
+		}
+		return out
+	}
+
+	cases := []struct {
+		name    string
+		mode    string
+		entries []Entry
+		want    []BallotError
+	}{
+		{"ranked permutation", ModeRankedChoice, entries(2, 3, 1), nil},
+		{"ranked zero", ModeInstantRunoff, entries(0, 2, 1), []BallotError{{0, FieldValue, "rank must be between 1 and 3"}}},
+		{"ranked repeated", ModeCondorcet, entries(1, 1, 2), []BallotError{{1, FieldValue, "rank 1 given to more than one choice"}}},
+		{"yes_no", ModeYesNo, entries(1, 0, 1), nil},
+		{"yes_no out of range", ModeYesNo, entries(1, 2, 0), []BallotError{{1, FieldValue, "must be 0 or 1"}}},
+		{"score", ModeScore, entries(0, 5, 3), nil},
+		{"star out of range", ModeStar, entries(0, 6, 3), []BallotError{{1, FieldValue, "score must be between 0 and 5"}}},
+		{"incomplete", ModeScore, entries(1, 2), []BallotError{{-1, "", "missing votes on 1 of 3 choices"}}},
+		{
+			"unknown and repeated choices",
+			ModeYesNo,
+			[]Entry{{"A", 1}, {"A", 1}, {"Z", 0}, {"B", 0}, {"C", 0}},
+			[]BallotError{{1, FieldCandidate, "voted on more than once"}, {2, FieldCandidate, "not a choice in this round"}},
+		},
+		{"unknown mode", "plurality", entries(1, 2, 3), []BallotError{{-1, "", `unknown voting mode "plurality"`}}},
+	}
+	for _, c := range cases {
+		got := ValidateBallot(c.mode, candidates, c.entries)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: expected %v, got %v", c.name, c.want[i], got[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package tally
+
+// Borda awards n - rank + 1 points for each ranking, where n is the number of candidates.
+type Borda struct{}
+
+func (Borda) Name() string { return "borda" }
+
+func (Borda) Tally(candidates []string, ballots []Ballot) Result {
+	n := len(candidates)
+	scores := make(map[string]int, n)
+	for _, b := range ballots {
+		for _, c := range candidates {
+			if rank, ok := b.Values[c]; ok && rank >= 1 && rank <= n {
+				scores[c] += n - rank + 1
+			}
+		}
+	}
+
+	result := Result{
+		Method:  "borda",
+		Ranking: rankByScore(candidates, scores),
+		Rounds:  []Round{{Number: 1, Scores: scores}},
+	}
+	result.recordTies()
+	return result
+}
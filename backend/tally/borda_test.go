@@ -0,0 +1,36 @@
+package tally
+
+import "testing"
+
+func TestBorda(t *testing.T) {
+	ballots := []Ballot{
+		ranked("alice", "A", "B", "C"),
+		ranked("bob", "A", "C", "B"),
+		ranked("carol", "B", "C", "A"),
+	}
+
+	result := Borda{}.Tally([]string{"A", "B", "C"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "A", Score: 7, Place: 1},
+		Standing{Candidate: "B", Score: 6, Place: 2},
+		Standing{Candidate: "C", Score: 5, Place: 3},
+	)
+	if len(result.Rounds) != 1 {
+		t.Fatalf("expected 1 round, got %d", len(result.Rounds))
+	}
+}
+
+func TestBordaIgnoresOutOfRangeRanks(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "alice", Values: map[string]int{"A": 1, "B": 0, "C": 9}},
+	}
+
+	result := Borda{}.Tally([]string{"A", "B", "C"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "A", Score: 3, Place: 1},
+		Standing{Candidate: "B", Score: 0, Place: 2},
+		Standing{Candidate: "C", Score: 0, Place: 2},
+	)
+}
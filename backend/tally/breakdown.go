@@ -0,0 +1,64 @@
+package tally
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Breakdown summarises the votes one candidate received, for showing alongside
+// the ranking.
+type Breakdown struct {
+	Ballots   int         `json:"ballots"`             // ballots with a vote on the candidate
+	Yes       int         `json:"yes,omitempty"`       // yes_no only
+	No        int         `json:"no,omitempty"`        // yes_no only
+	Histogram map[int]int `json:"histogram,omitempty"` // rank or score → ballots giving it, ranked and score modes only
+	Average   float64     `json:"average,omitempty"`   // mean rank or score, ranked and score modes only
+	Marks     []Mark      `json:"marks,omitempty"`     // each voter's value, left out when voters are anonymous
+}
+
+// Mark is the value one voter gave a candidate
+type Mark struct {
+	Voter string `json:"voter"`
+	Value int    `json:"value"`
+}
+
+// Breakdowns counts the votes each candidate received in a voting mode. Marks are
+// filled in, ordered by voter, only when withMarks is set.
+func Breakdowns(mode string, candidates []string, ballots []Ballot, withMarks bool) map[string]Breakdown {
+	out := make(map[string]Breakdown, len(candidates))
+	for _, c := range candidates {
+		var b Breakdown
+		sum := 0
+		for _, ballot := range ballots {
+			v, ok := ballot.Values[c]
+			if !ok {
+				continue
+			}
+			b.Ballots++
+			sum += v
+
+			if mode == ModeYesNo {
+				if v == 1 {
+					b.Yes++
+				} else {
+					b.No++
+				}
+			} else {
+				if b.Histogram == nil {
+					b.Histogram = make(map[int]int)
+				}
+				b.Histogram[v]++
+			}
+			if withMarks {
+				b.Marks = append(b.Marks, Mark{Voter: ballot.Voter, Value: v})
+			}
+		}
+
+		if mode != ModeYesNo && b.Ballots > 0 {
+			b.Average = float64(sum) / float64(b.Ballots)
+		}
+		slices.SortFunc(b.Marks, func(x, y Mark) int { return cmp.Compare(x.Voter, y.Voter) })
+		out[c] = b
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package tally
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestBreakdownsYesNo(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "v1", Values: map[string]int{"A": 1, "B": 0}},
+		{Voter: "v2", Values: map[string]int{"A": 1, "B": 1}},
+		{Voter: "v3", Values: map[string]int{"A": 0}},
+	}
+	got := Breakdowns(ModeYesNo, []string{"A", "B"}, ballots, false)
+
+	if a := got["A"]; a.Ballots != 3 || a.Yes != 2 || a.No != 1 || a.Histogram != nil || a.Marks != nil {
+		t.Errorf("A: unexpected breakdown %+v", a)
+	}
+	if b := got["B"]; b.Ballots != 2 || b.Yes != 1 || b.No != 1 {
+		t.Errorf("B: unexpected breakdown %+v", b)
+	}
+}
+
+func TestBreakdownsRanked(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "v2", Values: map[string]int{"A": 1, "B": 2}},
+		{Voter: "v1", Values: map[string]int{"A": 2, "B": 1}},
+		{Voter: "v3", Values: map[string]int{"A": 1, "B": 2}},
+	}
+	got := Breakdowns(ModeRankedChoice, []string{"A", "B"}, ballots, true)
+
+	a := got["A"]
+	if !maps.Equal(a.Histogram, map[int]int{1: 2, 2: 1}) {
+		t.Errorf("expected histogram {1:2 2:1}, got %v", a.Histogram)
+	}
+	if want := 4.0 / 3.0; a.Average != want {
+		t.Errorf("expected average %v, got %v", want, a.Average)
+	}
+	if a.Yes != 0 || a.No != 0 {
+		t.Errorf("expected no yes/no counts in ranked mode, got %+v", a)
+	}
+	if len(a.Marks) != 3 || a.Marks[0] != (Mark{"v1", 2}) || a.Marks[2] != (Mark{"v3", 1}) {
+		t.Errorf("expected marks ordered by voter, got %v", a.Marks)
+	}
+}
+
+func TestBreakdownsNoBallots(t *testing.T) {
+	got := Breakdowns(ModeScore, []string{"A"}, nil, true)
+	if a := got["A"]; a.Ballots != 0 || a.Average != 0 || a.Histogram != nil {
+		t.Errorf("expected empty breakdown, got %+v", a)
+	}
+}
@@ -0,0 +1,95 @@
+package tally
+
+import "slices"
+
+// InstantRunoff counts each ballot for its highest ranked remaining candidate and
+// eliminates the last place candidates round by round until one holds a majority.
+type InstantRunoff struct{}
+
+func (InstantRunoff) Name() string { return "instant_runoff" }
+
+func (InstantRunoff) Tally(candidates []string, ballots []Ballot) Result {
+	result := Result{Method: "instant_runoff"}
+	if len(candidates) == 0 {
+		return result
+	}
+
+	remaining := slices.Clone(candidates)
+	slices.Sort(remaining)
+
+	// Eliminated candidates grouped by round, with the count they were eliminated on
+	var eliminated [][]Standing
+
+	for round := 1; ; round++ {
+		counts := make(map[string]int, len(remaining))
+		for _, c := range remaining {
+			counts[c] = 0
+		}
+		active := 0
+		for _, b := range ballots {
+			if top := topChoice(b, remaining); top != "" {
+				counts[top]++
+				active++
+			}
+		}
+
+		lowest, highest := counts[remaining[0]], counts[remaining[0]]
+		for _, c := range remaining {
+			lowest = min(lowest, counts[c])
+			highest = max(highest, counts[c])
+		}
+
+		r := Round{Number: round, Scores: counts}
+		if len(remaining) == 1 || highest*2 > active || lowest == highest {
+			if lowest == highest && len(remaining) > 1 {
+				r.Note = "remaining candidates tied"
+			} else {
+				r.Note = "majority reached"
+			}
+			result.Rounds = append(result.Rounds, r)
+			result.Ranking = rankByScore(remaining, counts)
+			break
+		}
+
+		var losers []Standing
+		kept := remaining[:0]
+		for _, c := range remaining {
+			if counts[c] == lowest {
+				losers = append(losers, Standing{Candidate: c, Score: lowest})
+				r.Eliminated = append(r.Eliminated, c)
+			} else {
+				kept = append(kept, c)
+			}
+		}
+		remaining = kept
+		eliminated = append(eliminated, losers)
+		result.Rounds = append(result.Rounds, r)
+	}
+
+	// Later eliminations place higher than earlier ones
+	for i := len(eliminated) - 1; i >= 0; i-- {
+		place := len(result.Ranking) + 1
+		for _, s := range eliminated[i] {
+			s.Place = place
+			result.Ranking = append(result.Ranking, s)
+		}
+	}
+	result.recordTies()
+	return result
+}
+
+// topChoice returns the best ranked candidate on the ballot that is still in the running,
+// or "" if the ballot ranks none of them.
+func topChoice(b Ballot, remaining []string) string {
+	best, bestRank := "", 0
+	for _, c := range remaining {
+		rank, ok := b.Values[c]
+		if !ok || rank < 1 {
+			continue
+		}
+		if best == "" || rank < bestRank {
+			best, bestRank = c, rank
+		}
+	}
+	return best
+}
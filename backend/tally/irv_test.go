@@ -0,0 +1,90 @@
+package tally
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInstantRunoff(t *testing.T) {
+	var ballots []Ballot
+	ballots = append(ballots, repeat(4, ranked("", "A", "B", "C"))...)
+	ballots = append(ballots, repeat(3, ranked("", "B", "C", "A"))...)
+	ballots = append(ballots, repeat(2, ranked("", "C", "B", "A"))...)
+
+	result := InstantRunoff{}.Tally([]string{"A", "B", "C"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "B", Score: 5, Place: 1},
+		Standing{Candidate: "A", Score: 4, Place: 2},
+		Standing{Candidate: "C", Score: 2, Place: 3},
+	)
+
+	if len(result.Rounds) != 2 {
+		t.Fatalf("expected 2 rounds, got %d", len(result.Rounds))
+	}
+	if !slices.Equal(result.Rounds[0].Eliminated, []string{"C"}) {
+		t.Errorf("expected C eliminated in round 1, got %v", result.Rounds[0].Eliminated)
+	}
+	if result.Rounds[1].Scores["B"] != 5 {
+		t.Errorf("expected B to collect C's transfers, got %v", result.Rounds[1].Scores)
+	}
+}
+
+func TestInstantRunoffFirstRoundMajority(t *testing.T) {
+	ballots := []Ballot{
+		ranked("alice", "A", "B"),
+		ranked("bob", "A", "B"),
+		ranked("carol", "B", "A"),
+	}
+
+	result := InstantRunoff{}.Tally([]string{"A", "B"}, ballots)
+
+	if len(result.Rounds) != 1 {
+		t.Fatalf("expected 1 round, got %d", len(result.Rounds))
+	}
+	if result.Ranking[0].Candidate != "A" {
+		t.Errorf("expected A to win, got %s", result.Ranking[0].Candidate)
+	}
+}
+
+func TestInstantRunoffEliminatesTiedLastPlace(t *testing.T) {
+	var ballots []Ballot
+	ballots = append(ballots, repeat(3, ranked("", "A", "B", "C", "D"))...)
+	ballots = append(ballots, repeat(2, ranked("", "B", "A", "C", "D"))...)
+	ballots = append(ballots, ranked("", "C", "B", "A", "D"))
+	ballots = append(ballots, ranked("", "D", "B", "A", "C"))
+
+	result := InstantRunoff{}.Tally([]string{"A", "B", "C", "D"}, ballots)
+
+	if !slices.Equal(result.Rounds[0].Eliminated, []string{"C", "D"}) {
+		t.Fatalf("expected C and D eliminated together, got %v", result.Rounds[0].Eliminated)
+	}
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "B", Score: 4, Place: 1},
+		Standing{Candidate: "A", Score: 3, Place: 2},
+		Standing{Candidate: "C", Score: 1, Place: 3},
+		Standing{Candidate: "D", Score: 1, Place: 3},
+	)
+}
+
+func TestInstantRunoffAllTied(t *testing.T) {
+	ballots := []Ballot{
+		ranked("alice", "A", "B"),
+		ranked("bob", "B", "A"),
+	}
+
+	result := InstantRunoff{}.Tally([]string{"A", "B"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "A", Score: 1, Place: 1},
+		Standing{Candidate: "B", Score: 1, Place: 1},
+	)
+}
+
+func TestInstantRunoffNoCandidates(t *testing.T) {
+	result := InstantRunoff{}.Tally(nil, []Ballot{ranked("alice")})
+
+	if len(result.Rounds) != 0 || len(result.Ranking) != 0 {
+		t.Errorf("expected an empty result, got %+v", result)
+	}
+}
@@ -0,0 +1,82 @@
+package tally
+
+// Schulze is a Condorcet method. Candidates are compared head to head on every
+// ballot, and each is scored by how many others it beats along the strongest path.
+type Schulze struct{}
+
+func (Schulze) Name() string { return "schulze" }
+
+func (Schulze) Tally(candidates []string, ballots []Ballot) Result {
+	n := len(candidates)
+
+	// d[i][j] is the number of ballots preferring candidate i over candidate j
+	d := make([][]int, n)
+	for i := range d {
+		d[i] = make([]int, n)
+	}
+	for _, b := range ballots {
+		for i := range candidates {
+			for j := range candidates {
+				if i != j && prefers(b, candidates[i], candidates[j]) {
+					d[i][j]++
+				}
+			}
+		}
+	}
+
+	// p[i][j] is the strength of the strongest path from i to j
+	p := make([][]int, n)
+	for i := range p {
+		p[i] = make([]int, n)
+		for j := range p[i] {
+			if i != j && d[i][j] > d[j][i] {
+				p[i][j] = d[i][j]
+			}
+		}
+	}
+	for k := range n {
+		for i := range n {
+			if i == k {
+				continue
+			}
+			for j := range n {
+				if j == i || j == k {
+					continue
+				}
+				p[i][j] = max(p[i][j], min(p[i][k], p[k][j]))
+			}
+		}
+	}
+
+	wins := make(map[string]int, n)
+	for i, c := range candidates {
+		wins[c] = 0
+		for j := range candidates {
+			if i != j && p[i][j] > p[j][i] {
+				wins[c]++
+			}
+		}
+	}
+
+	result := Result{
+		Method:         "schulze",
+		Ranking:        rankByScore(candidates, wins),
+		Rounds:         []Round{{Number: 1, Scores: wins, Note: "head to head wins by strongest path"}},
+		Pairwise:       matrix(candidates, d),
+		StrongestPaths: matrix(candidates, p),
+	}
+	result.recordTies()
+	return result
+}
+
+// prefers reports whether the ballot ranks x above y. Ranked candidates beat unranked ones.
+func prefers(b Ballot, x, y string) bool {
+	rx, okX := b.Values[x]
+	ry, okY := b.Values[y]
+	okX = okX && rx >= 1
+	okY = okY && ry >= 1
+	if okX && okY {
+		return rx < ry
+	}
+	return okX && !okY
+}
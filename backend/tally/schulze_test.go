@@ -0,0 +1,62 @@
+package tally
+
+import "testing"
+
+func TestSchulzeFindsCondorcetWinner(t *testing.T) {
+	var ballots []Ballot
+	ballots = append(ballots, repeat(4, ranked("", "A", "B", "C"))...)
+	ballots = append(ballots, repeat(3, ranked("", "B", "C", "A"))...)
+	ballots = append(ballots, repeat(2, ranked("", "C", "B", "A"))...)
+
+	result := Schulze{}.Tally([]string{"A", "B", "C"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "B", Score: 2, Place: 1},
+		Standing{Candidate: "C", Score: 1, Place: 2},
+		Standing{Candidate: "A", Score: 0, Place: 3},
+	)
+
+	if result.Pairwise["B"]["A"] != 5 || result.Pairwise["A"]["B"] != 4 {
+		t.Errorf("unexpected pairwise A/B: %v", result.Pairwise)
+	}
+	if result.Pairwise["B"]["C"] != 7 || result.Pairwise["C"]["B"] != 2 {
+		t.Errorf("unexpected pairwise B/C: %v", result.Pairwise)
+	}
+	if result.StrongestPaths["B"]["A"] != 5 || result.StrongestPaths["A"]["B"] != 0 {
+		t.Errorf("unexpected strongest paths: %v", result.StrongestPaths)
+	}
+}
+
+func TestSchulzeResolvesCycle(t *testing.T) {
+	// Every candidate is beaten head to head by someone; path strength breaks the cycle
+	var ballots []Ballot
+	ballots = append(ballots, repeat(5, ranked("", "A", "C", "B", "E", "D"))...)
+	ballots = append(ballots, repeat(5, ranked("", "A", "D", "E", "C", "B"))...)
+	ballots = append(ballots, repeat(8, ranked("", "B", "E", "D", "A", "C"))...)
+	ballots = append(ballots, repeat(3, ranked("", "C", "A", "B", "E", "D"))...)
+	ballots = append(ballots, repeat(7, ranked("", "C", "A", "E", "B", "D"))...)
+	ballots = append(ballots, repeat(2, ranked("", "C", "B", "A", "D", "E"))...)
+	ballots = append(ballots, repeat(7, ranked("", "D", "C", "E", "B", "A"))...)
+	ballots = append(ballots, repeat(8, ranked("", "E", "B", "A", "D", "C"))...)
+
+	result := Schulze{}.Tally([]string{"A", "B", "C", "D", "E"}, ballots)
+
+	want := []string{"E", "A", "C", "B", "D"}
+	for i, c := range want {
+		if result.Ranking[i].Candidate != c {
+			t.Fatalf("expected ranking %v, got %+v", want, result.Ranking)
+		}
+	}
+}
+
+func TestSchulzeUnrankedLosesToRanked(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "alice", Values: map[string]int{"A": 1}},
+	}
+
+	result := Schulze{}.Tally([]string{"A", "B"}, ballots)
+
+	if result.Ranking[0].Candidate != "A" || result.Ranking[0].Place != 1 || result.Ranking[1].Place != 2 {
+		t.Errorf("expected A over B, got %+v", result.Ranking)
+	}
+}
@@ -0,0 +1,96 @@
+package tally
+
+import "maps"
+
+// Score sums the 0..MaxScore values each candidate receives.
+type Score struct{}
+
+func (Score) Name() string { return "score" }
+
+func (Score) Tally(candidates []string, ballots []Ballot) Result {
+	scores := sumScores(candidates, ballots)
+	result := Result{
+		Method:  "score",
+		Ranking: rankByScore(candidates, scores),
+		Rounds:  []Round{{Number: 1, Scores: scores}},
+	}
+	result.recordTies()
+	return result
+}
+
+// Star is STAR voting (Score Then Automatic Runoff): the two highest scoring
+// candidates go to a runoff, won by whichever is scored higher on more ballots.
+type Star struct{}
+
+func (Star) Name() string { return "star" }
+
+func (Star) Tally(candidates []string, ballots []Ballot) Result {
+	scores := sumScores(candidates, ballots)
+	ranking := rankByScore(candidates, scores)
+	result := Result{
+		Method:  "star",
+		Ranking: ranking,
+		Rounds:  []Round{{Number: 1, Scores: maps.Clone(scores), Note: "scoring round"}},
+	}
+	if len(ranking) < 2 {
+		result.recordTies()
+		return result
+	}
+
+	a, b := ranking[0].Candidate, ranking[1].Candidate
+	preferences := map[string]int{a: 0, b: 0}
+	for _, ballot := range ballots {
+		switch va, vb := clampScore(ballot.Values[a]), clampScore(ballot.Values[b]); {
+		case va > vb:
+			preferences[a]++
+		case vb > va:
+			preferences[b]++
+		}
+	}
+	result.Rounds = append(result.Rounds, Round{Number: 2, Scores: preferences, Note: "automatic runoff"})
+
+	// Finalists take the top two places; everyone else keeps their scoring round order
+	runoff := rankByScore([]string{a, b}, preferences)
+	winner, runnerUp := runoff[0].Candidate, runoff[1].Candidate
+	tied := runoff[0].Place == runoff[1].Place
+	if tied {
+		// Runoff tied: fall back to the scoring round order
+		winner, runnerUp = a, b
+		result.TieBreaks = append(result.TieBreaks, TieBreak{Round: 2, Candidates: []string{a, b}, Rule: RuleScoringRound})
+	}
+	runnerUpPlace := 2
+	if tied && ranking[0].Place == ranking[1].Place {
+		runnerUpPlace = 1
+	}
+
+	result.Ranking = []Standing{
+		{Candidate: winner, Score: scores[winner], Place: 1},
+		{Candidate: runnerUp, Score: scores[runnerUp], Place: runnerUpPlace},
+	}
+	for _, s := range ranking[2:] {
+		s.Place = max(s.Place, 3)
+		result.Ranking = append(result.Ranking, s)
+	}
+	result.recordTies()
+	return result
+}
+
+func sumScores(candidates []string, ballots []Ballot) map[string]int {
+	scores := make(map[string]int, len(candidates))
+	for _, b := range ballots {
+		for _, c := range candidates {
+			scores[c] += clampScore(b.Values[c])
+		}
+	}
+	return scores
+}
+
+func clampScore(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > MaxScore {
+		return MaxScore
+	}
+	return v
+}
@@ -0,0 +1,59 @@
+package tally
+
+import "testing"
+
+func TestScore(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "alice", Values: map[string]int{"A": 5, "B": 2, "C": 0}},
+		{Voter: "bob", Values: map[string]int{"A": 1, "B": 4, "C": 3}},
+		{Voter: "carol", Values: map[string]int{"A": 9, "B": -3, "C": 3}}, // clamped to 5 and 0
+	}
+
+	result := Score{}.Tally([]string{"A", "B", "C"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "A", Score: 11, Place: 1},
+		Standing{Candidate: "B", Score: 6, Place: 2},
+		Standing{Candidate: "C", Score: 6, Place: 2},
+	)
+}
+
+func TestStarRunoffOverturnsScoreLeader(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "alice", Values: map[string]int{"A": 5, "B": 0, "C": 0}},
+		{Voter: "bob", Values: map[string]int{"A": 3, "B": 4, "C": 0}},
+		{Voter: "carol", Values: map[string]int{"A": 3, "B": 4, "C": 1}},
+	}
+
+	result := Star{}.Tally([]string{"A", "B", "C"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "B", Score: 8, Place: 1},
+		Standing{Candidate: "A", Score: 11, Place: 2},
+		Standing{Candidate: "C", Score: 1, Place: 3},
+	)
+	if len(result.Rounds) != 2 {
+		t.Fatalf("expected scoring and runoff rounds, got %d", len(result.Rounds))
+	}
+	runoff := result.Rounds[1].Scores
+	if runoff["A"] != 1 || runoff["B"] != 2 {
+		t.Errorf("expected runoff A=1 B=2, got %v", runoff)
+	}
+}
+
+func TestStarTiedRunoffKeepsScoreOrder(t *testing.T) {
+	ballots := []Ballot{
+		{Voter: "alice", Values: map[string]int{"A": 5, "B": 0}},
+		{Voter: "bob", Values: map[string]int{"A": 0, "B": 4}},
+	}
+
+	result := Star{}.Tally([]string{"A", "B"}, ballots)
+
+	assertRanking(t, result.Ranking,
+		Standing{Candidate: "A", Score: 5, Place: 1},
+		Standing{Candidate: "B", Score: 4, Place: 2},
+	)
+	if len(result.TieBreaks) != 1 || result.TieBreaks[0].Round != 2 || result.TieBreaks[0].Rule != RuleScoringRound {
+		t.Errorf("expected runoff tie break by scoring round, got %+v", result.TieBreaks)
+	}
+}
@@ -0,0 +1,170 @@
+package tally
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Voting modes accepted in SessionConfig.VotingMode
+const (
+	ModeYesNo         = "yes_no"
+	ModeRankedChoice  = "ranked_choice"
+	ModeInstantRunoff = "instant_runoff"
+	ModeCondorcet     = "condorcet"
+	ModeScore         = "score"
+	ModeStar          = "star"
+)
+
+// MaxScore is the highest value a member can give a choice in score and STAR voting
+const MaxScore = 5
+
+// Ballot is one member's votes, keyed by choice. For ranked methods the value is
+// a rank (1 = most preferred), for approval it is 1/0, and for score methods it
+// is 0..MaxScore.
+type Ballot struct {
+	Voter  string
+	Values map[string]int
+}
+
+// Method tallies ballots over a fixed set of candidates.
+type Method interface {
+	Name() string
+	Tally(candidates []string, ballots []Ballot) Result
+}
+
+type Standing struct {
+	Candidate string `json:"candidate" bson:"candidate"`
+	Score     int    `json:"score" bson:"score"`
+	Place     int    `json:"place" bson:"place"` // 1-based, tied candidates share a place
+}
+
+type Round struct {
+	Number     int            `json:"number" bson:"number"`
+	Scores     map[string]int `json:"scores" bson:"scores"`
+	Eliminated []string       `json:"eliminated,omitempty" bson:"eliminated,omitempty"`
+	Note       string         `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+// TieBreak records how candidates that finished level were ordered
+type TieBreak struct {
+	Round      int      `json:"round,omitempty" bson:"round,omitempty"` // 0 for the final ranking
+	Candidates []string `json:"candidates" bson:"candidates"`           // in the order decided
+	Rule       string   `json:"rule" bson:"rule"`
+	Pending    bool     `json:"pending,omitempty" bson:"pending,omitempty"` // waiting on a manual decision
+}
+
+// Result is the outcome of a tally along with everything needed to explain it.
+type Result struct {
+	Method  string     `json:"method" bson:"method"`
+	Ranking []Standing `json:"ranking" bson:"ranking"`
+	Rounds  []Round    `json:"rounds" bson:"rounds"`
+	// Pairwise[a][b] is the number of ballots preferring a over b (Condorcet methods only)
+	Pairwise map[string]map[string]int `json:"pairwise,omitempty" bson:"pairwise,omitempty"`
+	// StrongestPaths[a][b] is the strength of the strongest path from a to b (Schulze only)
+	StrongestPaths map[string]map[string]int `json:"strongestPaths,omitempty" bson:"strongestPaths,omitempty"`
+	TieBreaks      []TieBreak                `json:"tieBreaks,omitempty" bson:"tieBreaks,omitempty"`
+}
+
+// Tie-break rules
+const (
+	RuleAlphabetical = "alphabetical"
+	RuleScoringRound = "scoring_round"
+)
+
+// ForMode returns the tally method for a session voting mode.
+func ForMode(mode string) (Method, error) {
+	switch mode {
+	case ModeYesNo:
+		return Approval{}, nil
+	case ModeRankedChoice:
+		return Borda{}, nil
+	case ModeInstantRunoff:
+		return InstantRunoff{}, nil
+	case ModeCondorcet:
+		return Schulze{}, nil
+	case ModeScore:
+		return Score{}, nil
+	case ModeStar:
+		return Star{}, nil
+	default:
+		return nil, fmt.Errorf("unknown voting mode %q", mode)
+	}
+}
+
+// rankByScore orders candidates by descending score, alphabetically within ties,
+// and assigns shared places to tied candidates.
+func rankByScore(candidates []string, scores map[string]int) []Standing {
+	standings := make([]Standing, 0, len(candidates))
+	for _, c := range candidates {
+		standings = append(standings, Standing{Candidate: c, Score: scores[c]})
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Candidate < standings[j].Candidate
+	})
+	for i := range standings {
+		if i > 0 && standings[i].Score == standings[i-1].Score {
+			standings[i].Place = standings[i-1].Place
+		} else {
+			standings[i].Place = i + 1
+		}
+	}
+	return standings
+}
+
+// recordTies notes every group of candidates sharing a place in the final ranking,
+// which rankByScore leaves in alphabetical order.
+func (r *Result) recordTies() {
+	for i := 0; i < len(r.Ranking); {
+		j := i + 1
+		for j < len(r.Ranking) && r.Ranking[j].Place == r.Ranking[i].Place {
+			j++
+		}
+		if j-i > 1 {
+			tied := make([]string, 0, j-i)
+			for _, s := range r.Ranking[i:j] {
+				tied = append(tied, s.Candidate)
+			}
+			r.TieBreaks = append(r.TieBreaks, TieBreak{Candidates: tied, Rule: RuleAlphabetical})
+		}
+		i = j
+	}
+}
+
+// matrix converts an index-based square matrix into one keyed by candidate
+func matrix(candidates []string, m [][]int) map[string]map[string]int {
+	out := make(map[string]map[string]int, len(candidates))
+	for i, a := range candidates {
+		out[a] = make(map[string]int, len(candidates)-1)
+		for j, b := range candidates {
+			if i != j {
+				out[a][b] = m[i][j]
+			}
+		}
+	}
+	return out
+}
+
+// ExtendRanking appends the candidates that didn't make a runoff to the runoff's
+// ranking, keeping their order from the previous round and placing them after
+// every finalist.
+func ExtendRanking(runoff *Result, previous []Standing) {
+	finalists := make(map[string]bool, len(runoff.Ranking))
+	for _, s := range runoff.Ranking {
+		finalists[s.Candidate] = true
+	}
+
+	shift, shifted := 0, false
+	for _, s := range previous {
+		if finalists[s.Candidate] {
+			continue
+		}
+		if !shifted {
+			shift, shifted = len(runoff.Ranking)+1-s.Place, true
+		}
+		s.Place += shift
+		runoff.Ranking = append(runoff.Ranking, s)
+	}
+}
@@ -0,0 +1,100 @@
+package tally
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestForMode(t *testing.T) {
+	cases := map[string]string{
+		ModeYesNo:         "approval",
+		ModeRankedChoice:  "borda",
+		ModeInstantRunoff: "instant_runoff",
+		ModeCondorcet:     "schulze",
+		ModeScore:         "score",
+		ModeStar:          "star",
+	}
+	for mode, name := range cases {
+		m, err := ForMode(mode)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		if m.Name() != name {
+			t.Errorf("%s: expected %s, got %s", mode, name, m.Name())
+		}
+	}
+
+	if _, err := ForMode("plurality"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestRankByScoreSharesPlaces(t *testing.T) {
+	got := rankByScore([]string{"c", "b", "a", "d"}, map[string]int{"a": 2, "b": 5, "c": 2, "d": 1})
+	assertRanking(t, got,
+		Standing{Candidate: "b", Score: 5, Place: 1},
+		Standing{Candidate: "a", Score: 2, Place: 2},
+		Standing{Candidate: "c", Score: 2, Place: 2},
+		Standing{Candidate: "d", Score: 1, Place: 4},
+	)
+}
+
+func TestRecordTies(t *testing.T) {
+	result := Result{Ranking: rankByScore([]string{"A", "B", "C", "D", "E"}, map[string]int{"A": 3, "B": 3, "C": 2, "D": 1, "E": 1})}
+	result.recordTies()
+
+	if len(result.TieBreaks) != 2 {
+		t.Fatalf("expected 2 tie breaks, got %+v", result.TieBreaks)
+	}
+	if !slices.Equal(result.TieBreaks[0].Candidates, []string{"A", "B"}) || result.TieBreaks[0].Rule != RuleAlphabetical {
+		t.Errorf("unexpected first tie break: %+v", result.TieBreaks[0])
+	}
+	if !slices.Equal(result.TieBreaks[1].Candidates, []string{"D", "E"}) {
+		t.Errorf("unexpected second tie break: %+v", result.TieBreaks[1])
+	}
+}
+
+func TestExtendRanking(t *testing.T) {
+	previous := rankByScore([]string{"A", "B", "C", "D", "E"}, map[string]int{"A": 9, "B": 8, "C": 7, "D": 3, "E": 3})
+	runoff := Result{Ranking: rankByScore([]string{"A", "B", "C"}, map[string]int{"A": 1, "B": 2, "C": 4})}
+
+	ExtendRanking(&runoff, previous)
+
+	assertRanking(t, runoff.Ranking,
+		Standing{Candidate: "C", Score: 4, Place: 1},
+		Standing{Candidate: "B", Score: 2, Place: 2},
+		Standing{Candidate: "A", Score: 1, Place: 3},
+		Standing{Candidate: "D", Score: 3, Place: 4},
+		Standing{Candidate: "E", Score: 3, Place: 4},
+	)
+}
+
+// ranked builds a ballot from candidates listed in order of preference
+func ranked(voter string, order ...string) Ballot {
+	b := Ballot{Voter: voter, Values: map[string]int{}}
+	for i, c := range order {
+		b.Values[c] = i + 1
+	}
+	return b
+}
+
+// repeat returns n copies of a ballot
+func repeat(n int, b Ballot) []Ballot {
+	out := make([]Ballot, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}
+
+func assertRanking(t *testing.T, got []Standing, want ...Standing) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d standings, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("standing %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
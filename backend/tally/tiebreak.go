@@ -0,0 +1,94 @@
+package tally
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// Tie-break policies accepted in SessionConfig.TieBreak
+const (
+	TieBreakRandom             = "random"
+	TieBreakHost               = "host"
+	TieBreakEarliestSubmission = "earliest_submission"
+	TieBreakRunoff             = "runoff"
+)
+
+type TieBreakOptions struct {
+	Policy string
+	// Seed drives the random policy so that re-running a tally gives the same order
+	Seed int64
+	// Order positions candidates for every policy except random; lower goes first.
+	// For earliest_submission it is the order choices were added, and for host it
+	// is the decision made after the tie was detected.
+	Order map[string]int
+}
+
+// BreakTies orders candidates sharing a place in the final ranking according to the
+// policy and records each decision. If a tie for first place needs a manual decision
+// that hasn't been made yet, the tied candidates are returned and left sharing first place.
+func BreakTies(result *Result, opts TieBreakOptions) (pending []string) {
+	policy := opts.Policy
+	if policy == "" {
+		policy = TieBreakRandom
+	}
+	rng := rand.New(rand.NewPCG(uint64(opts.Seed), 0))
+
+	// Decisions about the final ranking are remade from scratch
+	result.TieBreaks = slices.DeleteFunc(result.TieBreaks, func(tb TieBreak) bool { return tb.Round == 0 })
+
+	for i := 0; i < len(result.Ranking); {
+		j := i + 1
+		for j < len(result.Ranking) && result.Ranking[j].Place == result.Ranking[i].Place {
+			j++
+		}
+		if j-i == 1 {
+			i = j
+			continue
+		}
+
+		group := result.Ranking[i:j]
+		var resolved bool
+		if policy == TieBreakRandom {
+			rng.Shuffle(len(group), func(a, b int) { group[a], group[b] = group[b], group[a] })
+			resolved = true
+		} else {
+			resolved = orderBy(group, opts.Order)
+		}
+
+		tb := TieBreak{Rule: policy}
+		for _, s := range group {
+			tb.Candidates = append(tb.Candidates, s.Candidate)
+		}
+		if resolved {
+			place := group[0].Place
+			for k := range group {
+				group[k].Place = place + k
+			}
+		} else {
+			// Left in alphabetical order, and flagged if someone still has to decide the winner
+			tb.Rule = RuleAlphabetical
+			if group[0].Place == 1 && (policy == TieBreakHost || policy == TieBreakRunoff) {
+				tb.Pending = true
+				pending = append(pending, tb.Candidates...)
+			}
+		}
+		result.TieBreaks = append(result.TieBreaks, tb)
+		i = j
+	}
+	return pending
+}
+
+// orderBy sorts a tied group by position in order, reporting false (and leaving the
+// group untouched) unless every candidate has a distinct position.
+func orderBy(group []Standing, order map[string]int) bool {
+	seen := make(map[int]bool, len(group))
+	for _, s := range group {
+		pos, ok := order[s.Candidate]
+		if !ok || seen[pos] {
+			return false
+		}
+		seen[pos] = true
+	}
+	slices.SortStableFunc(group, func(a, b Standing) int { return order[a.Candidate] - order[b.Candidate] })
+	return true
+}
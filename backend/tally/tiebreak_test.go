@@ -0,0 +1,98 @@
+package tally
+
+import (
+	"slices"
+	"testing"
+)
+
+func tiedResult() Result {
+	result := Result{Ranking: rankByScore([]string{"A", "B", "C", "D"}, map[string]int{"A": 3, "B": 3, "C": 3, "D": 1})}
+	result.recordTies()
+	return result
+}
+
+func candidatesOf(standings []Standing) []string {
+	out := make([]string, 0, len(standings))
+	for _, s := range standings {
+		out = append(out, s.Candidate)
+	}
+	return out
+}
+
+func TestBreakTiesRandomIsDeterministic(t *testing.T) {
+	first := tiedResult()
+	if pending := BreakTies(&first, TieBreakOptions{Policy: TieBreakRandom, Seed: 42}); pending != nil {
+		t.Fatalf("random policy should never be pending, got %v", pending)
+	}
+
+	for range 10 {
+		again := tiedResult()
+		BreakTies(&again, TieBreakOptions{Policy: TieBreakRandom, Seed: 42})
+		if !slices.Equal(candidatesOf(again.Ranking), candidatesOf(first.Ranking)) {
+			t.Fatalf("expected %v, got %v", candidatesOf(first.Ranking), candidatesOf(again.Ranking))
+		}
+	}
+
+	for i, s := range first.Ranking {
+		if s.Place != i+1 {
+			t.Errorf("expected distinct places after random tie break, got %+v", first.Ranking)
+		}
+	}
+	if len(first.TieBreaks) != 1 || first.TieBreaks[0].Rule != TieBreakRandom {
+		t.Errorf("expected one random tie break, got %+v", first.TieBreaks)
+	}
+}
+
+func TestBreakTiesEarliestSubmission(t *testing.T) {
+	result := tiedResult()
+	order := map[string]int{"C": 0, "A": 1, "B": 2, "D": 3}
+
+	BreakTies(&result, TieBreakOptions{Policy: TieBreakEarliestSubmission, Order: order})
+
+	if want := []string{"C", "A", "B", "D"}; !slices.Equal(candidatesOf(result.Ranking), want) {
+		t.Errorf("expected %v, got %v", want, candidatesOf(result.Ranking))
+	}
+	if result.Ranking[2].Place != 3 || result.Ranking[3].Place != 4 {
+		t.Errorf("unexpected places: %+v", result.Ranking)
+	}
+}
+
+func TestBreakTiesHostPendingUntilDecided(t *testing.T) {
+	result := tiedResult()
+
+	pending := BreakTies(&result, TieBreakOptions{Policy: TieBreakHost})
+
+	if !slices.Equal(pending, []string{"A", "B", "C"}) {
+		t.Fatalf("expected A, B and C pending, got %v", pending)
+	}
+	if result.Ranking[0].Place != 1 || result.Ranking[2].Place != 1 {
+		t.Errorf("expected tied candidates to keep sharing first place, got %+v", result.Ranking)
+	}
+	if len(result.TieBreaks) != 1 || !result.TieBreaks[0].Pending {
+		t.Errorf("expected one pending tie break, got %+v", result.TieBreaks)
+	}
+
+	// The host's decision resolves the same tie on the next run
+	pending = BreakTies(&result, TieBreakOptions{Policy: TieBreakHost, Order: map[string]int{"B": 0, "C": 1, "A": 2}})
+
+	if pending != nil {
+		t.Fatalf("expected no pending tie after decision, got %v", pending)
+	}
+	if want := []string{"B", "C", "A", "D"}; !slices.Equal(candidatesOf(result.Ranking), want) {
+		t.Errorf("expected %v, got %v", want, candidatesOf(result.Ranking))
+	}
+	if len(result.TieBreaks) != 1 || result.TieBreaks[0].Rule != TieBreakHost || result.TieBreaks[0].Pending {
+		t.Errorf("expected one host tie break, got %+v", result.TieBreaks)
+	}
+}
+
+func TestBreakTiesIgnoresLowerTiesForManualPolicies(t *testing.T) {
+	result := Result{Ranking: rankByScore([]string{"A", "B", "C"}, map[string]int{"A": 3, "B": 1, "C": 1})}
+
+	if pending := BreakTies(&result, TieBreakOptions{Policy: TieBreakRunoff}); pending != nil {
+		t.Errorf("expected no pending tie below first place, got %v", pending)
+	}
+	if result.TieBreaks[0].Rule != RuleAlphabetical || result.TieBreaks[0].Pending {
+		t.Errorf("expected alphabetical tie break, got %+v", result.TieBreaks[0])
+	}
+}
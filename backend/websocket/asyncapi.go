@@ -0,0 +1,217 @@
+package websocket
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The protocol is described as an AsyncAPI document generated from the message
+// types below, checked in as asyncapi.json. Run
+//
+//	go test ./websocket -run TestAsyncAPI -update
+//
+// after changing a message to regenerate it.
+
+// messageSpec describes one type of message for the document
+type messageSpec struct {
+	Type    string
+	Summary string
+	Payload any  // struct the message is read into or sent from, nil for none
+	Direct  bool // sent straight to one connection rather than numbered for replay
+}
+
+var inboundSpecs = []messageSpec{
+	{TypeSetReady, "Mark the member ready, or not, to start voting.", SetReadyPayload{}, false},
+	{TypeSubmitChoices, "Submit the member's choices.", nil, false},
+	{TypeUnsubmit, "Take back submitted choices or votes during the grace period.", nil, false},
+	{TypeForceStart, "Host only: count down to voting without waiting for everyone to be ready.", nil, false},
+	{TypeCancelForceStart, "Host only: stop the force start countdown.", nil, false},
+	{TypeCastVote, "Vote on one choice in a yes/no session.", CastVotePayload{}, false},
+	{TypeUndoVote, "Take back a vote on one choice in a yes/no session.", UndoVotePayload{}, false},
+	{TypeResolveTie, "Host only: order tied choices when the session breaks ties by hand.", ResolveTiePayload{}, false},
+}
+
+var outboundSpecs = []messageSpec{
+	{TypeAck, "A message from this connection was carried out.", AckMsg{}, true},
+	{TypeError, "A message from this connection was refused.", ErrorMsg{}, true},
+	{TypeSessionSnapshot, "The whole session, sent on connecting unless missed frames can be replayed.", SessionSnapshotMsg{}, true},
+	{TypeMemberJoined, "A member joined the session.", MemberJoinedMsg{}, false},
+	{TypeMemberLeft, "A member left the session.", MemberLeftMsg{}, false},
+	{TypeMemberReady, "A member became ready, or stopped being ready.", MemberReadyMsg{}, false},
+	{TypePhaseChanged, "The session moved to another phase.", PhaseChangedMsg{}, false},
+	{TypeConnectedUsers, "The members connected to the session, sent on connecting.", ConnectedUsersMsg{}, true},
+	{TypeMemberSubmitted, "A member submitted their choices.", MemberSubmittedMsg{}, false},
+	{TypeMemberVoted, "A member finished voting.", MemberVotedMsg{}, false},
+	{TypeMemberUnsubmitted, "A member took back their choices or votes.", MemberUnsubmittedMsg{}, false},
+	{TypeMemberNameChanged, "A member changed their name.", MemberNameChangedMsg{}, false},
+	{TypeSessionClosed, "The session was closed.", SessionClosedMsg{}, false},
+	{TypeConfigUpdated, "The host changed the session's config.", ConfigUpdatedMsg{}, false},
+	{TypeHostChanged, "Another member became host.", HostChangedMsg{}, false},
+	{TypeForceStartCountdown, "Seconds left before a force start, or that it was cancelled.", ForceStartCountdownMsg{}, false},
+	{TypeGraceCountdown, "Seconds left in the grace period, or that it was cancelled.", GraceCountdownMsg{}, false},
+	{TypeTieDetected, "Sent to the host: tied choices need ordering, again on connecting while they still do.", TieDetectedMsg{}, false},
+	{TypeChoiceAdded, "A choice was proposed.", ChoiceMsg{}, false},
+	{TypeChoiceUpdated, "A choice was edited, or its proposers changed.", ChoiceMsg{}, false},
+	{TypeChoiceRemoved, "A choice was dropped by everyone who proposed it.", ChoiceRemovedMsg{}, false},
+	{TypeVoteCast, "Sent to the member: a vote they cast on one choice was saved.", VoteCastMsg{}, false},
+	{TypeVotingProgress, "How far along voting is.", VotingProgressMsg{}, false},
+}
+
+// AsyncAPI returns the AsyncAPI document describing the protocol
+func AsyncAPI() map[string]any {
+	g := schemaGen{schemas: map[string]any{}}
+	messages := map[string]any{}
+
+	var publish, subscribe []any
+	for _, spec := range inboundSpecs {
+		properties := map[string]any{
+			"v":    map[string]any{"const": PROTOCOL_VERSION, "default": PROTOCOL_VERSION},
+			"id":   map[string]any{"type": "string", "description": "Echoed in the ack or error answering the message."},
+			"type": map[string]any{"const": spec.Type},
+		}
+		required := []string{"type"}
+		if spec.Payload != nil {
+			properties["payload"] = g.schema(reflect.TypeOf(spec.Payload), true)
+			required = append(required, "payload")
+		}
+		messages[spec.Type] = message(spec, map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		})
+		publish = append(publish, map[string]any{"$ref": "#/components/messages/" + spec.Type})
+	}
+
+	for _, spec := range outboundSpecs {
+		payload := g.schema(reflect.TypeOf(spec.Payload), true)
+		properties := payload["properties"].(map[string]any)
+		properties["type"] = map[string]any{"const": spec.Type}
+		if !spec.Direct {
+			properties["seq"] = map[string]any{"type": "integer", "description": "Frame number, to reconnect from with ?since."}
+			payload["required"] = append(payload["required"].([]string), "seq")
+		}
+		messages[spec.Type] = message(spec, payload)
+		subscribe = append(subscribe, map[string]any{"$ref": "#/components/messages/" + spec.Type})
+	}
+
+	return map[string]any{
+		"asyncapi": "2.6.0",
+		"info": map[string]any{
+			"title":   "Consensus session WebSocket",
+			"version": "1",
+			"description": "Clients send messages in an envelope carrying the protocol version and an id of " +
+				"their choosing. Each message is answered on the same connection by an ack or an error " +
+				"with the same id. Other server messages are numbered by seq and can be replayed on reconnect.",
+		},
+		"channels": map[string]any{
+			"/api/session/{code}/ws": map[string]any{
+				"parameters": map[string]any{
+					"code": map[string]any{"schema": map[string]any{"type": "string"}},
+				},
+				"bindings": map[string]any{
+					"ws": map[string]any{
+						"query": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"token": map[string]any{"type": "string", "description": "Member token."},
+								"since": map[string]any{"type": "integer", "description": "Last seq seen, to replay what was missed."},
+							},
+							"required": []string{"token"},
+						},
+					},
+				},
+				"publish":   map[string]any{"message": map[string]any{"oneOf": publish}},
+				"subscribe": map[string]any{"message": map[string]any{"oneOf": subscribe}},
+			},
+		},
+		"components": map[string]any{
+			"messages": messages,
+			"schemas":  g.schemas,
+		},
+	}
+}
+
+func message(spec messageSpec, payload map[string]any) map[string]any {
+	return map[string]any{
+		"name":    spec.Type,
+		"summary": spec.Summary,
+		"payload": payload,
+	}
+}
+
+// schemaGen builds JSON schemas for Go types, collecting named types from other
+// packages as component schemas
+type schemaGen struct {
+	schemas map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema describes t. Structs are inlined when inline is set and referenced by name
+// otherwise.
+func (g *schemaGen) schema(t reflect.Type, inline bool) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return map[string]any{"oneOf": []any{g.schema(t.Elem(), false), map[string]any{"type": "null"}}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem(), false)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem(), false)}
+	case reflect.Struct:
+		if inline {
+			return g.object(t)
+		}
+		name := t.Name()
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // placeholder, for types that contain themselves
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type, false)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
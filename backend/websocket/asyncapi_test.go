@@ -0,0 +1,33 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate asyncapi.json")
+
+func TestAsyncAPIIsUpToDate(t *testing.T) {
+	doc, err := json.MarshalIndent(AsyncAPI(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = append(doc, '\n')
+
+	if *update {
+		if err := os.WriteFile("asyncapi.json", doc, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	saved, err := os.ReadFile("asyncapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, doc) {
+		t.Error("asyncapi.json is out of date, regenerate it with -update")
+	}
+}
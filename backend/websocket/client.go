@@ -1,7 +1,9 @@
 package websocket
 
 import (
+	"consensus/models"
 	"encoding/json"
+	"fmt"
 	"log"
 	"time"
 
@@ -20,25 +22,47 @@ type Client struct {
 	conn        *websocket.Conn
 	send        chan []byte
 	sessionCode string
+	memberID    string
 	memberName  string
 	host        bool
+	phase       string
+	config      models.SessionConfig
+	ready       bool
 	submitted   bool
 	voted       bool
+	emptyVoter  bool              // can't vote, having proposed no choices
+	countdown   *models.Countdown // saved countdown the session had when the client connected
+	since       uint64            // last frame a reconnecting client saw, zero for a new one
+	session     *models.Session   // as loaded when the client connected, for its snapshot
+	progress    voteProgress      // saved cards voted on this round
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, sessionCode, memberName string) *Client {
+// targeted reports whether a frame sent to target is for the client, see session.send
+func (c *Client) targeted(target string) bool {
+	switch target {
+	case "":
+		return true
+	case "host":
+		return c.host
+	default:
+		return c.memberID == target
+	}
+}
+
+func NewClient(hub *Hub, conn *websocket.Conn, sessionCode, memberID, memberName string) *Client {
 	return &Client{
 		hub:         hub,
 		conn:        conn,
 		send:        make(chan []byte, 256),
 		sessionCode: sessionCode,
+		memberID:    memberID,
 		memberName:  memberName,
 	}
 }
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.Unregister(c)
 		c.conn.Close()
 	}()
 
@@ -62,30 +86,86 @@ func (c *Client) readPump() {
 	}
 }
 
+// handleMessage carries out a message from the client and answers it with an ack
+// or an error
 func (c *Client) handleMessage(message []byte) {
-	var msg InboundMessage
-	if err := json.Unmarshal(message, &msg); err != nil {
-		log.Printf("invalid message from %s: %v", c.memberName, err)
+	var env Envelope
+	if err := json.Unmarshal(message, &env); err != nil {
+		c.hub.reply(c, env, &ProtocolError{CodeBadRequest, fmt.Sprintf("invalid message: %v", err)})
+		return
+	}
+	if env.V != 0 && env.V != PROTOCOL_VERSION {
+		c.hub.reply(c, env, &ProtocolError{CodeUnsupportedVersion, fmt.Sprintf("protocol version %d is not supported", env.V)})
 		return
 	}
 
-	switch msg.Type {
+	// Frames from before the envelope carry their fields alongside the type
+	payload := env.Payload
+	if payload == nil {
+		payload = message
+	}
+
+	err := c.dispatch(env.Type, payload)
+	if err != nil {
+		log.Printf("refused %s from %s in session %s: %v", env.Type, c.memberName, c.sessionCode, err)
+	}
+	c.hub.reply(c, env, err)
+}
+
+func (c *Client) dispatch(msgType string, payload json.RawMessage) error {
+	switch msgType {
 	case TypeSetReady:
-		c.hub.SetReady(c.sessionCode, c.memberName, msg.Ready)
+		var p SetReadyPayload
+		if err := decodePayload(payload, &p); err != nil {
+			return err
+		}
+		return c.hub.SetReady(c.sessionCode, c.memberID, p.Ready)
 	case TypeSubmitChoices:
-		c.hub.SubmitChoices(c.sessionCode, c.memberName)
-	case TypeSubmitVotes:
-		c.hub.SubmitVotes(c.sessionCode, c.memberName)
+		return c.hub.SubmitChoices(c.sessionCode, c.memberID)
+	case TypeUnsubmit:
+		return c.hub.Unsubmit(c.sessionCode, c.memberID)
 	case TypeForceStart:
-		if c.host {
-			c.hub.ForceStart(c.sessionCode)
+		if !c.host {
+			return errHostOnly
 		}
+		return c.hub.ForceStart(c.sessionCode)
 	case TypeCancelForceStart:
-		if c.host {
-			c.hub.CancelForceStart(c.sessionCode)
+		if !c.host {
+			return errHostOnly
+		}
+		return c.hub.CancelForceStart(c.sessionCode)
+	case TypeCastVote:
+		var p CastVotePayload
+		if err := decodePayload(payload, &p); err != nil {
+			return err
+		}
+		if p.ChoiceID == "" || p.Value == nil {
+			return &ProtocolError{CodeBadRequest, "choiceID and value are required"}
+		}
+		return c.hub.CastVote(c.sessionCode, c.memberID, p.ChoiceID, p.Value)
+	case TypeUndoVote:
+		var p UndoVotePayload
+		if err := decodePayload(payload, &p); err != nil {
+			return err
+		}
+		if p.ChoiceID == "" {
+			return &ProtocolError{CodeBadRequest, "choiceID is required"}
+		}
+		return c.hub.CastVote(c.sessionCode, c.memberID, p.ChoiceID, nil)
+	case TypeResolveTie:
+		if !c.host {
+			return errHostOnly
+		}
+		var p ResolveTiePayload
+		if err := decodePayload(payload, &p); err != nil {
+			return err
+		}
+		if len(p.Order) == 0 {
+			return &ProtocolError{CodeBadRequest, "order is required"}
 		}
+		return c.hub.ResolveTie(c.sessionCode, p.Order)
 	default:
-		log.Printf("unknown message type from %s: %s", c.memberName, msg.Type)
+		return &ProtocolError{CodeUnknownType, fmt.Sprintf("unknown message type %q", msgType)}
 	}
 }
 
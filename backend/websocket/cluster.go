@@ -0,0 +1,402 @@
+package websocket
+
+import (
+	"consensus/backplane"
+	"consensus/models"
+	"consensus/phase"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Hubs on different backend instances share sessions over the backplane. Frames sent
+// to clients are published for every instance to deliver to its own connections, and
+// changes to a session's hub state are published so the others keep the same view of
+// who is connected, who is ready, which phase the session is in and whether a
+// countdown is running. Each instance is the authority on its own connections, and
+// whichever instance handles an action decides what follows from it, such as starting
+// a countdown; the others apply the change without acting on it. Instances heartbeat,
+// and one that goes quiet has its members and countdowns taken over, see Hub.expire.
+
+// How often each instance tells the others it's still there, and how long one can go
+// without doing so before they take over its members and countdowns
+const (
+	HEARTBEAT_INTERVAL = 5 * time.Second
+	PEER_TIMEOUT       = 3 * HEARTBEAT_INTERVAL
+)
+
+// Ops of a stateChange
+const (
+	opSync       = "sync"      // asks other instances to announce their members
+	opHeartbeat  = "heartbeat" // the publishing instance is still there
+	opExpire     = "expire"    // an instance stopped heartbeating, see Hub.expire
+	opJoin       = "join"
+	opLeave      = "leave"
+	opReady      = "ready"
+	opSubmitted  = "submitted"
+	opVoted      = "voted"
+	opEmptyVoter = "emptyVoter" // can't vote, having proposed no choices
+	opProgress   = "progress"   // cards voted on so far
+	opRunoff     = "runoff"     // everyone's votes cleared for a new round
+	opPhase      = "phase"
+	opConfig     = "config"
+	opCountdown  = "countdown"
+	opClosed     = "closed"
+	opHost       = "host"
+	opRename     = "rename"
+)
+
+type stateChange struct {
+	Op         string                `json:"op"`
+	MemberID   string                `json:"memberID,omitempty"`
+	Name       string                `json:"name,omitempty"`
+	Value      bool                  `json:"value,omitempty"`
+	Ready      bool                  `json:"ready,omitempty"`      // join only
+	Submitted  bool                  `json:"submitted,omitempty"`  // join only
+	Voted      bool                  `json:"voted,omitempty"`      // join only
+	EmptyVoter bool                  `json:"emptyVoter,omitempty"` // join only
+	Host       bool                  `json:"host,omitempty"`       // join only
+	Cast       int                   `json:"cast,omitempty"`       // progress and join
+	Total      int                   `json:"total,omitempty"`      // progress and join
+	Phase      string                `json:"phase,omitempty"`
+	Action     string                `json:"action,omitempty"`    // what a countdown is counting down to
+	Countdown  *models.Countdown     `json:"countdown,omitempty"` // a countdown as saved, when it starts
+	Instance   string                `json:"instance,omitempty"`  // expire only
+	Config     *models.SessionConfig `json:"config,omitempty"`
+}
+
+// joinBackplane starts exchanging messages with the hubs on other instances
+func (h *Hub) joinBackplane() {
+	// Frames are numbered by the backplane from here on
+	h.seq.Store(0)
+	msgs, err := h.Backplane.Subscribe(context.Background())
+	if err != nil {
+		log.Fatalf("backplane: failed to subscribe: %v", err)
+	}
+
+	go func() {
+		for msg := range h.outbox {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := h.Backplane.Publish(ctx, msg); err != nil {
+				log.Printf("backplane: failed to publish to session %s: %v", msg.Session, err)
+			}
+			cancel()
+		}
+	}()
+
+	go func() {
+		for msg := range msgs {
+			h.receive(msg)
+		}
+	}()
+
+	go h.heartbeat()
+
+	// Learn about sessions with members on other instances
+	h.publishState("", stateChange{Op: opSync})
+}
+
+// heartbeat tells other instances this one is still there, and gives up on those
+// that have stopped saying so
+func (h *Hub) heartbeat() {
+	ticker := time.NewTicker(h.heartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.publishState("", stateChange{Op: opHeartbeat})
+
+		h.peersMu.Lock()
+		var silent []string
+		for instance, last := range h.peers {
+			if time.Since(last) > h.peerTimeout {
+				silent = append(silent, instance)
+				delete(h.peers, instance)
+			}
+		}
+		h.peersMu.Unlock()
+
+		for _, instance := range silent {
+			log.Printf("backplane: instance %s stopped heartbeating", instance)
+			h.publishState("", stateChange{Op: opExpire, Instance: instance})
+		}
+	}
+}
+
+func (h *Hub) publish(msg backplane.Message) {
+	if h.Backplane == nil {
+		return
+	}
+	msg.Origin = h.instance
+	h.outbox <- msg
+}
+
+func (h *Hub) publishState(sessionCode string, change stateChange) {
+	if h.Backplane == nil {
+		return
+	}
+	data, err := json.Marshal(change)
+	if err != nil {
+		log.Printf("failed to marshal state change: %v", err)
+		return
+	}
+	h.publish(backplane.Message{Session: sessionCode, State: data})
+}
+
+func (s *session) publishState(change stateChange) {
+	s.hub.publishState(s.code, change)
+}
+
+// receive handles a message from the backplane. Frames are delivered whichever
+// instance sent them, while this instance's own state changes are already applied,
+// other than those for every session. Either way the message is handed to the
+// session's loop, in the order received.
+func (h *Hub) receive(msg backplane.Message) {
+	for seen := h.seq.Load(); msg.Seq > seen && !h.seq.CompareAndSwap(seen, msg.Seq); {
+		seen = h.seq.Load()
+	}
+
+	var change *stateChange
+	if msg.State != nil && (msg.Origin != h.instance || msg.Session == "") {
+		change = new(stateChange)
+		if err := json.Unmarshal(msg.State, change); err != nil {
+			log.Printf("backplane: invalid state change for session %s: %v", msg.Session, err)
+			return
+		}
+		if msg.Session == "" {
+			h.receiveInstance(msg.Origin, *change)
+			return
+		}
+	}
+	if msg.Frame == nil && change == nil {
+		return
+	}
+
+	// Joins bring sessions here; anything else for a session nobody here knows about
+	// is for other instances
+	join := change != nil && change.Op == opJoin
+	h.post(msg.Session, join, func(s *session) {
+		if msg.Frame != nil {
+			s.record(msg.Target, msg.Seq, msg.Frame)
+		}
+		if change != nil {
+			s.apply(msg.Origin, *change)
+		}
+	})
+}
+
+// receiveInstance handles a change for every session
+func (h *Hub) receiveInstance(origin string, change stateChange) {
+	switch change.Op {
+	case opSync:
+		if origin != h.instance {
+			h.announce("")
+		}
+	case opHeartbeat:
+		if origin != h.instance {
+			h.peersMu.Lock()
+			h.peers[origin] = time.Now()
+			h.peersMu.Unlock()
+		}
+	case opExpire:
+		h.expire(change.Instance, origin)
+	}
+}
+
+// expire takes over from an instance that stopped heartbeating. Every instance that
+// notices publishes an expire, and every instance applies the first to arrive alike:
+// the one that published it, the taker, treats the gone instance's members as
+// disconnected and picks up its countdowns from where they were saved. Later expires
+// find nothing left to take over. An instance that finds itself given up on, having
+// only been cut off for a while, announces its members again and leaves its
+// countdowns to the taker.
+func (h *Hub) expire(gone, taker string) {
+	h.peersMu.Lock()
+	delete(h.peers, gone)
+	h.peersMu.Unlock()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, s := range h.sessions {
+		s.events.push(func() { s.expire(gone, taker) })
+	}
+}
+
+func (s *session) expire(gone, taker string) {
+	if !s.tracked {
+		return
+	}
+	if gone == s.hub.instance {
+		s.announce()
+	}
+	taking := taker == s.hub.instance
+	for memberID, owner := range s.owners {
+		if owner != gone {
+			continue
+		}
+		delete(s.owners, memberID)
+		if taking && !s.connected(memberID) {
+			s.leaveLater(memberID, s.host == memberID)
+		}
+	}
+	s.takeOver(&s.forceStartStop, &s.forceStartRun, gone, taker)
+	s.takeOver(&s.graceStop, &s.graceRun, gone, taker)
+}
+
+// takeOver hands a countdown the gone instance was running to the taker, which
+// resumes it with the time it has left, or ends it if the session has moved on
+func (s *session) takeOver(stop *chan struct{}, run *countdownRun, gone, taker string) {
+	if *stop == nil || run.owner != gone {
+		return
+	}
+	if taker != s.hub.instance {
+		if gone == s.hub.instance {
+			// Cut off for a while: stop counting down, leaving it to the taker
+			close(*stop)
+			*stop = make(chan struct{})
+		}
+		run.owner = taker
+		return
+	}
+
+	countdown := run.Countdown
+	close(*stop)
+	*stop = nil
+	s.resumeCountdown(&countdown)
+	if *stop == nil {
+		s.publishState(stateChange{Op: opCountdown, Action: countdown.Action})
+		s.saveCountdown(nil)
+	}
+}
+
+// apply applies a change from the origin instance to the session's state
+func (s *session) apply(origin string, change stateChange) {
+	if change.Op == opJoin {
+		s.track(change.Phase)
+		s.stay(change.MemberID) // reconnected to another instance
+		s.names[change.MemberID] = change.Name
+		s.owners[change.MemberID] = origin
+		if change.Host {
+			s.host = change.MemberID
+		}
+		s.ready[change.MemberID] = change.Ready
+		s.submitted[change.MemberID] = change.Submitted
+		s.voted[change.MemberID] = change.Voted
+		if change.EmptyVoter {
+			s.emptyVoters[change.MemberID] = true
+		}
+		if change.Total > 0 {
+			s.restoreProgress(change.MemberID, voteProgress{change.Cast, change.Total})
+		}
+		return
+	}
+
+	if !s.tracked {
+		return // nobody here knows about the session
+	}
+	_, member := s.names[change.MemberID]
+
+	switch change.Op {
+	case opLeave:
+		if member && s.connected(change.MemberID) {
+			s.publishJoin(change.MemberID) // still here, so others shouldn't forget them
+		} else if member {
+			s.forgetMember(change.MemberID)
+		}
+	case opReady:
+		if member {
+			s.ready[change.MemberID] = change.Value
+		}
+	case opSubmitted:
+		if member {
+			s.submitted[change.MemberID] = change.Value
+		}
+	case opVoted:
+		if member {
+			s.voted[change.MemberID] = change.Value
+		}
+	case opEmptyVoter:
+		if member {
+			s.emptyVoters[change.MemberID] = true
+		}
+	case opProgress:
+		if member {
+			s.restoreProgress(change.MemberID, voteProgress{change.Cast, change.Total})
+		}
+	case opRunoff:
+		s.startRunoff()
+	case opPhase:
+		s.phase = change.Phase
+	case opConfig:
+		if change.Config != nil {
+			s.config = *change.Config
+		}
+	case opCountdown:
+		stop, run := &s.graceStop, &s.graceRun
+		if phase.Action(change.Action) == phase.ForceStart {
+			stop, run = &s.forceStartStop, &s.forceStartRun
+		}
+		if change.Value {
+			// Counts down on the instance that started it; this only marks it running
+			if *stop == nil {
+				*stop = make(chan struct{})
+			}
+			if change.Countdown != nil {
+				*run = countdownRun{origin, *change.Countdown}
+			}
+		} else if *stop != nil {
+			close(*stop)
+			*stop = nil
+		}
+	case opClosed:
+		s.closed = true
+	case opHost:
+		s.host = change.MemberID
+		for client := range s.clients {
+			if client.memberID == change.MemberID {
+				client.host = true
+			}
+		}
+	case opRename:
+		if member {
+			s.rename(change.MemberID, change.Name)
+		}
+	}
+}
+
+// announce publishes the members connected to this instance, in one session or
+// every session when sessionCode is empty
+func (h *Hub) announce(sessionCode string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for code, s := range h.sessions {
+		if sessionCode == "" || code == sessionCode {
+			s.events.push(s.announce)
+		}
+	}
+}
+
+func (s *session) announce() {
+	announced := make(map[string]bool)
+	for client := range s.clients {
+		if !announced[client.memberID] {
+			announced[client.memberID] = true
+			s.publishJoin(client.memberID)
+		}
+	}
+}
+
+func (s *session) publishJoin(memberID string) {
+	s.publishState(stateChange{
+		Op:         opJoin,
+		MemberID:   memberID,
+		Name:       s.names[memberID],
+		Ready:      s.ready[memberID],
+		Submitted:  s.submitted[memberID],
+		Voted:      s.voted[memberID],
+		EmptyVoter: s.emptyVoters[memberID],
+		Host:       s.host == memberID,
+		Cast:       s.progress[memberID].cast,
+		Total:      s.progress[memberID].total,
+		Phase:      s.phase,
+	})
+}
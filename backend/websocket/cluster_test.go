@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"consensus/backplane"
+	"consensus/phase"
+	"context"
+	"testing"
+	"time"
+)
+
+func testClient(hub *Hub, memberID, name string) *Client {
+	return &Client{
+		hub:         hub,
+		send:        make(chan []byte, 64),
+		sessionCode: "abc",
+		memberID:    memberID,
+		memberName:  name,
+		phase:       phase.Lobby,
+	}
+}
+
+// waitForMembers waits until a hub sees n members of the session
+func waitForMembers(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hub.GetConnectedMembers("abc")) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d members, got %v", n, hub.GetConnectedMembers("abc"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHubsShareSessionsOverBackplane(t *testing.T) {
+	bp := backplane.NewMemory()
+	started := make(chan string, 2)
+
+	a, b := NewHub(), NewHub()
+	for _, hub := range []*Hub{a, b} {
+		hub.Backplane = bp
+		hub.disconnectGrace = 10 * time.Millisecond
+		hub.OnAllReady = func(sessionCode string) { started <- sessionCode }
+		go hub.Run()
+	}
+
+	alice := testClient(a, "m1", "Alice")
+	alice.host = true
+	a.Register(alice)
+	waitForMembers(t, b, 1)
+
+	bob := testClient(b, "m2", "Bob")
+	b.Register(bob)
+	waitForMembers(t, a, 2)
+
+	// Frames reach clients on the other instance
+	b.SendToHost("abc", ErrorMsg{Type: TypeError, Message: "for the host"})
+	if msg := nextMsg(t, alice, TypeError); msg["message"] != "for the host" {
+		t.Errorf("expected the host on a to get b's message, got %v", msg)
+	}
+
+	// Readiness on one instance counts towards the other's check
+	a.SetReady("abc", "m1", true)
+	if msg := nextMsg(t, bob, TypeMemberReady); msg["memberName"] != "Alice" {
+		t.Errorf("expected Bob to see Alice ready, got %v", msg)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !b.GetReadyState("abc")["Alice"] {
+		if time.Now().After(deadline) {
+			t.Fatal("expected b to learn Alice is ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.SetReady("abc", "m2", true)
+
+	nextMsg(t, alice, TypePhaseChanged)
+	if code := <-started; code != "abc" {
+		t.Errorf("expected voting to start for abc, got %s", code)
+	}
+	select {
+	case <-started:
+		t.Error("expected only one instance to start voting")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The host leaving hands over to a member on the other instance
+	a.Unregister(alice)
+	if msg := nextMsg(t, bob, TypeHostChanged); msg["newHost"] != "Bob" {
+		t.Errorf("expected Bob to become host, got %v", msg)
+	}
+	waitForMembers(t, b, 1)
+}
+
+// severable connects a hub to a backplane until it is cut, after which the hub hears
+// nothing and nothing it publishes gets through, as if its instance had died
+type severable struct {
+	backplane.Backplane
+	ctx context.Context
+	cut context.CancelFunc
+}
+
+func sever(bp backplane.Backplane) *severable {
+	ctx, cut := context.WithCancel(context.Background())
+	return &severable{Backplane: bp, ctx: ctx, cut: cut}
+}
+
+func (s *severable) Publish(ctx context.Context, msg backplane.Message) error {
+	if s.ctx.Err() != nil {
+		return nil
+	}
+	return s.Backplane.Publish(ctx, msg)
+}
+
+func (s *severable) Subscribe(ctx context.Context) (<-chan backplane.Message, error) {
+	return s.Backplane.Subscribe(s.ctx)
+}
+
+func TestHubTakesOverFromGoneInstance(t *testing.T) {
+	bp := backplane.NewMemory()
+	started := make(chan string, 1)
+
+	a, b := NewHub(), NewHub()
+	link := sever(bp)
+	a.Backplane, b.Backplane = link, bp
+	for _, hub := range []*Hub{a, b} {
+		hub.disconnectGrace = 10 * time.Millisecond
+		hub.heartbeatInterval = 10 * time.Millisecond
+		hub.peerTimeout = 50 * time.Millisecond
+		go hub.Run()
+	}
+	b.OnAllReady = func(sessionCode string) { started <- sessionCode }
+
+	alice := testClient(a, "m1", "Alice")
+	alice.host = true
+	a.Register(alice)
+	waitForMembers(t, b, 1)
+	bob := testClient(b, "m2", "Bob")
+	b.Register(bob)
+	waitForMembers(t, a, 2)
+
+	a.ForceStart("abc")
+	if msg := nextMsg(t, bob, TypeForceStartCountdown); msg["countdown"] != 3.0 {
+		t.Fatalf("expected the countdown to start, got %v", msg)
+	}
+
+	// a dies mid-countdown: b lets its members go and finishes the countdown
+	link.cut()
+	if msg := nextMsg(t, bob, TypeHostChanged); msg["newHost"] != "Bob" {
+		t.Errorf("expected Bob to become host, got %v", msg)
+	}
+	waitForMembers(t, b, 1)
+	select {
+	case code := <-started:
+		if code != "abc" {
+			t.Errorf("expected voting to start for abc, got %s", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected b to take over the countdown and start voting")
+	}
+	if msg := nextMsg(t, bob, TypePhaseChanged); msg["phase"] != phase.Voting {
+		t.Errorf("expected voting to start, got %v", msg)
+	}
+}
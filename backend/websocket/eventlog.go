@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"sort"
+	"strconv"
+)
+
+// How many recent frames each session keeps for clients catching up after a reconnect
+const EVENT_LOG_SIZE = 256
+
+type logEntry struct {
+	seq    uint64
+	target string // as given to session.send
+	frame  []byte
+}
+
+// eventLog holds the latest frames sent to a session's clients, in sequence order
+type eventLog struct {
+	entries []logEntry
+	floor   uint64 // frames numbered up to here may be missing from the log
+}
+
+func newEventLog(floor uint64) *eventLog {
+	return &eventLog{floor: floor}
+}
+
+func (l *eventLog) append(entry logEntry) {
+	if len(l.entries) == EVENT_LOG_SIZE {
+		l.floor = l.entries[0].seq
+		l.entries = append(l.entries[:0], l.entries[1:]...)
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func (l *eventLog) last() uint64 {
+	if len(l.entries) == 0 {
+		return l.floor
+	}
+	return l.entries[len(l.entries)-1].seq
+}
+
+// since returns the frames sent after seq. It reports false if some of them are no
+// longer in the log, or seq is from a log this one doesn't continue, such as one kept
+// before a restart.
+func (l *eventLog) since(seq uint64) ([]logEntry, bool) {
+	if seq < l.floor || seq > l.last() {
+		return nil, false
+	}
+	i := sort.Search(len(l.entries), func(i int) bool { return l.entries[i].seq > seq })
+	return l.entries[i:], true
+}
+
+// withSeq numbers a frame by adding a seq field to its JSON object
+func withSeq(frame []byte, seq uint64) []byte {
+	out := make([]byte, 0, len(frame)+28)
+	out = append(out, `{"seq":`...)
+	out = strconv.AppendUint(out, seq, 10)
+	if len(frame) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, frame[1:]...)
+}
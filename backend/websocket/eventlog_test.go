@@ -0,0 +1,33 @@
+package websocket
+
+import "testing"
+
+func TestEventLogSince(t *testing.T) {
+	l := newEventLog(10)
+	if _, ok := l.since(10); !ok {
+		t.Error("expected a client up to date with an empty log to be caught up")
+	}
+
+	for seq := uint64(11); seq < 11+EVENT_LOG_SIZE+5; seq++ {
+		l.append(logEntry{seq: seq})
+	}
+	entries, ok := l.since(l.last() - 2)
+	if !ok || len(entries) != 2 || entries[0].seq != l.last()-1 {
+		t.Errorf("expected the last two entries, got %v %v", entries, ok)
+	}
+	if _, ok := l.since(12); ok {
+		t.Error("expected frames that fell out of the log to need a resync")
+	}
+	if _, ok := l.since(l.last() + 1); ok {
+		t.Error("expected a number the log hasn't reached to need a resync")
+	}
+}
+
+func TestWithSeq(t *testing.T) {
+	if got := string(withSeq([]byte(`{"type":"x"}`), 7)); got != `{"seq":7,"type":"x"}` {
+		t.Errorf("got %s", got)
+	}
+	if got := string(withSeq([]byte(`{}`), 7)); got != `{"seq":7}` {
+		t.Errorf("got %s", got)
+	}
+}
@@ -1,11 +1,13 @@
 package websocket
 
 import (
+	"consensus/auth"
+	"consensus/phase"
 	"consensus/repository"
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,24 +25,44 @@ var upgrader = websocket.Upgrader{
 }
 
 type Handler struct {
-	hub  *Hub
-	repo *repository.SessionRepository
+	hub    *Hub
+	repo   *repository.SessionRepository
+	signer *auth.Signer
 }
 
-func NewHandler(hub *Hub, repo *repository.SessionRepository) *Handler {
+func NewHandler(hub *Hub, repo *repository.SessionRepository, signer *auth.Signer) *Handler {
 	return &Handler{
-		hub:  hub,
-		repo: repo,
+		hub:    hub,
+		repo:   repo,
+		signer: signer,
 	}
 }
 
-// HandleWebSocket handles GET /api/session/:code/ws?name=memberName
+// HandleWebSocket handles GET /api/session/:code/ws?token=memberToken&since=seq
+// The token goes in the query since browsers can't set headers on the handshake.
+// A reconnecting client passes the seq of the last frame it saw to be sent the ones
+// it missed.
 func (h *Handler) HandleWebSocket(c *gin.Context) {
 	sessionCode := strings.ToLower(c.Param("code"))
-	memberName := c.Query("name")
+	token := c.Query("token")
 
-	if memberName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name query parameter required"})
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token query parameter required"})
+		return
+	}
+
+	var since uint64
+	if s := c.Query("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since query parameter"})
+			return
+		}
+	}
+
+	claims, err := h.signer.Verify(token)
+	if err != nil || claims.Code != sessionCode {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid member token"})
 		return
 	}
 
@@ -60,20 +82,24 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 	}
 
 	// Validate member is in session and get their status
+	var memberName string
 	var memberInfo *struct {
 		found     bool
 		host      bool
+		ready     bool
 		submitted bool
 		voted     bool
 	}
 	for _, member := range session.Members {
-		if member.Name == memberName {
+		if member.ID == claims.MemberID {
+			memberName = member.Name
 			memberInfo = &struct {
 				found     bool
 				host      bool
+				ready     bool
 				submitted bool
 				voted     bool
-			}{found: true, host: member.Host, submitted: member.Submitted, voted: member.Voted}
+			}{found: true, host: member.Host, ready: member.Ready, submitted: member.Submitted, voted: member.Voted}
 			break
 		}
 	}
@@ -90,32 +116,28 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	client := NewClient(h.hub, conn, sessionCode, memberName)
+	client := NewClient(h.hub, conn, sessionCode, claims.MemberID, memberName)
 	client.host = memberInfo.host
+	client.phase = session.Phase
+	client.config = session.Config
+	client.ready = memberInfo.ready
 	client.submitted = memberInfo.submitted
 	client.voted = memberInfo.voted
+	client.emptyVoter = phase.Check(session.Phase, phase.SubmitVotes) == nil && !session.CanVote(claims.MemberID)
+	client.countdown = session.Countdown
+	client.since = since
+	client.session = session
+	client.progress.cast, client.progress.total = session.VoteProgress(claims.MemberID)
 	h.hub.Register(client)
 
-	// Send currently connected users to the newly connected client
-	// Note: Registration is async, so we need to ensure current user is included
-	connectedMembers := h.hub.GetConnectedMembers(sessionCode)
-	// Ensure the current member is in the list (in case registration hasn't completed yet)
-	found := false
-	for _, m := range connectedMembers {
-		if m == memberName {
-			found = true
-			break
-		}
-	}
-	if !found {
-		connectedMembers = append(connectedMembers, memberName)
-	}
-	syncMsg := ConnectedUsersMsg{
-		Type:    TypeConnectedUsers,
-		Members: connectedMembers,
-	}
-	if data, err := json.Marshal(syncMsg); err == nil {
-		client.send <- data
+	// A tie found while the host was away is still waiting on them. It's numbered like
+	// when it was first found, behind the client's snapshot.
+	if memberInfo.host && len(session.PendingTie) > 0 {
+		h.hub.SendToMember(sessionCode, claims.MemberID, TieDetectedMsg{
+			Type:    TypeTieDetected,
+			Policy:  session.Config.TieBreak,
+			Choices: session.PendingTie,
+		})
 	}
 
 	// Broadcast member joined to other clients in the session
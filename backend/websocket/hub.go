@@ -1,204 +1,268 @@
 package websocket
 
 import (
+	"consensus/backplane"
+	"consensus/models"
+	"consensus/phase"
+	"consensus/tally"
+	crand "crypto/rand"
 	"encoding/json"
 	"log"
-	"maps"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// How long the host's force start counts down for
+const FORCE_START_SECONDS = 3
+
+// How long a member can be disconnected before they're treated as having left. Phones
+// dropping Wi-Fi are usually back well within it.
+const DISCONNECT_GRACE = 10 * time.Second
+
+// Hub keeps the sessions with members connected to this instance, or to others on
+// the backplane. Each runs on its own loop, see session; the hub's lock only guards
+// which sessions there are.
 type Hub struct {
-	sessions       map[string]map[*Client]bool   // sessionCode → clients
-	ready          map[string]map[string]bool    // sessionCode → memberName → ready
-	submitted      map[string]map[string]bool    // sessionCode → memberName → submitted
-	voted          map[string]map[string]bool    // sessionCode → memberName → voted
-	closed         map[string]bool               // sessionCode → closed (skip host transfer)
-	forceStartStop map[string]chan struct{}       // sessionCode → cancel channel for force start countdown
-	register       chan *Client
-	unregister     chan *Client
-	mu             sync.RWMutex
-	OnAllReady          func(sessionCode string)
-	OnMemberSubmitted   func(sessionCode, memberName string)
-	OnAllSubmitted      func(sessionCode string)
-	OnMemberVoted       func(sessionCode, memberName string)
-	OnAllVoted          func(sessionCode string)
-	OnHostDisconnected  func(sessionCode, newHostName string)
+	sessions           map[string]*session      // sessionCode → session with a running loop
+	draining           map[string]chan struct{} // sessionCode → closed once a retired loop's hooks have run
+	mu                 sync.RWMutex
+	progressInterval   time.Duration
+	disconnectGrace    time.Duration
+	seq                atomic.Uint64 // latest frame number given out or seen
+	instance           string        // tells this instance's backplane messages apart
+	heartbeatInterval  time.Duration
+	peerTimeout        time.Duration
+	peersMu            sync.Mutex
+	peers              map[string]time.Time   // other instance → when its last heartbeat arrived
+	outbox             chan backplane.Message // published to other instances in order
+	started            chan struct{}          // closed once Run has set the hub up
+	Backplane          backplane.Backplane    // shares sessions with hubs on other instances, nil when running alone
+	OnAllReady         func(sessionCode string)
+	OnReadyChanged     func(sessionCode, memberID string, ready bool)
+	OnCountdown        func(sessionCode string, countdown *models.Countdown) // nil once it stops
+	OnMemberSubmitted  func(sessionCode, memberID string)
+	CheckSubmitChoices func(sessionCode, memberID string) error                                              // refuses a submission that breaks the session's choice limits; runs on the session's loop, so mustn't call back into the hub
+	SaveVote           func(sessionCode, memberID, choiceID string, value *int) (cast, total int, err error) // nil value takes the vote back
+	RunningTotals      func(sessionCode string) (map[string]tally.Breakdown, error)                          // votes so far by choice ID, for sessions showing live totals
+	OnAllSubmitted     func(sessionCode string)
+	OnAllVoted         func(sessionCode string)
+	OnMemberUnsubmit   func(sessionCode, memberID string, action phase.Action)
+	OnHostDisconnected func(sessionCode, newHostID string)
+	OnTieResolved      func(sessionCode string, order []string) error // refuses an order that isn't for the pending tie
 }
 
 func NewHub() *Hub {
-	return &Hub{
-		sessions:       make(map[string]map[*Client]bool),
-		ready:          make(map[string]map[string]bool),
-		submitted:      make(map[string]map[string]bool),
-		voted:          make(map[string]map[string]bool),
-		closed:         make(map[string]bool),
-		forceStartStop: make(map[string]chan struct{}),
-		register:       make(chan *Client),
-		unregister:     make(chan *Client),
+	h := &Hub{
+		sessions:          make(map[string]*session),
+		draining:          make(map[string]chan struct{}),
+		progressInterval:  VOTING_PROGRESS_INTERVAL,
+		disconnectGrace:   DISCONNECT_GRACE,
+		instance:          crand.Text(),
+		heartbeatInterval: HEARTBEAT_INTERVAL,
+		peerTimeout:       PEER_TIMEOUT,
+		peers:             make(map[string]time.Time),
+		outbox:            make(chan backplane.Message, 1024),
+		started:           make(chan struct{}),
 	}
+	// Frames sent before a restart have lower numbers, so clients passing them in
+	// are sent a snapshot instead
+	h.seq.Store(uint64(time.Now().UnixMicro()))
+	return h
 }
 
+// Run sets the hub up, joining the backplane if there is one. Clients are only
+// registered once it has.
 func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			if h.sessions[client.sessionCode] == nil {
-				h.sessions[client.sessionCode] = make(map[*Client]bool)
-				h.ready[client.sessionCode] = make(map[string]bool)
-				h.submitted[client.sessionCode] = make(map[string]bool)
-				h.voted[client.sessionCode] = make(map[string]bool)
-			}
-			h.sessions[client.sessionCode][client] = true
-			h.ready[client.sessionCode][client.memberName] = false
-			// Restore submitted/voted from DB state carried on the client
-			if client.submitted {
-				h.submitted[client.sessionCode][client.memberName] = true
-			} else if _, alreadyTracked := h.submitted[client.sessionCode][client.memberName]; !alreadyTracked {
-				h.submitted[client.sessionCode][client.memberName] = false
-			}
-			if client.voted {
-				h.voted[client.sessionCode][client.memberName] = true
-			} else if _, alreadyTracked := h.voted[client.sessionCode][client.memberName]; !alreadyTracked {
-				h.voted[client.sessionCode][client.memberName] = false
-			}
-			h.mu.Unlock()
-			log.Printf("client registered: %s in session %s", client.memberName, client.sessionCode)
-
-		case client := <-h.unregister:
-			var newHost string
-			sessionCode := client.sessionCode
-
-			h.mu.Lock()
-			if clients, ok := h.sessions[sessionCode]; ok {
-				if _, ok := clients[client]; ok {
-					delete(clients, client)
-					close(client.send)
-
-					// Broadcast member left
-					h.broadcastToSessionLocked(sessionCode, MemberLeftMsg{
-						Type:       TypeMemberLeft,
-						MemberName: client.memberName,
-					})
-
-					// If host disconnected and there are remaining clients, reassign host
-					if client.host && len(clients) > 0 && !h.closed[sessionCode] {
-						for c := range clients {
-							newHost = c.memberName
-							c.host = true
-							break
-						}
-						h.broadcastToSessionLocked(sessionCode, HostChangedMsg{
-							Type:    TypeHostChanged,
-							NewHost: newHost,
-						})
-					}
-
-					// Clean up ready, submitted, and voted state
-					delete(h.ready[sessionCode], client.memberName)
-					delete(h.submitted[sessionCode], client.memberName)
-					delete(h.voted[sessionCode], client.memberName)
-
-					// Clean up empty session
-					if len(clients) == 0 {
-						if stop, ok := h.forceStartStop[sessionCode]; ok {
-							close(stop)
-							delete(h.forceStartStop, sessionCode)
-						}
-						delete(h.sessions, sessionCode)
-						delete(h.ready, sessionCode)
-						delete(h.submitted, sessionCode)
-						delete(h.voted, sessionCode)
-						delete(h.closed, sessionCode)
-					}
-				}
-			}
-			h.mu.Unlock()
+	if h.Backplane != nil {
+		h.joinBackplane()
+	}
+	close(h.started)
+}
 
-			if newHost != "" && h.OnHostDisconnected != nil {
-				go h.OnHostDisconnected(sessionCode, newHost)
-			}
+// post queues fn on a session's loop, reporting false if the hub doesn't know the
+// session. With create set it starts a loop for a session it doesn't know.
+func (h *Hub) post(sessionCode string, create bool, fn func(s *session)) bool {
+	h.mu.RLock()
+	s, ok := h.sessions[sessionCode]
+	if ok {
+		s.events.push(func() { fn(s) })
+	}
+	h.mu.RUnlock()
+	if ok || !create {
+		return ok
+	}
 
-			log.Printf("client unregistered: %s from session %s", client.memberName, sessionCode)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok = h.sessions[sessionCode]; !ok {
+		s = newSession(h, sessionCode, h.draining[sessionCode])
+		delete(h.draining, sessionCode)
+		h.sessions[sessionCode] = s
+		go s.run()
+	}
+	s.events.push(func() { fn(s) })
+	return true
+}
+
+// do runs fn on a session's loop and waits for its result. It fails with
+// errNotTracked if the hub has no state for the session.
+func (h *Hub) do(sessionCode string, fn func(s *session) error) error {
+	done := make(chan error, 1)
+	posted := h.post(sessionCode, false, func(s *session) {
+		if !s.tracked {
+			done <- errNotTracked
+			return
 		}
+		done <- fn(s)
+	})
+	if !posted {
+		return errNotTracked
+	}
+	return <-done
+}
+
+// retire stops a dropped session's loop once it has nothing queued. Anything posted
+// for the session later starts a new one, whose hooks wait for this loop's to have
+// run. Called on the session's loop.
+func (h *Hub) retire(s *session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.events.empty() && h.sessions[s.code] == s {
+		delete(h.sessions, s.code)
+		h.draining[s.code] = s.drained
+		s.events.close()
+	}
+}
+
+// forget stops a new loop for a retired session waiting on its hooks, which have run
+func (h *Hub) forget(s *session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining[s.code] == s.drained {
+		delete(h.draining, s.code)
 	}
 }
 
 func (h *Hub) Register(client *Client) {
-	h.register <- client
+	<-h.started
+	h.post(client.sessionCode, true, func(s *session) { s.register(client) })
+}
+
+// Unregister drops a client whose connection has closed
+func (h *Hub) Unregister(client *Client) {
+	h.post(client.sessionCode, false, func(s *session) { s.unregister(client) })
 }
 
 func (h *Hub) BroadcastToSession(sessionCode string, msg any) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	h.broadcastToSessionLocked(sessionCode, msg)
+	h.sendTo(sessionCode, "", msg)
 }
 
-// Must hold at least read lock
-func (h *Hub) broadcastToSessionLocked(sessionCode string, msg any) {
-	clients, ok := h.sessions[sessionCode]
-	if !ok {
-		return
+// SendToHost sends a message to the session's host, if they are connected
+func (h *Hub) SendToHost(sessionCode string, msg any) {
+	h.sendTo(sessionCode, "host", msg)
+}
+
+// SendToMember sends a message to every connection a member has open
+func (h *Hub) SendToMember(sessionCode, memberID string, msg any) {
+	h.sendTo(sessionCode, memberID, msg)
+}
+
+func (h *Hub) sendTo(sessionCode, target string, msg any) {
+	posted := h.post(sessionCode, false, func(s *session) { s.send(target, msg) })
+	if !posted && h.Backplane != nil {
+		// Nobody here knows the session, but its members may be on another instance
+		newSession(h, sessionCode, nil).send(target, msg)
 	}
+}
 
+// reply answers a client's message with an ack, or with an error if err is set.
+// Replies go to the one connection that sent the message and aren't numbered, as
+// there's nothing to replay them to.
+func (h *Hub) reply(client *Client, env Envelope, err error) {
+	var msg any = AckMsg{Type: TypeAck, ID: env.ID, Action: env.Type}
+	if err != nil {
+		msg = ErrorMsg{
+			Type:    TypeError,
+			ID:      env.ID,
+			Action:  env.Type,
+			Code:    errorCode(err),
+			Message: err.Error(),
+		}
+	}
 	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Printf("failed to marshal message: %v", err)
+		log.Printf("failed to marshal reply: %v", err)
 		return
 	}
 
-	for client := range clients {
-		select {
-		case client.send <- data:
-		default:
-			// Buffer full, skip
-			log.Printf("client buffer full, skipping: %s", client.memberName)
+	h.post(client.sessionCode, false, func(s *session) {
+		if s.clients[client] {
+			s.push(client, data)
 		}
-	}
+	})
 }
 
-func (h *Hub) SetReady(sessionCode, memberName string, ready bool) {
-	h.mu.Lock()
+// SetPhase records a phase change made outside the hub, such as by a tally
+func (h *Hub) SetPhase(sessionCode, p string) {
+	h.post(sessionCode, false, func(s *session) {
+		if s.tracked {
+			s.setPhase(p)
+		}
+	})
+}
 
-	if _, ok := h.ready[sessionCode]; !ok {
-		h.mu.Unlock()
-		return
+func (s *session) setPhase(p string) {
+	s.phase = p
+	s.publishState(stateChange{Op: opPhase, Phase: p})
+}
+
+func (h *Hub) SetReady(sessionCode, memberID string, ready bool) error {
+	return h.do(sessionCode, func(s *session) error { return s.setReady(memberID, ready) })
+}
+
+func (s *session) setReady(memberID string, ready bool) error {
+	memberName := s.names[memberID]
+	if err := s.allowed(memberName, phase.SetReady); err != nil {
+		return err
 	}
 
-	h.ready[sessionCode][memberName] = ready
+	s.ready[memberID] = ready
+	s.publishState(stateChange{Op: opReady, MemberID: memberID, Value: ready})
+	if s.hub.OnReadyChanged != nil {
+		s.effect(func() { s.hub.OnReadyChanged(s.code, memberID, ready) })
+	}
 
 	// Broadcast ready status change
-	h.broadcastToSessionLocked(sessionCode, MemberReadyMsg{
+	s.broadcast(MemberReadyMsg{
 		Type:       TypeMemberReady,
 		MemberName: memberName,
 		Ready:      ready,
 	})
 
-	// Check if all members are ready
-	allReady := h.allReadyLocked(sessionCode)
-	if allReady {
-		h.broadcastToSessionLocked(sessionCode, PhaseChangedMsg{
+	// Check if all members are ready. Async sessions don't wait on whoever happens
+	// to be connected; the scheduler moves them on instead.
+	if s.allReady() && !s.config.Async {
+		s.stopForceStart()
+		s.setPhase(phase.Voting)
+		s.broadcast(PhaseChangedMsg{
 			Type:  TypePhaseChanged,
 			Phase: "voting",
-			Ready: h.copyReadyMapLocked(sessionCode),
+			Ready: s.readyByName(),
 		})
+		if s.hub.OnAllReady != nil {
+			s.effect(func() { s.hub.OnAllReady(s.code) })
+		}
 	}
-	h.mu.Unlock()
-
-	if allReady && h.OnAllReady != nil {
-		go h.OnAllReady(sessionCode)
-	}
+	return nil
 }
 
-// Must hold lock
-func (h *Hub) allReadyLocked(sessionCode string) bool {
-	readyMap, ok := h.ready[sessionCode]
-	if !ok || len(readyMap) == 0 {
+func (s *session) allReady() bool {
+	if len(s.ready) == 0 {
 		return false
 	}
-
-	for _, ready := range readyMap {
+	for _, ready := range s.ready {
 		if !ready {
 			return false
 		}
@@ -206,271 +270,482 @@ func (h *Hub) allReadyLocked(sessionCode string) bool {
 	return true
 }
 
-// Must hold lock
-func (h *Hub) copyReadyMapLocked(sessionCode string) map[string]bool {
+// readyByName is keyed by display name, which is how clients know each other
+func (s *session) readyByName() map[string]bool {
 	copy := make(map[string]bool)
-	maps.Copy(copy, h.ready[sessionCode])
+	for memberID, ready := range s.ready {
+		copy[s.names[memberID]] = ready
+	}
 	return copy
 }
 
 func (h *Hub) GetReadyState(sessionCode string) map[string]bool {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	return h.copyReadyMapLocked(sessionCode)
+	ready := make(map[string]bool)
+	h.do(sessionCode, func(s *session) error {
+		ready = s.readyByName()
+		return nil
+	})
+	return ready
 }
 
-func (h *Hub) SubmitChoices(sessionCode, memberName string) {
-	h.mu.Lock()
+func (h *Hub) SubmitChoices(sessionCode, memberID string) error {
+	return h.do(sessionCode, func(s *session) error { return s.submitChoices(memberID) })
+}
 
-	if _, ok := h.submitted[sessionCode]; !ok {
-		h.mu.Unlock()
-		return
+func (s *session) submitChoices(memberID string) error {
+	memberName := s.names[memberID]
+	if err := s.allowed(memberName, phase.SubmitChoices); err != nil {
+		return err
+	}
+	// Limits come after the phase, so a late submission is told the phase moved on
+	if s.hub.CheckSubmitChoices != nil {
+		if err := s.hub.CheckSubmitChoices(s.code, memberID); err != nil {
+			return err
+		}
 	}
 
-	h.submitted[sessionCode][memberName] = true
+	s.submitted[memberID] = true
+	s.publishState(stateChange{Op: opSubmitted, MemberID: memberID, Value: true})
+	if s.hub.OnMemberSubmitted != nil {
+		s.effect(func() { s.hub.OnMemberSubmitted(s.code, memberID) })
+	}
 
-	h.broadcastToSessionLocked(sessionCode, MemberSubmittedMsg{
+	s.broadcast(MemberSubmittedMsg{
 		Type:       TypeMemberSubmitted,
 		MemberName: memberName,
 	})
 
-	allDone := h.allSubmittedLocked(sessionCode)
-	h.mu.Unlock()
-
-	if h.OnMemberSubmitted != nil {
-		go h.OnMemberSubmitted(sessionCode, memberName)
-	}
-	if allDone && h.OnAllSubmitted != nil {
-		go h.OnAllSubmitted(sessionCode)
+	if s.allSubmitted() && !s.config.Async {
+		s.startGrace(phase.SubmitChoices, s.config.GracePeriodSeconds, s.hub.OnAllSubmitted)
 	}
+	return nil
 }
 
-// Must hold lock
-func (h *Hub) allSubmittedLocked(sessionCode string) bool {
-	submittedMap, ok := h.submitted[sessionCode]
-	if !ok || len(submittedMap) == 0 {
+func (s *session) allSubmitted() bool {
+	if len(s.submitted) == 0 {
 		return false
 	}
-	for _, s := range submittedMap {
-		if !s {
+	for _, submitted := range s.submitted {
+		if !submitted {
 			return false
 		}
 	}
 	return true
 }
 
-func (h *Hub) SubmitVotes(sessionCode, memberName string) {
-	h.mu.Lock()
+// MarkVoted records a member whose ballot has been stored, telling the session and
+// firing OnAllVoted once everyone has voted. Marking a member twice does nothing.
+func (h *Hub) MarkVoted(sessionCode, memberID string) {
+	h.post(sessionCode, false, func(s *session) {
+		if s.tracked {
+			s.markVoted(memberID)
+		}
+	})
+}
 
-	if _, ok := h.voted[sessionCode]; !ok {
-		h.mu.Unlock()
+func (s *session) markVoted(memberID string) {
+	memberName := s.names[memberID]
+	if s.voted[memberID] || s.allowed(memberName, phase.SubmitVotes) != nil {
 		return
 	}
 
-	h.voted[sessionCode][memberName] = true
+	s.voted[memberID] = true
+	s.publishState(stateChange{Op: opVoted, MemberID: memberID, Value: true})
+	s.progressChanged()
 
-	h.broadcastToSessionLocked(sessionCode, MemberVotedMsg{
+	s.broadcast(MemberVotedMsg{
 		Type:       TypeMemberVoted,
 		MemberName: memberName,
 	})
 
-	allDone := h.allVotedLocked(sessionCode)
-	h.mu.Unlock()
-
-	if h.OnMemberVoted != nil {
-		go h.OnMemberVoted(sessionCode, memberName)
-	}
-	if allDone && h.OnAllVoted != nil {
-		go h.OnAllVoted(sessionCode)
+	if s.allVoted() && !s.config.Async {
+		s.startGrace(phase.SubmitVotes, s.config.GracePeriodSeconds, s.hub.OnAllVoted)
 	}
 }
 
-// Must hold lock
-func (h *Hub) allVotedLocked(sessionCode string) bool {
-	votedMap, ok := h.voted[sessionCode]
-	if !ok || len(votedMap) == 0 {
-		return false
-	}
-	for _, v := range votedMap {
-		if !v {
+// allVoted reports whether every member who can vote has, as long as someone can
+func (s *session) allVoted() bool {
+	voters := 0
+	for memberID, voted := range s.voted {
+		if s.emptyVoters[memberID] {
+			continue // can't vote, so isn't waited on
+		}
+		if !voted {
 			return false
 		}
+		voters++
 	}
-	return true
+	return voters > 0
+}
+
+// MarkEmptyVoters records the members who can't vote, having proposed no choices in a
+// session that doesn't let them, so voting doesn't wait on them
+func (h *Hub) MarkEmptyVoters(sessionCode string, memberIDs []string) {
+	h.post(sessionCode, false, func(s *session) {
+		if !s.tracked {
+			return
+		}
+		for _, memberID := range memberIDs {
+			if _, ok := s.names[memberID]; ok {
+				s.emptyVoters[memberID] = true
+				s.publishState(stateChange{Op: opEmptyVoter, MemberID: memberID})
+			}
+		}
+	})
+}
+
+// StartRunoff clears every member's voted flag so the session can vote again
+func (h *Hub) StartRunoff(sessionCode string) {
+	h.post(sessionCode, false, func(s *session) {
+		if s.tracked {
+			s.startRunoff()
+			s.publishState(stateChange{Op: opRunoff})
+		}
+	})
+}
+
+func (s *session) startRunoff() {
+	for memberID := range s.voted {
+		s.voted[memberID] = false
+	}
+	s.progress = nil
 }
 
 // MarkSessionClosed marks a session as closed so host transfer is skipped on disconnect
 func (h *Hub) MarkSessionClosed(sessionCode string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.closed[sessionCode] = true
+	h.post(sessionCode, false, func(s *session) {
+		if s.tracked {
+			s.closed = true
+			s.publishState(stateChange{Op: opClosed})
+		}
+	})
 }
 
 // DisconnectSession closes all client connections for a session and cleans up state
 func (h *Hub) DisconnectSession(sessionCode string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	clients, ok := h.sessions[sessionCode]
-	if !ok {
-		return
-	}
-
-	if stop, ok := h.forceStartStop[sessionCode]; ok {
-		close(stop)
-		delete(h.forceStartStop, sessionCode)
-	}
+	h.post(sessionCode, false, func(s *session) {
+		if !s.tracked {
+			return
+		}
 
-	for client := range clients {
-		close(client.send)
-		client.conn.Close()
-	}
+		s.stopForceStart()
+		s.stopGrace()
 
-	delete(h.sessions, sessionCode)
-	delete(h.ready, sessionCode)
-	delete(h.submitted, sessionCode)
-	delete(h.voted, sessionCode)
-	delete(h.closed, sessionCode)
+		for client := range s.clients {
+			close(client.send)
+			client.conn.Close()
+		}
+		s.drop()
+	})
 }
 
 // ForceStart begins a 3-second countdown and transitions to voting when it reaches 0.
 // Only the host should call this.
-func (h *Hub) ForceStart(sessionCode string) {
-	h.mu.Lock()
-
-	// If a countdown is already running, ignore
-	if _, running := h.forceStartStop[sessionCode]; running {
-		h.mu.Unlock()
-		return
-	}
+func (h *Hub) ForceStart(sessionCode string) error {
+	return h.do(sessionCode, func(s *session) error {
+		if err := s.allowed("host", phase.ForceStart); err != nil {
+			return err
+		}
+		// If a countdown is already running, it stands
+		if s.forceStartStop == nil {
+			s.startForceStart(FORCE_START_SECONDS)
+		}
+		return nil
+	})
+}
 
+// startForceStart counts down from seconds and then starts voting
+func (s *session) startForceStart(seconds int) {
 	stop := make(chan struct{})
-	h.forceStartStop[sessionCode] = stop
+	s.forceStartStop = stop
+	countdown := models.Countdown{
+		Action: string(phase.ForceStart),
+		EndsAt: time.Now().Add(time.Duration(seconds) * time.Second),
+	}
+	s.forceStartRun = countdownRun{s.hub.instance, countdown}
+	s.publishState(stateChange{Op: opCountdown, Action: countdown.Action, Value: true, Countdown: &countdown})
+	s.saveCountdown(&countdown)
 
-	// Broadcast initial countdown (3)
-	h.broadcastToSessionLocked(sessionCode, ForceStartCountdownMsg{
+	// Broadcast initial countdown
+	s.broadcast(ForceStartCountdownMsg{
 		Type:      TypeForceStartCountdown,
-		Countdown: 3,
+		Countdown: seconds,
 	})
-	h.mu.Unlock()
 
+	s.tick(stop, seconds, func(s *session, left int) {
+		if s.forceStartStop != stop {
+			return // cancelled while the tick was queued
+		}
+		// Everyone may have readied up in the meantime
+		if s.phase != phase.Lobby {
+			s.stopForceStart()
+			return
+		}
+
+		if left > 0 {
+			s.broadcast(ForceStartCountdownMsg{
+				Type:      TypeForceStartCountdown,
+				Countdown: left,
+			})
+			return
+		}
+
+		// Countdown complete — transition to voting
+		s.stopForceStart()
+		s.setPhase(phase.Voting)
+		s.broadcast(PhaseChangedMsg{
+			Type:  TypePhaseChanged,
+			Phase: "voting",
+			Ready: s.readyByName(),
+		})
+		if s.hub.OnAllReady != nil {
+			s.effect(func() { s.hub.OnAllReady(s.code) })
+		}
+	})
+}
+
+// tick posts fn to the session's loop once a second with the seconds left, counting
+// down from seconds until it reaches 0 or stop is closed
+func (s *session) tick(stop chan struct{}, seconds int, fn func(s *session, left int)) {
+	h, code := s.hub, s.code
 	go func() {
-		for i := 2; i >= 0; i-- {
+		for left := seconds - 1; left >= 0; left-- {
 			select {
 			case <-stop:
 				return
 			case <-time.After(1 * time.Second):
 			}
-
-			h.mu.Lock()
-			// Session may have been cleaned up
-			if _, ok := h.sessions[sessionCode]; !ok {
-				delete(h.forceStartStop, sessionCode)
-				h.mu.Unlock()
-				return
-			}
-
-			if i > 0 {
-				h.broadcastToSessionLocked(sessionCode, ForceStartCountdownMsg{
-					Type:      TypeForceStartCountdown,
-					Countdown: i,
-				})
-				h.mu.Unlock()
-			} else {
-				// Countdown complete — transition to voting
-				delete(h.forceStartStop, sessionCode)
-				h.broadcastToSessionLocked(sessionCode, PhaseChangedMsg{
-					Type:  TypePhaseChanged,
-					Phase: "voting",
-					Ready: h.copyReadyMapLocked(sessionCode),
-				})
-				h.mu.Unlock()
-
-				if h.OnAllReady != nil {
-					go h.OnAllReady(sessionCode)
-				}
-			}
+			h.post(code, false, func(s *session) { fn(s, left) })
 		}
 	}()
 }
 
-// CancelForceStart stops an active force start countdown.
-func (h *Hub) CancelForceStart(sessionCode string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+func (s *session) stopForceStart() {
+	if s.forceStartStop != nil {
+		close(s.forceStartStop)
+		s.forceStartStop = nil
+		s.publishState(stateChange{Op: opCountdown, Action: string(phase.ForceStart)})
+		s.saveCountdown(nil)
+	}
+}
 
-	if stop, ok := h.forceStartStop[sessionCode]; ok {
-		close(stop)
-		delete(h.forceStartStop, sessionCode)
+// CancelForceStart stops an active force start countdown. Cancelling one that has
+// already stopped does nothing.
+func (h *Hub) CancelForceStart(sessionCode string) error {
+	return h.do(sessionCode, func(s *session) error {
+		if s.forceStartStop != nil {
+			s.stopForceStart()
+
+			s.broadcast(ForceStartCountdownMsg{
+				Type:      TypeForceStartCountdown,
+				Cancelled: true,
+			})
+		}
+		return nil
+	})
+}
 
-		h.broadcastToSessionLocked(sessionCode, ForceStartCountdownMsg{
-			Type:      TypeForceStartCountdown,
-			Cancelled: true,
-		})
-	}
+// SetConfig records a change to a session's config
+func (h *Hub) SetConfig(sessionCode string, config models.SessionConfig) {
+	h.post(sessionCode, false, func(s *session) {
+		if s.tracked {
+			s.config = config
+			s.publishState(stateChange{Op: opConfig, Config: &config})
+		}
+	})
 }
 
-// UpdateMemberName atomically renames a member across the client and all hub tracking maps,
-// then broadcasts the change and an updated connected users list to the session.
-func (h *Hub) UpdateMemberName(sessionCode, oldName, newName string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+func (s *session) allDone(action phase.Action) bool {
+	if action == phase.SubmitChoices {
+		return s.allSubmitted()
+	}
+	return s.allVoted()
+}
 
-	// Update the client's memberName
-	if clients, ok := h.sessions[sessionCode]; ok {
-		for client := range clients {
-			if client.memberName == oldName {
-				client.memberName = newName
-				break
-			}
+// startGrace calls done once a grace period of seconds has counted down after
+// everyone submitted for action, giving members the chance to unsubmit first. With
+// no grace period done is called straight away.
+func (s *session) startGrace(action phase.Action, seconds int, done func(sessionCode string)) {
+	if seconds <= 0 {
+		if done != nil {
+			s.effect(func() { done(s.code) })
 		}
+		return
+	}
+	if s.graceStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	s.graceStop = stop
+	countdown := models.Countdown{
+		Action: string(action),
+		EndsAt: time.Now().Add(time.Duration(seconds) * time.Second),
 	}
+	s.graceRun = countdownRun{s.hub.instance, countdown}
+	s.publishState(stateChange{Op: opCountdown, Action: countdown.Action, Value: true, Countdown: &countdown})
+	s.saveCountdown(&countdown)
+	s.broadcast(GraceCountdownMsg{
+		Type:      TypeGraceCountdown,
+		Action:    string(action),
+		Countdown: seconds,
+	})
+
+	s.tick(stop, seconds, func(s *session, left int) {
+		if s.graceStop != stop {
+			return // cancelled while the tick was queued
+		}
+		// Someone may have joined since, or the session moved on some other way
+		if !s.allDone(action) || phase.Check(s.phase, action) != nil {
+			s.stopGrace()
+			s.broadcast(GraceCountdownMsg{
+				Type:      TypeGraceCountdown,
+				Action:    string(action),
+				Cancelled: true,
+			})
+			return
+		}
+
+		if left > 0 {
+			s.broadcast(GraceCountdownMsg{
+				Type:      TypeGraceCountdown,
+				Action:    string(action),
+				Countdown: left,
+			})
+			return
+		}
 
-	// Update ready map
-	if readyMap, ok := h.ready[sessionCode]; ok {
-		if val, exists := readyMap[oldName]; exists {
-			delete(readyMap, oldName)
-			readyMap[newName] = val
+		s.graceStop = nil
+		s.publishState(stateChange{Op: opCountdown})
+		s.saveCountdown(nil)
+		if done != nil {
+			s.effect(func() { done(s.code) })
 		}
+	})
+}
+
+func (s *session) stopGrace() {
+	if s.graceStop != nil {
+		close(s.graceStop)
+		s.graceStop = nil
+		s.publishState(stateChange{Op: opCountdown})
+		s.saveCountdown(nil)
 	}
+}
 
-	// Update submitted map
-	if submittedMap, ok := h.submitted[sessionCode]; ok {
-		if val, exists := submittedMap[oldName]; exists {
-			delete(submittedMap, oldName)
-			submittedMap[newName] = val
+// resumeCountdown restarts a countdown saved before a restart with the time it has
+// left. One that ran out while the backend was down ends a second later, once the
+// session's clients have had the chance to reconnect.
+func (s *session) resumeCountdown(countdown *models.Countdown) {
+	seconds := max(int(math.Ceil(time.Until(countdown.EndsAt).Seconds())), 1)
+	switch phase.Action(countdown.Action) {
+	case phase.ForceStart:
+		if s.phase == phase.Lobby {
+			s.startForceStart(seconds)
 		}
+	case phase.SubmitChoices:
+		s.startGrace(phase.SubmitChoices, seconds, s.hub.OnAllSubmitted)
+	case phase.SubmitVotes:
+		s.startGrace(phase.SubmitVotes, seconds, s.hub.OnAllVoted)
 	}
+}
 
-	// Update voted map
-	if votedMap, ok := h.voted[sessionCode]; ok {
-		if val, exists := votedMap[oldName]; exists {
-			delete(votedMap, oldName)
-			votedMap[newName] = val
+// Unsubmit takes back a member's choices or votes while the grace period is counting
+// down, cancelling the countdown until they submit again.
+func (h *Hub) Unsubmit(sessionCode, memberID string) error {
+	return h.do(sessionCode, func(s *session) error { return s.unsubmit(memberID) })
+}
+
+func (s *session) unsubmit(memberID string) error {
+	var action phase.Action
+	if s.graceStop != nil {
+		switch {
+		case phase.Check(s.phase, phase.SubmitChoices) == nil && s.submitted[memberID]:
+			action = phase.SubmitChoices
+			s.submitted[memberID] = false
+		case phase.Check(s.phase, phase.SubmitVotes) == nil && s.voted[memberID]:
+			action = phase.SubmitVotes
+			s.voted[memberID] = false
 		}
 	}
+	if action == "" {
+		return &ProtocolError{CodeConflict, "can only unsubmit during the grace period"}
+	}
 
-	// Broadcast name change
-	h.broadcastToSessionLocked(sessionCode, MemberNameChangedMsg{
-		Type:    TypeMemberNameChanged,
-		OldName: oldName,
-		NewName: newName,
+	op := opSubmitted
+	if action == phase.SubmitVotes {
+		op = opVoted
+		s.progressChanged()
+	}
+	s.publishState(stateChange{Op: op, MemberID: memberID})
+	s.stopGrace()
+	s.broadcast(MemberUnsubmittedMsg{
+		Type:       TypeMemberUnsubmitted,
+		Action:     string(action),
+		MemberName: s.names[memberID],
+	})
+	s.broadcast(GraceCountdownMsg{
+		Type:      TypeGraceCountdown,
+		Action:    string(action),
+		Cancelled: true,
 	})
-}
 
-// GetConnectedMembers returns a list of member names currently connected to a session
-func (h *Hub) GetConnectedMembers(sessionCode string) []string {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	if s.hub.OnMemberUnsubmit != nil {
+		s.effect(func() { s.hub.OnMemberUnsubmit(s.code, memberID, action) })
+	}
+	return nil
+}
 
-	clients, ok := h.sessions[sessionCode]
-	if !ok {
-		return []string{}
+// ResolveTie hands the host's ordering of tied choices to OnTieResolved, returning
+// its refusal if the order isn't for the tie waiting on them.
+func (h *Hub) ResolveTie(sessionCode string, order []string) error {
+	err := h.do(sessionCode, func(s *session) error {
+		return s.allowed("host", phase.ResolveTie)
+	})
+	if err != nil || h.OnTieResolved == nil {
+		return err
 	}
+	return h.OnTieResolved(sessionCode, order)
+}
 
-	members := make([]string, 0, len(clients))
-	for client := range clients {
-		members = append(members, client.memberName)
+// UpdateMemberName renames a member on their client and in the hub's name lookup,
+// then broadcasts the change to the session. Everything else is keyed by member ID.
+func (h *Hub) UpdateMemberName(sessionCode, memberID, newName string) {
+	h.post(sessionCode, false, func(s *session) {
+		oldName, ok := s.names[memberID]
+		if !ok {
+			return
+		}
+		s.rename(memberID, newName)
+		s.publishState(stateChange{Op: opRename, MemberID: memberID, Name: newName})
+
+		// Broadcast name change
+		s.broadcast(MemberNameChangedMsg{
+			Type:    TypeMemberNameChanged,
+			OldName: oldName,
+			NewName: newName,
+		})
+	})
+}
+
+func (s *session) rename(memberID, name string) {
+	s.names[memberID] = name
+	for client := range s.clients {
+		if client.memberID == memberID {
+			client.memberName = name
+		}
 	}
+}
+
+// GetConnectedMembers returns a list of member names currently connected to a
+// session, on any instance
+func (h *Hub) GetConnectedMembers(sessionCode string) []string {
+	members := []string{}
+	h.do(sessionCode, func(s *session) error {
+		for _, name := range s.names {
+			members = append(members, name)
+		}
+		return nil
+	})
 	return members
 }
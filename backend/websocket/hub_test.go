@@ -0,0 +1,286 @@
+package websocket
+
+import (
+	"consensus/models"
+	"consensus/phase"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// nextMsg reads the next message the hub sent a client, skipping other types
+func nextMsg(t *testing.T, client *Client, msgType string) map[string]any {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case data := <-client.send:
+			var msg map[string]any
+			json.Unmarshal(data, &msg)
+			if msg["type"] == msgType {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", msgType)
+		}
+	}
+}
+
+func TestRegisterResumesSavedState(t *testing.T) {
+	hub := NewHub()
+	saved := make(chan *models.Countdown, 4)
+	hub.OnCountdown = func(sessionCode string, countdown *models.Countdown) { saved <- countdown }
+	started := make(chan string, 1)
+	hub.OnAllReady = func(sessionCode string) { started <- sessionCode }
+	go hub.Run()
+
+	// As the handler builds it for the first member back after a restart
+	client := &Client{
+		hub:         hub,
+		send:        make(chan []byte, 16),
+		sessionCode: "abc",
+		memberID:    "m1",
+		memberName:  "Alice",
+		phase:       phase.Lobby,
+		ready:       true,
+		countdown:   &models.Countdown{Action: string(phase.ForceStart), EndsAt: time.Now().Add(-time.Minute)},
+	}
+	hub.Register(client)
+
+	if msg := nextMsg(t, client, TypeForceStartCountdown); msg["countdown"] != 1.0 {
+		t.Errorf("expected an expired countdown to resume with a second left, got %v", msg["countdown"])
+	}
+	if msg := nextMsg(t, client, TypePhaseChanged); msg["ready"].(map[string]any)["Alice"] != true {
+		t.Errorf("expected Alice's ready flag restored, got %v", msg["ready"])
+	}
+	if code := <-started; code != "abc" {
+		t.Errorf("expected voting to start for abc, got %s", code)
+	}
+
+	if c := <-saved; c == nil || c.Action != string(phase.ForceStart) {
+		t.Errorf("expected the resumed countdown saved, got %+v", c)
+	}
+	if c := <-saved; c != nil {
+		t.Errorf("expected the countdown cleared once done, got %+v", c)
+	}
+}
+
+func TestReconnectReplaysMissedFrames(t *testing.T) {
+	hub := NewHub()
+	hub.disconnectGrace = time.Minute
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.host = true
+	hub.Register(alice)
+	bob := testClient(hub, "m2", "Bob")
+	hub.Register(bob)
+	waitForMembers(t, hub, 2)
+
+	var seen uint64
+	hub.do("abc", func(s *session) error {
+		seen = s.log.last()
+		return nil
+	})
+
+	// Bob drops off and misses Alice getting ready, without being treated as gone
+	hub.Unregister(bob)
+	hub.SetReady("abc", "m1", true)
+	if msg := nextMsg(t, alice, TypeMemberReady); msg["seq"].(float64) <= float64(seen) {
+		t.Errorf("expected frames numbered after %d, got %v", seen, msg["seq"])
+	}
+	if members := hub.GetConnectedMembers("abc"); len(members) != 2 {
+		t.Errorf("expected Bob kept during the grace window, got %v", members)
+	}
+
+	back := testClient(hub, "m2", "Bob")
+	back.since = seen
+	hub.Register(back)
+	if msg := nextMsg(t, back, TypeMemberReady); msg["memberName"] != "Alice" {
+		t.Errorf("expected Bob to be sent what he missed, got %v", msg)
+	}
+
+	// Numbers from before the log starts can't be caught up from, so it starts over
+	stale := testClient(hub, "m2", "Bob")
+	stale.since = 1
+	hub.Register(stale)
+	if msg := nextMsg(t, stale, TypeSessionSnapshot); msg["ready"].(map[string]any)["Alice"] != true {
+		t.Errorf("expected a snapshot with Alice ready, got %v", msg)
+	}
+
+	for len(alice.send) > 0 {
+		if data := <-alice.send; strings.Contains(string(data), TypeMemberLeft) {
+			t.Errorf("expected no member_left for a reconnecting member, got %s", data)
+		}
+	}
+}
+
+func TestDisconnectGraceExpires(t *testing.T) {
+	hub := NewHub()
+	hub.disconnectGrace = 10 * time.Millisecond
+	disconnected := make(chan string, 1)
+	hub.OnHostDisconnected = func(sessionCode, newHostID string) { disconnected <- newHostID }
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.host = true
+	hub.Register(alice)
+	bob := testClient(hub, "m2", "Bob")
+	hub.Register(bob)
+
+	hub.Unregister(alice)
+	if msg := nextMsg(t, bob, TypeMemberLeft); msg["memberName"] != "Alice" {
+		t.Errorf("expected Alice to leave, got %v", msg)
+	}
+	if msg := nextMsg(t, bob, TypeHostChanged); msg["newHost"] != "Bob" {
+		t.Errorf("expected Bob to become host, got %v", msg)
+	}
+	if id := <-disconnected; id != "m2" {
+		t.Errorf("expected host handed to m2, got %s", id)
+	}
+}
+
+func TestRegisterSendsSnapshot(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.session = &models.Session{
+		Code:   "abc",
+		Phase:  phase.Lobby,
+		Config: models.SessionConfig{Anonymity: true},
+		Choices: []models.Choice{{
+			Title:     "Tacos",
+			Proposers: []models.Proposer{{MemberID: "m2", MemberName: "Bob"}},
+		}},
+		Countdown: &models.Countdown{Action: string(phase.ForceStart), EndsAt: time.Now()},
+	}
+	alice.config = alice.session.Config
+	alice.ready = true
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+	hub.BroadcastToSession("abc", PhaseChangedMsg{Type: TypePhaseChanged, Phase: phase.Voting})
+
+	msg := nextMsg(t, alice, TypeSessionSnapshot)
+	session := msg["session"].(map[string]any)
+	if session["phase"] != phase.Lobby {
+		t.Errorf("expected the session's phase, got %v", session["phase"])
+	}
+	if _, ok := session["countdown"]; ok {
+		t.Error("expected a countdown that isn't running left out")
+	}
+	if proposers := session["choices"].([]any)[0].(map[string]any)["proposers"].([]any); len(proposers) != 0 {
+		t.Errorf("expected others' proposals hidden in an anonymous session, got %v", proposers)
+	}
+	if msg["ready"].(map[string]any)["Alice"] != true || len(msg["members"].([]any)) != 1 {
+		t.Errorf("expected Alice connected and ready, got %v", msg)
+	}
+
+	// Frames sent afterwards follow it
+	if changed := nextMsg(t, alice, TypePhaseChanged); changed["seq"].(float64) <= msg["seq"].(float64) {
+		t.Errorf("expected later frames numbered after the snapshot's %v, got %v", msg["seq"], changed["seq"])
+	}
+}
+
+func TestSnapshotHidesOthersVotesMidRound(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Results
+	alice.session = &models.Session{
+		Code:  "abc",
+		Phase: phase.Results,
+		Choices: []models.Choice{{
+			ID:    "c1",
+			Votes: []models.Vote{{MemberID: "m1", Value: 1}, {MemberID: "m2", Value: 0}},
+		}},
+	}
+	hub.Register(alice)
+
+	msg := nextMsg(t, alice, TypeSessionSnapshot)
+	votes := msg["session"].(map[string]any)["choices"].([]any)[0].(map[string]any)["votes"].([]any)
+	if len(votes) != 1 || votes[0].(map[string]any)["memberID"] != "m1" {
+		t.Errorf("expected only Alice's own vote in the snapshot, got %v", votes)
+	}
+}
+
+func TestSnapshotForClientJoiningMidVoting(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+	hub.SetPhase("abc", phase.Results)
+
+	// Loaded before the phase change was saved, with Alice's first votes already in
+	bob := testClient(hub, "m2", "Bob")
+	bob.session = &models.Session{
+		Code:  "abc",
+		Phase: phase.Voting,
+		Choices: []models.Choice{{
+			ID:    "c1",
+			Votes: []models.Vote{{MemberID: "m1", Value: 1}},
+		}},
+	}
+	hub.Register(bob)
+
+	msg := nextMsg(t, bob, TypeSessionSnapshot)
+	session := msg["session"].(map[string]any)
+	if session["phase"] != phase.Results {
+		t.Errorf("expected the hub's phase, got %v", session["phase"])
+	}
+	if votes := session["choices"].([]any)[0].(map[string]any)["votes"].([]any); len(votes) != 0 {
+		t.Errorf("expected Alice's votes hidden from Bob mid-voting, got %v", votes)
+	}
+}
+
+func TestRegisterSendsConnectedUsers(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	hub.Register(alice)
+	bob := testClient(hub, "m2", "Bob")
+	hub.Register(bob)
+
+	// Sent from the session's loop, so Bob is in it however soon he looks
+	nextMsg(t, bob, TypeSessionSnapshot)
+	msg := nextMsg(t, bob, TypeConnectedUsers)
+	if members := msg["members"].([]any); len(members) != 2 || members[0] != "Alice" || members[1] != "Bob" {
+		t.Errorf("expected Alice and Bob connected, got %v", members)
+	}
+	if _, ok := msg["seq"]; ok {
+		t.Errorf("expected connected_users unnumbered, got %v", msg["seq"])
+	}
+}
+
+func TestSubmitChoicesChecksPhaseBeforeLimits(t *testing.T) {
+	hub := NewHub()
+	var checked atomic.Int32
+	hub.CheckSubmitChoices = func(sessionCode, memberID string) error {
+		checked.Add(1)
+		return models.ErrTooFewChoices
+	}
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+
+	if err := hub.SubmitChoices("abc", "m1"); !errors.Is(err, phase.ErrActionNotAllowed) {
+		t.Errorf("expected the lobby to refuse a submission, got %v", err)
+	}
+	if n := checked.Load(); n != 0 {
+		t.Errorf("expected the limits left unchecked outside the voting phase, checked %d times", n)
+	}
+
+	hub.SetPhase("abc", phase.Voting)
+	if err := hub.SubmitChoices("abc", "m1"); !errors.Is(err, models.ErrTooFewChoices) {
+		t.Errorf("expected the limits to refuse the submission, got %v", err)
+	}
+}
@@ -4,41 +4,28 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
-	"net/url"
 	"testing"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 func TestRESTLeaveBroadcastsToWebSocket(t *testing.T) {
-	sessionCode := "jht9xv"
+	sessionCode, hostToken := hostSession(t, "Host")
 
 	// Add a guest first
-	joinReq := map[string]string{"name": "Leaver"}
-	body, _ := json.Marshal(joinReq)
-	resp, err := http.Post("http://localhost:8080/api/session/"+sessionCode+"/join", "application/json", bytes.NewReader(body))
-	if err != nil {
-		t.Fatalf("join failed: %v", err)
-	}
-	resp.Body.Close()
+	leaverToken := joinSession(t, sessionCode, "Leaver")
 	t.Log("Leaver joined via REST")
 
 	// Connect Host via WebSocket
-	u := url.URL{Scheme: "ws", Host: "localhost:8080", Path: "/api/session/" + sessionCode + "/ws", RawQuery: "name=Host"}
-	host, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		t.Fatalf("dial failed: %v", err)
-	}
+	host := connect(t, sessionCode, hostToken)
 	defer host.Close()
 	t.Log("Host connected via WebSocket")
 
 	time.Sleep(100 * time.Millisecond)
 
 	// Leave via REST
-	leaveReq := map[string]string{"name": "Leaver"}
-	body, _ = json.Marshal(leaveReq)
-	resp, err = http.Post("http://localhost:8080/api/session/"+sessionCode+"/leave", "application/json", bytes.NewReader(body))
+	req, _ := http.NewRequest(http.MethodPost, apiURL+sessionCode+"/leave", nil)
+	req.Header.Set("Authorization", "Bearer "+leaverToken)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("leave failed: %v", err)
 	}
@@ -67,14 +54,10 @@ func TestRESTLeaveBroadcastsToWebSocket(t *testing.T) {
 }
 
 func TestRESTJoinBroadcastsToWebSocket(t *testing.T) {
-	sessionCode := "6hq4ve"
+	sessionCode, hostToken := hostSession(t, "Host")
 
 	// Connect Host via WebSocket
-	u := url.URL{Scheme: "ws", Host: "localhost:8080", Path: "/api/session/" + sessionCode + "/ws", RawQuery: "name=Host"}
-	host, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		t.Fatalf("dial failed: %v", err)
-	}
+	host := connect(t, sessionCode, hostToken)
 	defer host.Close()
 	t.Log("Host connected via WebSocket")
 
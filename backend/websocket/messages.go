@@ -1,29 +1,46 @@
 package websocket
 
-import "consensus/models"
+import (
+	"consensus/models"
+	"consensus/tally"
+)
 
 // Message types
 const (
 	// Outbound (server → client)
-	TypeMemberJoined    = "member_joined"
-	TypeMemberLeft      = "member_left"
-	TypeMemberReady     = "member_ready"
-	TypePhaseChanged    = "phase_changed"
-	TypeConnectedUsers  = "connected_users"
-	TypeMemberSubmitted = "member_submitted"
-	TypeMemberVoted     = "member_voted"
-	TypeSessionClosed   = "session_closed"
-	TypeConfigUpdated   = "config_updated"
-	TypeHostChanged          = "host_changed"
+	TypeMemberJoined        = "member_joined"
+	TypeMemberLeft          = "member_left"
+	TypeMemberReady         = "member_ready"
+	TypePhaseChanged        = "phase_changed"
+	TypeConnectedUsers      = "connected_users"
+	TypeMemberSubmitted     = "member_submitted"
+	TypeMemberVoted         = "member_voted"
+	TypeSessionClosed       = "session_closed"
+	TypeConfigUpdated       = "config_updated"
+	TypeHostChanged         = "host_changed"
 	TypeForceStartCountdown = "force_start_countdown"
+	TypeGraceCountdown      = "grace_countdown"
+	TypeMemberUnsubmitted   = "member_unsubmitted"
 	TypeMemberNameChanged   = "member_name_changed"
+	TypeTieDetected         = "tie_detected"
+	TypeSessionSnapshot     = "session_snapshot"
+	TypeVoteCast            = "vote_cast"
+	TypeVotingProgress      = "voting_progress"
+	TypeChoiceAdded         = "choice_added"
+	TypeChoiceUpdated       = "choice_updated"
+	TypeChoiceRemoved       = "choice_removed"
+	TypeAck                 = "ack"
+	TypeError               = "error"
 
 	// Inbound (client → server)
 	TypeSetReady         = "set_ready"
 	TypeSubmitChoices    = "submit_choices"
-	TypeSubmitVotes      = "submit_votes"
 	TypeForceStart       = "force_start"
 	TypeCancelForceStart = "cancel_force_start"
+	TypeUnsubmit         = "unsubmit"
+	TypeResolveTie       = "resolve_tie"
+	TypeCastVote         = "cast_vote"
+	TypeUndoVote         = "undo_vote"
 )
 
 // Outbound messages
@@ -46,9 +63,12 @@ type MemberReadyMsg struct {
 }
 
 type PhaseChangedMsg struct {
-	Type  string          `json:"type"`
-	Phase string          `json:"phase"`
-	Ready map[string]bool `json:"ready"` // memberName → ready status
+	Type      string          `json:"type"`
+	Phase     string          `json:"phase"`
+	Ready     map[string]bool `json:"ready"`               // memberName → ready status
+	Choices   []models.Choice `json:"choices,omitempty"`   // finalized choices, once voting is on them
+	Round     int             `json:"round,omitempty"`     // for runoffs
+	Permalink string          `json:"permalink,omitempty"` // for the final results
 }
 
 type ConnectedUsersMsg struct {
@@ -71,7 +91,7 @@ type SessionClosedMsg struct {
 }
 
 type ConfigUpdatedMsg struct {
-	Type   string              `json:"type"`
+	Type   string               `json:"type"`
 	Config models.SessionConfig `json:"config"`
 }
 
@@ -92,9 +112,87 @@ type ForceStartCountdownMsg struct {
 	Cancelled bool   `json:"cancelled,omitempty"`
 }
 
-// Inbound messages
+// GraceCountdownMsg counts down the grace period after everyone has submitted their
+// choices or votes, before the session moves on
+type GraceCountdownMsg struct {
+	Type      string `json:"type"`
+	Action    string `json:"action"` // submit_choices or submit_votes
+	Countdown int    `json:"countdown"`
+	Cancelled bool   `json:"cancelled,omitempty"`
+}
 
-type InboundMessage struct {
-	Type  string `json:"type"`
-	Ready bool   `json:"ready,omitempty"` // for set_ready
+// MemberUnsubmittedMsg is sent when a member takes back their choices or votes
+// during the grace period
+type MemberUnsubmittedMsg struct {
+	Type       string `json:"type"`
+	Action     string `json:"action"`
+	MemberName string `json:"memberName"`
+}
+
+// TieDetectedMsg is sent to the host when tied choices need a manual decision
+type TieDetectedMsg struct {
+	Type    string   `json:"type"`
+	Policy  string   `json:"policy"`
+	Choices []string `json:"choices"` // IDs of the tied choices
+}
+
+// SessionSnapshotMsg is sent to a client when it connects, unless it's reconnecting
+// and can be sent just what it missed. It holds everything needed to render the
+// session in any phase.
+type SessionSnapshotMsg struct {
+	Type      string          `json:"type"`
+	Seq       uint64          `json:"seq"`       // latest frame the snapshot takes in, to reconnect from
+	Session   models.Session  `json:"session"`   // as the member may see it
+	Members   []string        `json:"members"`   // connected member names
+	Ready     map[string]bool `json:"ready"`     // memberName → ready status
+	Submitted []string        `json:"submitted"` // names of members who have submitted choices
+	Voted     []string        `json:"voted"`     // names of members who have voted this round
+}
+
+// ChoiceMsg tells the session a choice was added, or changed by an edit or by a
+// member proposing or dropping it. In anonymous sessions it leaves out proposers.
+type ChoiceMsg struct {
+	Type   string        `json:"type"` // choice_added or choice_updated
+	Choice models.Choice `json:"choice"`
+}
+
+// ChoiceRemovedMsg tells the session a choice was dropped by everyone who proposed it
+type ChoiceRemovedMsg struct {
+	Type     string `json:"type"`
+	ChoiceID string `json:"choiceID"`
+}
+
+// VoteCastMsg is sent to a member once a vote they cast a card at a time is saved
+type VoteCastMsg struct {
+	Type     string `json:"type"`
+	ChoiceID string `json:"choiceID"`
+	Value    *int   `json:"value"` // null when the vote was taken back
+	Cast     int    `json:"cast"`  // choices voted on so far this round
+	Total    int    `json:"total"`
+}
+
+// VotingProgressMsg tells the session how far along voting is. It carries no votes
+// unless the session shows live totals.
+type VotingProgressMsg struct {
+	Type    string                     `json:"type"`
+	Done    int                        `json:"done"`             // members who have voted
+	Members int                        `json:"members"`          // members in the session
+	Percent map[string]int             `json:"percent"`          // memberName → share of the choices they've voted on
+	Totals  map[string]tally.Breakdown `json:"totals,omitempty"` // choice ID → votes so far
+}
+
+// AckMsg tells a client one of its messages was carried out
+type AckMsg struct {
+	Type   string `json:"type"`
+	ID     string `json:"id,omitempty"` // from the message's envelope
+	Action string `json:"action"`       // type of the message
+}
+
+// ErrorMsg is sent to a single client when the server refuses one of its messages
+type ErrorMsg struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"` // from the message's envelope
+	Action  string `json:"action"`       // type of the refused message
+	Code    string `json:"code"`         // see the Code constants
+	Message string `json:"message"`
 }
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"consensus/phase"
+	"consensus/tally"
+	"log"
+	"time"
+)
+
+// How often at most each session is sent how far along voting is
+const VOTING_PROGRESS_INTERVAL = time.Second
+
+// progressChanged sends the session's voting progress once the interval is up,
+// taking in whatever else changes meanwhile
+func (s *session) progressChanged() {
+	if s.progressTimer != nil {
+		return
+	}
+	h, code := s.hub, s.code
+	s.progressTimer = time.AfterFunc(h.progressInterval, func() {
+		h.post(code, false, func(s *session) { s.totalProgress() })
+	})
+}
+
+// totalProgress sends the session's voting progress, once the running totals are in
+// for sessions that show them. They're only ever sent in sessions that opted in, and
+// never in anonymous ones, where totals moving as each member finishes would give
+// away how they voted.
+func (s *session) totalProgress() {
+	if !s.config.LiveTotals || s.config.Anonymity || s.hub.RunningTotals == nil {
+		s.broadcastProgress(nil)
+		return
+	}
+
+	// Totalling reads the saved votes, so it waits behind the hooks saving them
+	h, code := s.hub, s.code
+	s.effect(func() {
+		totals, err := h.RunningTotals(code)
+		if err != nil {
+			log.Printf("voting progress: failed to total session %s: %v", code, err)
+		}
+		h.post(code, false, func(s *session) { s.broadcastProgress(totals) })
+	})
+}
+
+func (s *session) broadcastProgress(totals map[string]tally.Breakdown) {
+	s.progressTimer = nil
+	if !s.tracked || phase.Check(s.phase, phase.SubmitVotes) != nil {
+		return
+	}
+
+	msg := VotingProgressMsg{
+		Type:    TypeVotingProgress,
+		Percent: make(map[string]int, len(s.names)),
+		Totals:  totals,
+	}
+	for memberID, name := range s.names {
+		if s.emptyVoters[memberID] {
+			continue // can't vote, so isn't counted
+		}
+		msg.Members++
+		p := s.progress[memberID]
+		switch {
+		case s.voted[memberID]:
+			msg.Done++
+			msg.Percent[name] = 100
+		case p.total > 0:
+			msg.Percent[name] = p.cast * 100 / p.total
+		default:
+			msg.Percent[name] = 0
+		}
+	}
+	s.broadcast(msg)
+}
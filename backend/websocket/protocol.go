@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"consensus/phase"
+	"consensus/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// PROTOCOL_VERSION is the version of the envelope clients send messages in. Frames
+// without one are taken as version 1, from clients that predate the envelope.
+const PROTOCOL_VERSION = 1
+
+// Error codes, for clients to act on without parsing messages
+const (
+	CodeBadRequest         = "bad_request"         // not JSON, or a payload that doesn't fit its type
+	CodeUnsupportedVersion = "unsupported_version" // an envelope version the server doesn't speak
+	CodeUnknownType        = "unknown_type"
+	CodeForbidden          = "forbidden"   // only the host may do that
+	CodeWrongPhase         = "wrong_phase" // not allowed in the session's current phase
+	CodeConflict           = "conflict"    // the session isn't in a state to take it
+	CodeInvalid            = "invalid"     // refused by the session's rules
+)
+
+// Envelope wraps every message a client sends. ID is the client's own and is echoed
+// in the ack or error that answers the message.
+type Envelope struct {
+	V       int             `json:"v"`
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Inbound payloads. Messages not listed here take none.
+
+type SetReadyPayload struct {
+	Ready bool `json:"ready"`
+}
+
+type ResolveTiePayload struct {
+	Order []string `json:"order"` // tied choice IDs from first to last
+}
+
+type CastVotePayload struct {
+	ChoiceID string `json:"choiceID"`
+	Value    *int   `json:"value"` // 0 or 1
+}
+
+type UndoVotePayload struct {
+	ChoiceID string `json:"choiceID"`
+}
+
+// ProtocolError is a message the server refused, with the code the client is told
+type ProtocolError struct {
+	Code    string
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Message
+}
+
+var (
+	errHostOnly   = &ProtocolError{CodeForbidden, "only the host can do that"}
+	errNotTracked = &ProtocolError{CodeConflict, "session is not open"}
+)
+
+// errorCode picks the code for an error returned by an action
+func errorCode(err error) string {
+	var perr *ProtocolError
+	switch {
+	case errors.As(err, &perr):
+		return perr.Code
+	case errors.Is(err, phase.ErrActionNotAllowed), errors.Is(err, repository.ErrRoundOver):
+		return CodeWrongPhase
+	case errors.Is(err, repository.ErrNoTiePending):
+		return CodeConflict
+	default:
+		return CodeInvalid
+	}
+}
+
+// decodePayload reads a message's payload into p
+func decodePayload(payload json.RawMessage, p any) error {
+	if err := json.Unmarshal(payload, p); err != nil {
+		return &ProtocolError{CodeBadRequest, fmt.Sprintf("invalid payload: %v", err)}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"consensus/phase"
+	"consensus/repository"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHandleMessageRepliesToEachMessage(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.host = true
+	hub.Register(alice)
+	bob := testClient(hub, "m2", "Bob")
+	hub.Register(bob)
+	waitForMembers(t, hub, 2)
+
+	tests := []struct {
+		name    string
+		client  *Client
+		message string
+		reply   string
+		code    string
+	}{
+		{"envelope", bob, `{"v":1,"id":"r1","type":"set_ready","payload":{"ready":true}}`, TypeAck, ""},
+		{"frame from before the envelope", bob, `{"type":"set_ready","ready":false}`, TypeAck, ""},
+		{"bad JSON", bob, `{"type":`, TypeError, CodeBadRequest},
+		{"bad payload", bob, `{"v":1,"id":"r2","type":"set_ready","payload":{"ready":"yes"}}`, TypeError, CodeBadRequest},
+		{"newer version", bob, `{"v":2,"id":"r3","type":"set_ready","payload":{"ready":true}}`, TypeError, CodeUnsupportedVersion},
+		{"unknown type", bob, `{"v":1,"id":"r4","type":"shout"}`, TypeError, CodeUnknownType},
+		{"host only", bob, `{"v":1,"id":"r5","type":"force_start"}`, TypeError, CodeForbidden},
+		{"wrong phase", alice, `{"v":1,"id":"r6","type":"resolve_tie","payload":{"order":["c1","c2"]}}`, TypeError, CodeWrongPhase},
+		{"nothing to unsubmit", bob, `{"v":1,"id":"r7","type":"unsubmit"}`, TypeError, CodeConflict},
+		{"missing vote", bob, `{"v":1,"id":"r8","type":"cast_vote","payload":{"choiceID":"c1"}}`, TypeError, CodeBadRequest},
+		{"host", alice, `{"v":1,"id":"r9","type":"cancel_force_start"}`, TypeAck, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.client.handleMessage([]byte(tt.message))
+
+			msg := nextReply(t, tt.client)
+			if msg["type"] != tt.reply {
+				t.Fatalf("expected %s, got %v", tt.reply, msg)
+			}
+			if tt.code != "" && msg["code"] != tt.code {
+				t.Errorf("expected code %s, got %v", tt.code, msg)
+			}
+		})
+	}
+}
+
+func TestReplyEchoesRequestID(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Voting
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+
+	alice.handleMessage([]byte(`{"v":1,"id":"r1","type":"set_ready","payload":{"ready":true}}`))
+	msg := nextReply(t, alice)
+	if msg["id"] != "r1" || msg["action"] != TypeSetReady || msg["code"] != CodeWrongPhase {
+		t.Errorf("expected set_ready r1 refused in voting, got %v", msg)
+	}
+}
+
+func TestResolveTieRefusedWithoutPendingTie(t *testing.T) {
+	hub := NewHub()
+	hub.OnTieResolved = func(sessionCode string, order []string) error {
+		return repository.ErrNoTiePending
+	}
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.host = true
+	alice.phase = phase.Results
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+
+	alice.handleMessage([]byte(`{"v":1,"id":"r1","type":"resolve_tie","payload":{"order":["c1","c2"]}}`))
+	if msg := nextReply(t, alice); msg["type"] != TypeError || msg["code"] != CodeConflict {
+		t.Errorf("expected the order refused as a conflict, got %v", msg)
+	}
+}
+
+// nextReply reads the next ack or error the hub sent a client
+func nextReply(t *testing.T, client *Client) map[string]any {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case data := <-client.send:
+			var msg map[string]any
+			json.Unmarshal(data, &msg)
+			if msg["type"] == TypeAck || msg["type"] == TypeError {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a reply")
+		}
+	}
+}
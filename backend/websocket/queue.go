@@ -0,0 +1,80 @@
+package websocket
+
+import "sync"
+
+// queue holds funcs for one goroutine to run in the order they were pushed. Pushing
+// never blocks, so a session's loop can queue work for itself or its hooks without
+// waiting on whoever runs them.
+type queue struct {
+	mu     sync.Mutex
+	fns    []func()
+	wake   chan struct{}
+	closed bool
+}
+
+func newQueue() *queue {
+	return &queue{wake: make(chan struct{}, 1)}
+}
+
+// push adds fn to the back of the queue, reporting false if the queue is closed
+func (q *queue) push(fn func()) bool {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	q.fns = append(q.fns, fn)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop takes the func at the front of the queue, waiting for one if it's empty. It
+// returns nil once the queue is closed and everything in it has been taken.
+func (q *queue) pop() func() {
+	for {
+		q.mu.Lock()
+		if len(q.fns) > 0 {
+			fn := q.fns[0]
+			q.fns[0] = nil
+			q.fns = q.fns[1:]
+			q.mu.Unlock()
+			return fn
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return nil
+		}
+		q.mu.Unlock()
+		<-q.wake
+	}
+}
+
+// run calls each func in turn until the queue is closed and empty
+func (q *queue) run() {
+	for fn := q.pop(); fn != nil; fn = q.pop() {
+		fn()
+	}
+}
+
+func (q *queue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.fns) == 0
+}
+
+// close stops the queue taking more funcs. Those already in it are still run.
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
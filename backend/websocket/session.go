@@ -0,0 +1,362 @@
+package websocket
+
+import (
+	"consensus/backplane"
+	"consensus/models"
+	"consensus/phase"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Each session the hub knows about runs on its own loop: a goroutine that makes
+// every change to the session's state, one event at a time, in the order they were
+// posted. Nothing else touches the state, so sessions never wait on each other. The
+// hooks a change fires run in the same order on a second goroutine, so they can
+// call back into the hub without holding up the loop.
+
+type session struct {
+	hub     *Hub
+	code    string
+	events  *queue        // run on the session's loop
+	effects *queue        // hooks fired by events, run in order
+	after   chan struct{} // closed once the hooks of the loop this one follows have run, nil if none
+	drained chan struct{} // closed once this loop's hooks have run
+
+	sessionState
+}
+
+// sessionState is a session's state. Only the session's loop touches it, and it is
+// reset when the session is dropped.
+type sessionState struct {
+	tracked        bool                    // false until a member joins, and once the session is dropped
+	clients        map[*Client]bool        // connections to this instance
+	names          map[string]string       // memberID → display name
+	owners         map[string]string       // memberID → instance they last joined on, for members who joined elsewhere
+	host           string                  // memberID of the host, as far as this instance knows
+	ready          map[string]bool         // memberID → ready
+	submitted      map[string]bool         // memberID → submitted
+	voted          map[string]bool         // memberID → voted
+	emptyVoters    map[string]bool         // memberID → can't vote, having proposed no choices
+	progress       map[string]voteProgress // memberID → cards voted on this round
+	progressTimer  *time.Timer             // pending voting progress broadcast
+	closed         bool                    // skip host transfer
+	phase          string
+	config         models.SessionConfig
+	forceStartStop chan struct{}          // cancels the force start countdown, nil when none is running
+	forceStartRun  countdownRun           // who runs the force start countdown
+	graceStop      chan struct{}          // cancels the grace period countdown, nil when none is running
+	graceRun       countdownRun           // who runs the grace period countdown
+	leaving        map[string]*time.Timer // memberID → pending departure of a disconnected member
+	log            *eventLog              // recent frames, for replaying to reconnecting clients
+}
+
+// countdownRun is the instance counting a countdown down and the countdown as saved,
+// for another instance to take over if that one goes away
+type countdownRun struct {
+	owner string
+	models.Countdown
+}
+
+func newSession(h *Hub, code string, after chan struct{}) *session {
+	return &session{
+		hub:     h,
+		code:    code,
+		events:  newQueue(),
+		effects: newQueue(),
+		after:   after,
+		drained: make(chan struct{}),
+	}
+}
+
+// run is the session's loop. It stops once the session is dropped and has nothing
+// left to do, and a session posted to after that starts afresh. The new loop's hooks
+// wait for the old loop's, so they still run in order.
+func (s *session) run() {
+	go func() {
+		if s.after != nil {
+			<-s.after
+		}
+		s.effects.run()
+		close(s.drained)
+		s.hub.forget(s)
+	}()
+	for fn := s.events.pop(); fn != nil; fn = s.events.pop() {
+		fn()
+		if !s.tracked {
+			s.hub.retire(s)
+		}
+	}
+	s.effects.close()
+}
+
+// effect queues a hook behind the ones before it, so hooks see the session's changes
+// in the order they happened
+func (s *session) effect(fn func()) {
+	s.effects.push(fn)
+}
+
+func (s *session) saveCountdown(countdown *models.Countdown) {
+	if s.hub.OnCountdown != nil {
+		s.effect(func() { s.hub.OnCountdown(s.code, countdown) })
+	}
+}
+
+// track starts keeping state for the session, if it isn't already
+func (s *session) track(p string) {
+	if s.tracked {
+		return
+	}
+	s.tracked = true
+	s.clients = make(map[*Client]bool)
+	s.names = make(map[string]string)
+	s.owners = make(map[string]string)
+	s.ready = make(map[string]bool)
+	s.submitted = make(map[string]bool)
+	s.voted = make(map[string]bool)
+	s.emptyVoters = make(map[string]bool)
+	s.leaving = make(map[string]*time.Timer)
+	s.phase = phase.Normalize(p)
+	s.log = newEventLog(s.hub.seq.Load())
+}
+
+// forgetMember drops a member who has left, and the session's state once no member
+// is connected to any instance
+func (s *session) forgetMember(memberID string) {
+	delete(s.names, memberID)
+	delete(s.owners, memberID)
+	if s.host == memberID {
+		s.host = ""
+	}
+	delete(s.ready, memberID)
+	delete(s.submitted, memberID)
+	delete(s.voted, memberID)
+	delete(s.emptyVoters, memberID)
+	delete(s.progress, memberID)
+
+	if len(s.names) == 0 {
+		s.stopForceStart()
+		s.stopGrace()
+		s.drop()
+	}
+}
+
+func (s *session) drop() {
+	for _, timer := range s.leaving {
+		timer.Stop()
+	}
+	if s.progressTimer != nil {
+		s.progressTimer.Stop()
+	}
+	s.sessionState = sessionState{}
+}
+
+func (s *session) register(client *Client) {
+	resume := !s.tracked
+	s.track(client.phase)
+	s.stay(client.memberID)
+	s.clients[client] = true
+	s.config = client.config
+	s.names[client.memberID] = client.memberName
+	if client.host {
+		s.host = client.memberID
+	}
+	// Restore ready/submitted/voted from DB state carried on the client
+	s.ready[client.memberID] = client.ready
+	if client.submitted {
+		s.submitted[client.memberID] = true
+	} else if _, alreadyTracked := s.submitted[client.memberID]; !alreadyTracked {
+		s.submitted[client.memberID] = false
+	}
+	if client.voted {
+		s.voted[client.memberID] = true
+	} else if _, alreadyTracked := s.voted[client.memberID]; !alreadyTracked {
+		s.voted[client.memberID] = false
+	}
+	if client.emptyVoter {
+		s.emptyVoters[client.memberID] = true
+	}
+	if client.progress.total > 0 {
+		s.restoreProgress(client.memberID, client.progress)
+	}
+	s.publishJoin(client.memberID)
+	// The first client back after a restart picks up whatever was counting down
+	if resume && client.countdown != nil {
+		s.resumeCountdown(client.countdown)
+	}
+	// Catch the client up on what it missed, or failing that send it everything
+	if client.since == 0 || !s.replay(client) {
+		s.snapshot(client)
+	}
+	s.connectedUsers(client)
+	log.Printf("client registered: %s in session %s", client.memberName, client.sessionCode)
+}
+
+func (s *session) unregister(client *Client) {
+	if !s.clients[client] {
+		return
+	}
+	delete(s.clients, client)
+	close(client.send)
+
+	if !s.connected(client.memberID) {
+		s.leaveLater(client.memberID, client.host)
+	}
+	log.Printf("client unregistered: %s from session %s", client.memberName, client.sessionCode)
+}
+
+// leaveLater treats a disconnected member as having left once the disconnect grace
+// window passes without them reconnecting. Until then they keep their place, ready
+// flag and all.
+func (s *session) leaveLater(memberID string, wasHost bool) {
+	s.stay(memberID)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.hub.disconnectGrace, func() {
+		s.hub.post(s.code, false, func(s *session) {
+			if s.leaving[memberID] != timer {
+				return // came back in the meantime
+			}
+			delete(s.leaving, memberID)
+			s.leave(memberID, wasHost)
+		})
+	})
+	s.leaving[memberID] = timer
+}
+
+// stay cancels a member's pending departure
+func (s *session) stay(memberID string) {
+	if timer, ok := s.leaving[memberID]; ok {
+		timer.Stop()
+		delete(s.leaving, memberID)
+	}
+}
+
+// leave tells the session a member left, handing over to a new host if they were it
+func (s *session) leave(memberID string, wasHost bool) {
+	if _, ok := s.names[memberID]; !ok {
+		return
+	}
+
+	// Broadcast member left
+	s.broadcast(MemberLeftMsg{
+		Type:       TypeMemberLeft,
+		MemberName: s.names[memberID],
+	})
+
+	// If host left and there are remaining members, on this instance or another,
+	// reassign host, to someone not on their way out too if there is anyone
+	var newHostID string
+	if (wasHost || s.host == memberID) && !s.closed {
+		for id := range s.names {
+			if id != memberID && (newHostID == "" || s.leaving[newHostID] != nil) {
+				newHostID = id
+			}
+		}
+	}
+	if newHostID != "" {
+		s.host = newHostID
+		for c := range s.clients {
+			if c.memberID == newHostID {
+				c.host = true
+			}
+		}
+		s.publishState(stateChange{Op: opHost, MemberID: newHostID})
+		s.broadcast(HostChangedMsg{
+			Type:    TypeHostChanged,
+			NewHost: s.names[newHostID],
+		})
+		if s.hub.OnHostDisconnected != nil {
+			s.effect(func() { s.hub.OnHostDisconnected(s.code, newHostID) })
+		}
+	}
+
+	// Clean up name, ready, submitted, and voted state, and the session once nobody
+	// is left
+	s.publishState(stateChange{Op: opLeave, MemberID: memberID})
+	s.forgetMember(memberID)
+}
+
+func (s *session) broadcast(msg any) {
+	s.send("", msg)
+}
+
+// send sends a message to the session's clients on every instance: to all of them
+// with no target, to the host with target "host", and otherwise to the member with
+// that ID
+func (s *session) send(target string, msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("failed to marshal message: %v", err)
+		return
+	}
+
+	// With other instances, frames are numbered and delivered in the order the
+	// backplane hands them back, so every instance numbers them alike
+	if s.hub.Backplane != nil {
+		s.hub.publish(backplane.Message{Session: s.code, Target: target, Frame: data})
+		return
+	}
+	s.record(target, s.hub.seq.Add(1), data)
+}
+
+// record numbers a frame, logs it for replay and delivers it
+func (s *session) record(target string, seq uint64, data []byte) {
+	frame := withSeq(data, seq)
+	if s.tracked {
+		s.log.append(logEntry{seq: seq, target: target, frame: frame})
+	}
+	s.deliver(target, frame)
+}
+
+// replay sends a reconnecting client the frames it missed. It reports false, sending
+// nothing, if they're no longer all logged.
+func (s *session) replay(client *Client) bool {
+	entries, ok := s.log.since(client.since)
+	if !ok {
+		return false
+	}
+	for _, entry := range entries {
+		if client.targeted(entry.target) {
+			s.push(client, entry.frame)
+		}
+	}
+	return true
+}
+
+// deliver sends a frame to the targeted clients connected to this instance
+func (s *session) deliver(target string, data []byte) {
+	for client := range s.clients {
+		if client.targeted(target) {
+			s.push(client, data)
+		}
+	}
+}
+
+// push hands a frame to a client's write pump, dropping it if the client is too far
+// behind to take it
+func (s *session) push(client *Client, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		log.Printf("client buffer full, skipping: %s", client.memberName)
+	}
+}
+
+func (s *session) allowed(who string, action phase.Action) error {
+	if err := phase.Check(s.phase, action); err != nil {
+		log.Printf("rejected %s from %s in session %s: %v", action, who, s.code, err)
+		return err
+	}
+	return nil
+}
+
+// connected reports whether a member has a connection to this instance
+func (s *session) connected(memberID string) bool {
+	for client := range s.clients {
+		if client.memberID == memberID {
+			return true
+		}
+	}
+	return false
+}
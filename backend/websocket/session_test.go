@@ -0,0 +1,262 @@
+package websocket
+
+import (
+	"bytes"
+	"consensus/phase"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHooksRunInOrder(t *testing.T) {
+	hub := NewHub()
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	// A slow save mustn't let the session move on ahead of it
+	hub.OnMemberSubmitted = func(sessionCode, memberID string) {
+		time.Sleep(20 * time.Millisecond)
+		record("submitted " + memberID)
+	}
+	all := make(chan struct{})
+	hub.OnAllSubmitted = func(sessionCode string) {
+		record("all submitted")
+		close(all)
+	}
+	go hub.Run()
+
+	for _, id := range []string{"m1", "m2"} {
+		client := testClient(hub, id, id)
+		client.phase = phase.Voting
+		hub.Register(client)
+	}
+	waitForMembers(t, hub, 2)
+
+	hub.SubmitChoices("abc", "m1")
+	hub.SubmitChoices("abc", "m2")
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for everyone to submit")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"submitted m1", "submitted m2", "all submitted"}; !slices.Equal(calls, want) {
+		t.Errorf("expected hooks %v, got %v", want, calls)
+	}
+}
+
+func TestDroppedSessionStartsAfresh(t *testing.T) {
+	hub := NewHub()
+	hub.disconnectGrace = time.Millisecond
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+	hub.SetReady("abc", "m1", false)
+
+	hub.Unregister(alice)
+	waitForMembers(t, hub, 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hub.mu.RLock()
+		_, running := hub.sessions["abc"]
+		hub.mu.RUnlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the session's loop to stop once nobody is left")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	back := testClient(hub, "m1", "Alice")
+	hub.Register(back)
+	if msg := nextMsg(t, back, TypeSessionSnapshot); len(msg["members"].([]any)) != 1 {
+		t.Errorf("expected a fresh session with Alice in it, got %v", msg)
+	}
+}
+
+func TestHooksRunInOrderAcrossRetiredLoops(t *testing.T) {
+	hub := NewHub()
+	hub.disconnectGrace = time.Millisecond
+	var mu sync.Mutex
+	var calls []string
+	done := make(chan struct{}, 2)
+	hub.OnReadyChanged = func(sessionCode, memberID string, ready bool) {
+		if ready {
+			// Still saving when the loop that fired it retires
+			time.Sleep(50 * time.Millisecond)
+		}
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s ready %t", memberID, ready))
+		mu.Unlock()
+		done <- struct{}{}
+	}
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+	hub.SetReady("abc", "m1", true)
+	hub.Unregister(alice)
+	for {
+		hub.mu.RLock()
+		_, running := hub.sessions["abc"]
+		hub.mu.RUnlock()
+		if !running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	back := testClient(hub, "m1", "Alice")
+	hub.Register(back)
+	waitForMembers(t, hub, 1)
+	hub.SetReady("abc", "m1", false)
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for hooks")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"m1 ready true", "m1 ready false"}; !slices.Equal(calls, want) {
+		t.Errorf("expected hooks %v, got %v", want, calls)
+	}
+}
+
+// benchmarkSessions sets up n sessions with two members each, only one of whom the
+// benchmarks touch, so none of them move on from the lobby. They're torn down once
+// the benchmark is done.
+func benchmarkSessions(b *testing.B, n int) (*Hub, *benchmarkClients) {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	hub := NewHub()
+	hub.disconnectGrace = time.Millisecond
+	go hub.Run()
+
+	clients := &benchmarkClients{hub: hub}
+	for i := range n {
+		code := fmt.Sprintf("s%d", i)
+		for _, id := range []string{"m1", "m2"} {
+			client := testClient(hub, id, id)
+			client.sessionCode = code
+			hub.Register(client)
+			clients.add(client)
+		}
+	}
+	for i := range n {
+		for len(hub.GetConnectedMembers(fmt.Sprintf("s%d", i))) != 2 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	b.Cleanup(func() {
+		clients.disconnect()
+		for {
+			hub.mu.RLock()
+			running := len(hub.sessions)
+			hub.mu.RUnlock()
+			if running == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+	return hub, clients
+}
+
+// benchmarkClients reads what the benchmark clients are sent, counting the
+// member_ready frames the benchmarks send
+type benchmarkClients struct {
+	hub     *Hub
+	clients []*Client
+	reading sync.WaitGroup
+	ready   atomic.Int64
+}
+
+func (c *benchmarkClients) add(client *Client) {
+	c.clients = append(c.clients, client)
+	c.reading.Add(1)
+	go func() {
+		defer c.reading.Done()
+		for data := range client.send {
+			if bytes.Contains(data, []byte(`"type":"`+TypeMemberReady+`"`)) {
+				c.ready.Add(1)
+			}
+		}
+	}()
+}
+
+// disconnect unregisters every client and returns how many member_ready frames they
+// received, once they've read everything they were sent
+func (c *benchmarkClients) disconnect() int64 {
+	for _, client := range c.clients {
+		c.hub.Unregister(client)
+	}
+	c.reading.Wait()
+	return c.ready.Load()
+}
+
+// BenchmarkSetReady toggles members' ready flags in sessions picked at random, each
+// waiting on its session's loop, from as many goroutines as GOMAXPROCS
+func BenchmarkSetReady(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("sessions=%d", n), func(b *testing.B) {
+			hub, _ := benchmarkSessions(b, n)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := rand.IntN(n); pb.Next(); i++ {
+					code := fmt.Sprintf("s%d", (i*7919)%n)
+					if err := hub.SetReady(code, "m1", i%2 == 0); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "actions/s")
+		})
+	}
+}
+
+// BenchmarkBroadcastToSession sends frames to sessions picked at random and counts
+// the frames their members received. Frames skipped for a full client buffer are
+// reported rather than counted.
+func BenchmarkBroadcastToSession(b *testing.B) {
+	msg := MemberReadyMsg{Type: TypeMemberReady, MemberName: "m1", Ready: true}
+	for _, n := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("sessions=%d", n), func(b *testing.B) {
+			hub, clients := benchmarkSessions(b, n)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := rand.IntN(n); pb.Next(); i++ {
+					hub.BroadcastToSession(fmt.Sprintf("s%d", (i*7919)%n), msg)
+				}
+			})
+			received := clients.disconnect()
+			b.StopTimer()
+
+			b.ReportMetric(float64(received)/b.Elapsed().Seconds(), "frames/s")
+			b.ReportMetric(float64(2*int64(b.N)-received), "skipped")
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"consensus/models"
+	"consensus/projection"
+	"encoding/json"
+	"log"
+	"slices"
+)
+
+// snapshot sends a client the session as it stands. The hub's state is newer than
+// the session the client was loaded with, so it wins where they overlap, and the
+// snapshot is queued ahead of any frame sent after it. It's shaped for the client
+// once the hub's phase is in, so votes are hidden if voting opened since loading.
+func (s *session) snapshot(client *Client) {
+	session := models.Session{Code: s.code}
+	if client.session != nil {
+		session = *client.session
+	}
+	session.Phase = s.phase
+	session.Config = s.config
+	if s.forceStartStop == nil && s.graceStop == nil {
+		session.Countdown = nil
+	}
+	session = projection.Session(session, client.memberID)
+
+	msg := SessionSnapshotMsg{
+		Type:      TypeSessionSnapshot,
+		Seq:       s.log.last(),
+		Session:   session,
+		Members:   []string{},
+		Ready:     s.readyByName(),
+		Submitted: []string{},
+		Voted:     []string{},
+	}
+	for memberID, name := range s.names {
+		msg.Members = append(msg.Members, name)
+		if s.submitted[memberID] {
+			msg.Submitted = append(msg.Submitted, name)
+		}
+		if s.voted[memberID] {
+			msg.Voted = append(msg.Voted, name)
+		}
+	}
+	slices.Sort(msg.Members)
+	slices.Sort(msg.Submitted)
+	slices.Sort(msg.Voted)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("failed to marshal snapshot: %v", err)
+		return
+	}
+	s.push(client, data)
+}
+
+// connectedUsers sends a client the members connected to the session, the client
+// included. Like a reply it goes to the one connection and isn't numbered.
+func (s *session) connectedUsers(client *Client) {
+	msg := ConnectedUsersMsg{Type: TypeConnectedUsers, Members: []string{}}
+	for _, name := range s.names {
+		msg.Members = append(msg.Members, name)
+	}
+	slices.Sort(msg.Members)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("failed to marshal connected users: %v", err)
+		return
+	}
+	s.push(client, data)
+}
@@ -0,0 +1,93 @@
+package websocket
+
+import (
+	"consensus/phase"
+	"consensus/tally"
+)
+
+// Yes/no sessions can be voted a card at a time: each swipe is saved as it comes
+// in, so a phone that's put down keeps the votes it got through, and the member is
+// marked voted after their last card.
+
+// voteProgress is how far a member is through the round's cards
+type voteProgress struct {
+	cast  int
+	total int
+}
+
+// CastVote saves a member's vote on one choice, or takes it back when value is nil
+func (h *Hub) CastVote(sessionCode, memberID, choiceID string, value *int) error {
+	var yesNo bool
+	err := h.do(sessionCode, func(s *session) error {
+		yesNo = s.config.VotingMode == tally.ModeYesNo
+		return s.allowed(s.names[memberID], phase.SubmitVotes)
+	})
+	if err != nil {
+		return err
+	}
+	if !yesNo || h.SaveVote == nil {
+		return &ProtocolError{CodeInvalid, "votes are cast a card at a time only in yes/no sessions"}
+	}
+
+	cast, total, err := h.SaveVote(sessionCode, memberID, choiceID, value)
+	if err != nil {
+		return err
+	}
+	return h.do(sessionCode, func(s *session) error {
+		s.voteCast(memberID, choiceID, value, voteProgress{cast, total})
+		return nil
+	})
+}
+
+// voteCast tells a member their vote was saved, marking them voted after their last
+// card and not after they take one back
+func (s *session) voteCast(memberID, choiceID string, value *int, p voteProgress) {
+	s.setProgress(memberID, p)
+	s.send(memberID, VoteCastMsg{
+		Type:     TypeVoteCast,
+		ChoiceID: choiceID,
+		Value:    value,
+		Cast:     p.cast,
+		Total:    p.total,
+	})
+
+	if value != nil && p.cast == p.total {
+		s.markVoted(memberID)
+		return
+	}
+	if value != nil || !s.voted[memberID] {
+		return
+	}
+
+	// Taking back a card takes back being done
+	s.voted[memberID] = false
+	s.publishState(stateChange{Op: opVoted, MemberID: memberID})
+	s.progressChanged()
+	if s.graceStop != nil {
+		s.stopGrace()
+		s.broadcast(GraceCountdownMsg{
+			Type:      TypeGraceCountdown,
+			Action:    string(phase.SubmitVotes),
+			Cancelled: true,
+		})
+	}
+	s.broadcast(MemberUnsubmittedMsg{
+		Type:       TypeMemberUnsubmitted,
+		Action:     string(phase.SubmitVotes),
+		MemberName: s.names[memberID],
+	})
+}
+
+func (s *session) setProgress(memberID string, p voteProgress) {
+	s.restoreProgress(memberID, p)
+	s.progressChanged()
+	s.publishState(stateChange{Op: opProgress, MemberID: memberID, Cast: p.cast, Total: p.total})
+}
+
+// restoreProgress sets a member's progress without telling other instances
+func (s *session) restoreProgress(memberID string, p voteProgress) {
+	if s.progress == nil {
+		s.progress = make(map[string]voteProgress)
+	}
+	s.progress[memberID] = p
+}
@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"consensus/models"
+	"consensus/phase"
+	"consensus/tally"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCastVoteMarksVotedAfterLastCard(t *testing.T) {
+	hub := NewHub()
+	saved := map[string]int{}
+	hub.SaveVote = func(sessionCode, memberID, choiceID string, value *int) (int, int, error) {
+		if value == nil {
+			delete(saved, choiceID)
+		} else {
+			saved[choiceID] = *value
+		}
+		return len(saved), 2, nil
+	}
+	allVoted := make(chan string, 1)
+	hub.OnAllVoted = func(sessionCode string) { allVoted <- sessionCode }
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Results
+	alice.config = models.SessionConfig{VotingMode: "yes_no", GracePeriodSeconds: 30}
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+
+	yes, no := 1, 0
+	hub.CastVote("abc", "m1", "c1", &yes)
+	if msg := nextMsg(t, alice, TypeVoteCast); msg["cast"] != 1.0 || msg["total"] != 2.0 {
+		t.Errorf("expected one of two cards voted, got %v", msg)
+	}
+	hub.CastVote("abc", "m1", "c2", &no)
+	nextMsg(t, alice, TypeMemberVoted)
+	nextMsg(t, alice, TypeGraceCountdown)
+
+	// Taking back the last card takes back being done
+	hub.CastVote("abc", "m1", "c2", nil)
+	if msg := nextMsg(t, alice, TypeVoteCast); msg["value"] != nil || msg["cast"] != 1.0 {
+		t.Errorf("expected the vote taken back, got %v", msg)
+	}
+	if msg := nextMsg(t, alice, TypeMemberUnsubmitted); msg["memberName"] != "Alice" {
+		t.Errorf("expected Alice no longer voted, got %v", msg)
+	}
+	if _, ok := saved["c2"]; ok {
+		t.Error("expected the vote removed from storage")
+	}
+	select {
+	case <-allVoted:
+		t.Error("expected voting to wait on Alice's last card")
+	default:
+	}
+}
+
+func TestVotingDoesNotWaitOnEmptyVoters(t *testing.T) {
+	hub := NewHub()
+	allVoted := make(chan string, 1)
+	hub.OnAllVoted = func(sessionCode string) { allVoted <- sessionCode }
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Results
+	hub.Register(alice)
+	bob := testClient(hub, "m2", "Bob")
+	bob.phase = phase.Results
+	bob.emptyVoter = true
+	hub.Register(bob)
+	waitForMembers(t, hub, 2)
+
+	hub.MarkVoted("abc", "m1")
+	select {
+	case <-allVoted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected voting to end without Bob, who can't vote")
+	}
+}
+
+func TestCastVoteRefusedOutsideYesNo(t *testing.T) {
+	hub := NewHub()
+	hub.SaveVote = func(sessionCode, memberID, choiceID string, value *int) (int, int, error) {
+		t.Error("expected nothing saved")
+		return 0, 0, nil
+	}
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Results
+	alice.config = models.SessionConfig{VotingMode: "ranked_choice"}
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+
+	one := 1
+	if err := hub.CastVote("abc", "m1", "c1", &one); errorCode(err) != CodeInvalid {
+		t.Errorf("expected cast_vote refused, got %v", err)
+	}
+}
+
+func TestVotingProgressIsThrottled(t *testing.T) {
+	hub := NewHub()
+	hub.progressInterval = 50 * time.Millisecond
+	hub.SaveVote = func(sessionCode, memberID, choiceID string, value *int) (int, int, error) {
+		return 1, 4, nil
+	}
+	hub.RunningTotals = func(sessionCode string) (map[string]tally.Breakdown, error) {
+		t.Error("expected no running totals unless the session shows them")
+		return nil, nil
+	}
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Results
+	alice.config = models.SessionConfig{VotingMode: "yes_no"}
+	hub.Register(alice)
+	bob := testClient(hub, "m2", "Bob")
+	bob.phase = phase.Results
+	bob.config = alice.config
+	hub.Register(bob)
+	waitForMembers(t, hub, 2)
+
+	yes := 1
+	hub.CastVote("abc", "m1", "c1", &yes)
+	hub.MarkVoted("abc", "m2")
+
+	msg := nextMsg(t, alice, TypeVotingProgress)
+	if msg["done"] != 1.0 || msg["members"] != 2.0 {
+		t.Errorf("expected one of two members done, got %v", msg)
+	}
+	if percent := msg["percent"].(map[string]any); percent["Alice"] != 25.0 || percent["Bob"] != 100.0 {
+		t.Errorf("expected Alice a quarter through and Bob done, got %v", percent)
+	}
+	if _, ok := msg["totals"]; ok {
+		t.Error("expected no totals")
+	}
+
+	// Both changes went out together
+	time.Sleep(100 * time.Millisecond)
+	for len(alice.send) > 0 {
+		if data := <-alice.send; strings.Contains(string(data), TypeVotingProgress) {
+			t.Errorf("expected a single progress message, got another: %s", data)
+		}
+	}
+}
+
+func TestVotingProgressShowsLiveTotals(t *testing.T) {
+	hub := NewHub()
+	hub.progressInterval = time.Millisecond
+	hub.RunningTotals = func(sessionCode string) (map[string]tally.Breakdown, error) {
+		return map[string]tally.Breakdown{"c1": {Ballots: 1, Yes: 1}}, nil
+	}
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Results
+	alice.config = models.SessionConfig{VotingMode: "yes_no", LiveTotals: true}
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+
+	hub.MarkVoted("abc", "m1")
+	msg := nextMsg(t, alice, TypeVotingProgress)
+	if totals, ok := msg["totals"].(map[string]any); !ok || totals["c1"].(map[string]any)["yes"] != 1.0 {
+		t.Errorf("expected the running totals, got %v", msg["totals"])
+	}
+}
+
+func TestVotingProgressHidesLiveTotalsWhenAnonymous(t *testing.T) {
+	hub := NewHub()
+	hub.progressInterval = time.Millisecond
+	hub.RunningTotals = func(sessionCode string) (map[string]tally.Breakdown, error) {
+		t.Error("expected no running totals in an anonymous session")
+		return nil, nil
+	}
+	go hub.Run()
+
+	alice := testClient(hub, "m1", "Alice")
+	alice.phase = phase.Results
+	alice.config = models.SessionConfig{VotingMode: "yes_no", LiveTotals: true, Anonymity: true}
+	hub.Register(alice)
+	waitForMembers(t, hub, 1)
+
+	hub.MarkVoted("abc", "m1")
+	if msg := nextMsg(t, alice, TypeVotingProgress); msg["totals"] != nil {
+		t.Errorf("expected no totals alongside who is done, got %v", msg["totals"])
+	}
+}
@@ -1,7 +1,9 @@
 package websocket
 
 import (
+	"bytes"
 	"encoding/json"
+	"net/http"
 	"net/url"
 	"testing"
 	"time"
@@ -9,11 +11,48 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-func connect(t *testing.T, sessionCode, memberName string) *websocket.Conn {
-	u := url.URL{Scheme: "ws", Host: "localhost:8080", Path: "/api/session/" + sessionCode + "/ws", RawQuery: "name=" + memberName}
+const apiURL = "http://localhost:8080/api/session/"
+
+// hostSession creates a session over REST and returns its code and the host's token
+func hostSession(t *testing.T, name string) (string, string) {
+	body, _ := json.Marshal(map[string]any{
+		"name":   name,
+		"title":  "Test",
+		"config": map[string]any{"voting_mode": "yes_no", "max_choices": 1},
+	})
+	resp, err := http.Post(apiURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var created struct{ Code, Token string }
+	json.NewDecoder(resp.Body).Decode(&created)
+	return created.Code, created.Token
+}
+
+// joinSession joins a session over REST and returns the member's token
+func joinSession(t *testing.T, sessionCode, name string) string {
+	body, _ := json.Marshal(map[string]string{"name": name})
+	resp, err := http.Post(apiURL+sessionCode+"/join", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("join failed for %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("join returned %d for %s", resp.StatusCode, name)
+	}
+
+	var joined struct{ Token string }
+	json.NewDecoder(resp.Body).Decode(&joined)
+	return joined.Token
+}
+
+func connect(t *testing.T, sessionCode, token string) *websocket.Conn {
+	u := url.URL{Scheme: "ws", Host: "localhost:8080", Path: "/api/session/" + sessionCode + "/ws", RawQuery: "token=" + url.QueryEscape(token)}
 	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	if err != nil {
-		t.Fatalf("dial failed for %s: %v", memberName, err)
+		t.Fatalf("dial failed: %v", err)
 	}
 	return conn
 }
@@ -30,14 +69,15 @@ func readMsg(t *testing.T, conn *websocket.Conn) map[string]any {
 }
 
 func TestPhaseTransition(t *testing.T) {
-	sessionCode := "nqgj7e" // Session with Alice and Bob
+	sessionCode, aliceToken := hostSession(t, "Alice")
+	bobToken := joinSession(t, sessionCode, "Bob")
 
 	// Connect both clients
-	alice := connect(t, sessionCode, "Alice")
+	alice := connect(t, sessionCode, aliceToken)
 	defer alice.Close()
 	t.Log("Alice connected")
 
-	bob := connect(t, sessionCode, "Bob")
+	bob := connect(t, sessionCode, bobToken)
 	defer bob.Close()
 	t.Log("Bob connected")
 
@@ -85,18 +125,18 @@ func TestPhaseTransition(t *testing.T) {
 
 func TestRESTJoinBroadcast(t *testing.T) {
 	// This test requires a fresh session - create via REST
-	// For now, use an existing session code (update as needed)
-	sessionCode := "test01"
+	// For now, use an existing session code and host token (update as needed)
+	sessionCode, hostToken := "test01", ""
 
 	t.Log("This test requires manual setup:")
 	t.Log("1. Start server: go run main.go")
 	t.Log("2. Create session: curl -X POST localhost:8080/api/session/ -H 'Content-Type: application/json' -d '{\"name\":\"Host\",\"title\":\"Test\",\"config\":{\"voting_mode\":\"yes_no\",\"max_choices\":1}}'")
-	t.Log("3. Update sessionCode in this test")
+	t.Log("3. Update sessionCode and hostToken in this test")
 	t.Log("4. Run test")
 	t.Skip("Manual test - see instructions above")
 
 	// Connect as host via WebSocket
-	host := connect(t, sessionCode, "Host")
+	host := connect(t, sessionCode, hostToken)
 	defer host.Close()
 	t.Log("Host connected via WebSocket")
 
@@ -3,6 +3,17 @@
 // Unset → local dev default of http://localhost:8080.
 const API_ORIGIN = process.env.NEXT_PUBLIC_API_ORIGIN ?? "http://localhost:8080";
 const API_BASE_URL = `${API_ORIGIN}/api`;
+const SESSION_KEY = "consensus_session_data";
+
+// Token issued when creating or joining a session, identifying this member to the server
+function getMemberToken() {
+  const saved = JSON.parse(localStorage.getItem(SESSION_KEY) || "null");
+  return saved?.token ?? "";
+}
+
+function authHeaders() {
+  return { Authorization: `Bearer ${getMemberToken()}` };
+}
 
 async function hostSession(payload) {
   const url = `${API_BASE_URL}/session/`;
@@ -22,7 +33,8 @@ async function hostSession(payload) {
 
 async function getSession(code) {
   const url = `${API_BASE_URL}/session/${code}`;
-  const response = await fetch(url);
+  // Identifies us in anonymous sessions, so our own choices and votes stay attributed
+  const response = await fetch(url, { headers: authHeaders() });
 
   if (!response.ok) {
     throw new Error(`Response status: ${response.status}`);
@@ -46,12 +58,13 @@ async function joinSession(code, name) {
   return response.json();
 }
 
-async function addChoice(code, memberName, payload) {
-  const url = `${API_BASE_URL}/session/${code}/member/${encodeURIComponent(memberName)}/choice`;
+async function addChoice(code, payload) {
+  const url = `${API_BASE_URL}/session/${code}/me/choice`;
   const response = await fetch(url, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
+      ...authHeaders(),
     },
     body: JSON.stringify(payload),
   });
@@ -71,12 +84,13 @@ async function searchTMDB(query, page = 1) {
   return response.json();
 }
 
-async function updateChoice(code, memberName, oldTitle, title, comment) {
-  const url = `${API_BASE_URL}/session/${code}/member/${encodeURIComponent(memberName)}/choice/${encodeURIComponent(oldTitle)}`;
+async function updateChoice(code, choiceID, title, comment) {
+  const url = `${API_BASE_URL}/session/${code}/me/choice/${encodeURIComponent(choiceID)}`;
   const response = await fetch(url, {
     method: "PUT",
     headers: {
       "Content-Type": "application/json",
+      ...authHeaders(),
     },
     body: JSON.stringify({ title, comment }),
   });
@@ -87,9 +101,9 @@ async function updateChoice(code, memberName, oldTitle, title, comment) {
   return response.json();
 }
 
-async function getMemberChoices(code, memberName) {
-  const url = `${API_BASE_URL}/session/${code}/member/${encodeURIComponent(memberName)}/choice`;
-  const response = await fetch(url);
+async function getMemberChoices(code) {
+  const url = `${API_BASE_URL}/session/${code}/me/choice`;
+  const response = await fetch(url, { headers: authHeaders() });
 
   if (!response.ok) {
     throw new Error(`Response status: ${response.status}`);
@@ -97,10 +111,11 @@ async function getMemberChoices(code, memberName) {
   return response.json();
 }
 
-async function removeChoice(code, memberName, title) {
-  const url = `${API_BASE_URL}/session/${code}/member/${encodeURIComponent(memberName)}/choice/${encodeURIComponent(title)}`;
+async function removeChoice(code, choiceID) {
+  const url = `${API_BASE_URL}/session/${code}/me/choice/${encodeURIComponent(choiceID)}`;
   const response = await fetch(url, {
     method: "DELETE",
+    headers: authHeaders(),
   });
 
   if (!response.ok) {
@@ -109,10 +124,11 @@ async function removeChoice(code, memberName, title) {
   return response.json();
 }
 
-async function clearChoices(code, memberName) {
-  const url = `${API_BASE_URL}/session/${code}/member/${encodeURIComponent(memberName)}/choice`;
+async function clearChoices(code) {
+  const url = `${API_BASE_URL}/session/${code}/me/choice`;
   const response = await fetch(url, {
     method: "DELETE",
+    headers: authHeaders(),
   });
 
   if (!response.ok) {
@@ -121,12 +137,13 @@ async function clearChoices(code, memberName) {
   return response.json();
 }
 
-async function submitVotes(code, memberName, votes) {
-  const url = `${API_BASE_URL}/session/${code}/member/${encodeURIComponent(memberName)}/votes`;
+// ballotID lets the server ignore a retry of a ballot it already stored
+async function submitVotes(code, votes, ballotID) {
+  const url = `${API_BASE_URL}/session/${code}/me/votes`;
   const response = await fetch(url, {
     method: "POST",
-    headers: { "Content-Type": "application/json" },
-    body: JSON.stringify({ votes }),
+    headers: { "Content-Type": "application/json", ...authHeaders() },
+    body: JSON.stringify({ ballotID, votes }),
   });
   if (!response.ok) throw new Error(`Response status: ${response.status}`);
   return response.json();
@@ -138,6 +155,7 @@ async function updateSessionConfig(code, newConfig) {
     method: "PUT",
     headers: {
       "Content-Type": "application/json",
+      ...authHeaders(),
     },
     body: JSON.stringify({ newConfig }),
   });
@@ -148,14 +166,14 @@ async function updateSessionConfig(code, newConfig) {
   return response.json();
 }
 
-async function closeSession(code, name) {
+async function closeSession(code) {
   const url = `${API_BASE_URL}/session/${code}/close`;
   const response = await fetch(url, {
     method: "PUT",
     headers: {
       "Content-Type": "application/json",
+      ...authHeaders(),
     },
-    body: JSON.stringify({ name }),
   });
 
   if (!response.ok) {
@@ -164,14 +182,14 @@ async function closeSession(code, name) {
   return response.json();
 }
 
-async function leaveSession(code, name) {
+async function leaveSession(code) {
   const url = `${API_BASE_URL}/session/${code}/leave`;
   const response = await fetch(url, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
+      ...authHeaders(),
     },
-    body: JSON.stringify({ name }),
   });
 
   if (!response.ok) {
@@ -180,12 +198,13 @@ async function leaveSession(code, name) {
   return response.json();
 }
 
-async function updateMember(code, memberName, newName) {
-  const url = `${API_BASE_URL}/session/${code}/member/${encodeURIComponent(memberName)}`;
+async function updateMember(code, newName) {
+  const url = `${API_BASE_URL}/session/${code}/me`;
   const response = await fetch(url, {
     method: "PUT",
     headers: {
       "Content-Type": "application/json",
+      ...authHeaders(),
     },
     body: JSON.stringify({ newName }),
   });
@@ -219,6 +238,7 @@ export {
   clearChoices,
   closeSession,
   getMemberChoices,
+  getMemberToken,
   getResults,
   getSession,
   hostSession,
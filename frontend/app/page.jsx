@@ -107,6 +107,8 @@ export default function Home() {
     max_choices: 3,
     grace_period_seconds: 3,
     allow_empty_voters: false,
+    async: false,
+    live_totals: false,
   });
   const [touched, setTouched] = useState({
     name: false,
@@ -137,6 +139,8 @@ export default function Home() {
         max_choices: sessionConfig.max_choices,
         grace_period_seconds: sessionConfig.grace_period_seconds,
         allow_empty_voters: sessionConfig.allow_empty_voters,
+        async: sessionConfig.async,
+        live_totals: sessionConfig.live_totals,
         integration: sessionConfig.integration,
       },
     };
@@ -152,6 +156,7 @@ export default function Home() {
             code: response.Code,
             title: payload.title,
             host: true,
+            token: response.Token,
           })
         );
         router.push(`/s/${response.Code}`);
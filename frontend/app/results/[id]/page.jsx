@@ -31,6 +31,21 @@ export default function ResultsPage() {
   const [shareOpen, setShareOpen] = useState(false);
   const [showCopyCheckmark, setShowCopyCheckmark] = useState(false);
 
+  const describeBreakdown = (breakdown) => {
+    let summary;
+    if (results.votingMode === "yes_no") {
+      summary = `${breakdown.yes ?? 0} yes, ${breakdown.no ?? 0} no`;
+    } else if (["ranked_choice", "instant_runoff", "condorcet"].includes(results.votingMode)) {
+      summary = `average rank ${(breakdown.average ?? 0).toFixed(1)}`;
+    } else {
+      summary = `average score ${(breakdown.average ?? 0).toFixed(1)}`;
+    }
+    if (breakdown.marks?.length > 0) {
+      summary += ` · ${breakdown.marks.map((m) => `${m.voter}: ${m.value}`).join(", ")}`;
+    }
+    return summary;
+  };
+
   const tmdbPoster = (path, size = "w92") =>
     path ? `https://image.tmdb.org/t/p/${size}${path}` : null;
 
@@ -160,14 +175,21 @@ export default function ResultsPage() {
                     )}
                   </div>
                   <div className="flex items-center gap-3 shrink-0">
-                    {choice.memberName && (
-                      <span className="text-xs text-muted-foreground">{choice.memberName}</span>
+                    {choice.proposers?.length > 0 && (
+                      <span className="text-xs text-muted-foreground">
+                        {choice.proposers.map((p) => p.memberName).join(", ")}
+                      </span>
                     )}
                     <span className="text-sm font-medium text-green-700">
-                      {choice.rank} {isRankedChoice ? "pts" : "yes"}
+                      {choice.score} {isRankedChoice ? "pts" : "yes"}
                     </span>
                   </div>
                 </div>
+                {results.breakdowns?.[choice.id] && (
+                  <p className="text-xs text-muted-foreground px-4 pb-2 ml-7">
+                    {describeBreakdown(results.breakdowns[choice.id])}
+                  </p>
+                )}
                 {expandedComments[index] && (
                   <p className="text-sm text-muted-foreground px-4 pb-2 ml-7">
                     {choice.integration === "tmdb" ? choice.description : choice.comment}
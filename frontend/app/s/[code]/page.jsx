@@ -190,6 +190,7 @@ export default function SessionPage() {
   const [needsToJoin, setNeedsToJoin] = useState(false);
   const [errorMessage, setErrorMessage] = useState(null);
   const [choices, setChoices] = useState([]);
+  const [poolChoices, setPoolChoices] = useState([]); // everyone's choices, kept up to date as they're added
   const [allChoices, setAllChoices] = useState([]);
   const [newChoiceTitle, setNewChoiceTitle] = useState("");
   const [newChoiceComment, setNewChoiceComment] = useState("");
@@ -202,8 +203,10 @@ export default function SessionPage() {
   const [shareOpen, setShareOpen] = useState(false);
   const [showJoinCodeCheckmark, setShowJoinCodeCheckmark] = useState(false);
   const descriptionRef = useRef(null);
+  const ballotIDRef = useRef(null); // reused if a submission fails, so a retry isn't counted twice
   const [localVotes, setLocalVotes] = useState({});
   const [currentChoiceIndex, setCurrentChoiceIndex] = useState(0);
+  const [votingProgress, setVotingProgress] = useState(null);
   const [inVoteReview, setInVoteReview] = useState(false);
   const [rankedOrder, setRankedOrder] = useState([]); // array of choice titles in ranked order
   const [editingChoiceTitle, setEditingChoiceTitle] = useState(null);
@@ -217,6 +220,7 @@ export default function SessionPage() {
   const [editConfig, setEditConfig] = useState(null);
   const [closedCountdown, setClosedCountdown] = useState(null);
   const [forceStartCountdown, setForceStartCountdown] = useState(null);
+  const [graceCountdown, setGraceCountdown] = useState(null);
   const [isEditingName, setIsEditingName] = useState(false);
   const [editNameValue, setEditNameValue] = useState("");
   const [editNameError, setEditNameError] = useState(null);
@@ -309,14 +313,20 @@ export default function SessionPage() {
       return;
     }
     setForceStartCountdown(null);
+    setGraceCountdown(null);
+    // A runoff is another round of voting on the remaining choices
+    const isRunoff = phase === "runoff";
+    if (isRunoff) phase = "results";
     setSessionState((prev) => ({
       ...prev,
       phase,
       ready: readyMap,
+      ...(isRunoff && { voted: {} }),
     }));
     if (phase === "results") {
       setAllChoices(choices?.length > 0 ? choices : []);
       setLocalVotes({});
+      setVotingProgress(null);
       setCurrentChoiceIndex(0);
       setInVoteReview(false);
       if (choices?.length > 0) {
@@ -327,6 +337,48 @@ export default function SessionPage() {
     }
   }, [router]);
 
+  // Sent on connect with the whole session, so nothing missed while away is stale
+  const handleSessionSnapshot = useCallback((snapshot) => {
+    const { session } = snapshot;
+    if (session.phase === "final" && session.permalink) {
+      handlePhaseChanged(session.phase, snapshot.ready, [], session.permalink);
+      return;
+    }
+    const submitted = Object.fromEntries(snapshot.submitted.map((name) => [name, true]));
+    const voted = Object.fromEntries(snapshot.voted.map((name) => [name, true]));
+    const host = session.members?.find((m) => m.host)?.name;
+    setSessionState((prev) => {
+      let phase = session.phase === "runoff" ? "results" : session.phase;
+      if (phase === "voting" && submitted[prev.myName]) {
+        phase = "submitted";
+      } else if (phase === "results" && voted[prev.myName]) {
+        phase = "submitted_votes";
+      }
+      return {
+        ...prev,
+        members: snapshot.members,
+        host: host ?? prev.host,
+        ready: snapshot.ready,
+        submitted,
+        voted,
+        phase,
+        config: session.config,
+      };
+    });
+    setPoolChoices(session.choices ?? []);
+    if (session.phase === "results" || session.phase === "runoff") {
+      setAllChoices((prev) => (prev.length > 0 ? prev : session.finalizedChoices ?? []));
+      // Yes/no votes are saved a card at a time, so pick up where this member left off
+      const myID = session.members?.find((m) => m.name === sessionStateRef.current.myName)?.id;
+      const saved = {};
+      session.choices?.forEach((c) => {
+        const vote = c.votes?.find((v) => v.memberID === myID && v.round === session.round);
+        if (vote) saved[c.title] = vote.value;
+      });
+      setLocalVotes((prev) => (Object.keys(prev).length > 0 ? prev : saved));
+    }
+  }, [handlePhaseChanged]);
+
   const handleConnectedUsers = useCallback((connectedMembers) => {
     setSessionState((prev) => {
       // Filter members to only those currently connected
@@ -349,9 +401,29 @@ export default function SessionPage() {
     }));
   }, []);
 
+  const handleChoiceAdded = useCallback((choice) => {
+    setPoolChoices((prev) => [...prev.filter((c) => c.id !== choice.id), choice]);
+  }, []);
+
+  const handleChoiceUpdated = useCallback((choice) => {
+    setPoolChoices((prev) =>
+      prev.some((c) => c.id === choice.id) ? prev.map((c) => (c.id === choice.id ? choice : c)) : [...prev, choice]
+    );
+  }, []);
+
+  const handleChoiceRemoved = useCallback((choiceID) => {
+    setPoolChoices((prev) => prev.filter((c) => c.id !== choiceID));
+  }, []);
+
+  const handleVotingProgress = useCallback((progress) => {
+    setVotingProgress(progress);
+  }, []);
+
   const handleMemberVoted = useCallback((memberName) => {
     setSessionState((prev) => ({
       ...prev,
+      // Swiping the last yes/no card marks this member voted without a submit
+      ...(memberName === prev.myName && prev.phase === "results" && { phase: "submitted_votes" }),
       voted: { ...prev.voted, [memberName]: true },
     }));
   }, []);
@@ -379,6 +451,33 @@ export default function SessionPage() {
     }
   }, []);
 
+  const handleGraceCountdown = useCallback((action, countdown, cancelled) => {
+    setGraceCountdown(cancelled ? null : countdown);
+  }, []);
+
+  const handleMemberUnsubmitted = useCallback((action, memberName) => {
+    const key = action === "submit_choices" ? "submitted" : "voted";
+    setSessionState((prev) => {
+      const next = { ...prev, [key]: { ...prev[key], [memberName]: false } };
+      if (memberName === prev.myName) {
+        next.phase = action === "submit_choices" ? "voting" : "results";
+      }
+      return next;
+    });
+  }, []);
+
+  // The server refused one of our messages; undo what we assumed it would do
+  const handleServerError = useCallback((action, message) => {
+    toast.error(message);
+    if (action === "submit_choices") {
+      setSessionState((prev) => ({
+        ...prev,
+        phase: prev.phase === "submitted" ? "voting" : prev.phase,
+        submitted: { ...prev.submitted, [prev.myName]: false },
+      }));
+    }
+  }, []);
+
   const handleMemberNameChanged = useCallback((oldName, newName) => {
     setSessionState((prev) => {
       const renameKey = (obj) => {
@@ -439,7 +538,7 @@ export default function SessionPage() {
     return () => clearTimeout(timer);
   }, [closedCountdown, router]);
 
-  const { isConnected, connect, disconnect, setReady, submitChoices, submitVotes: submitVotesWS, forceStart, cancelForceStart } = useSessionWebSocket(
+  const { isConnected, connect, disconnect, setReady, submitChoices, unsubmit, forceStart, cancelForceStart, castVote, undoVote } = useSessionWebSocket(
     sessionState.code,
     sessionState.myName,
     {
@@ -455,6 +554,14 @@ export default function SessionPage() {
       onHostChanged: handleHostChanged,
       onForceStartCountdown: handleForceStartCountdown,
       onMemberNameChanged: handleMemberNameChanged,
+      onGraceCountdown: handleGraceCountdown,
+      onMemberUnsubmitted: handleMemberUnsubmitted,
+      onSessionSnapshot: handleSessionSnapshot,
+      onVotingProgress: handleVotingProgress,
+      onChoiceAdded: handleChoiceAdded,
+      onChoiceUpdated: handleChoiceUpdated,
+      onChoiceRemoved: handleChoiceRemoved,
+      onError: handleServerError,
     }
   );
 
@@ -470,7 +577,7 @@ export default function SessionPage() {
   // Load choices when entering voting phase
   useEffect(() => {
     if (sessionState.phase === "voting" && sessionState.code && sessionState.myName) {
-      getMemberChoices(sessionState.code, sessionState.myName)
+      getMemberChoices(sessionState.code)
         .then((response) => {
           setChoices(response.choices || []);
         })
@@ -522,22 +629,41 @@ export default function SessionPage() {
     (c) => localVotes[c.title] === undefined
   ).length;
 
+  // Each yes/no vote is saved as it's made, so a phone put down mid-vote keeps them
+  const swipeVote = (choice, value) => {
+    setLocalVotes((prev) => ({ ...prev, [choice.title]: value }));
+    castVote(choice.id, value);
+  };
+
+  // Steps back a card, taking back the vote on it
+  const undoSwipe = () => {
+    const choice = allChoices[currentChoiceIndex - 1];
+    if (!choice) return;
+    setLocalVotes((prev) => {
+      const { [choice.title]: _, ...rest } = prev;
+      return rest;
+    });
+    undoVote(choice.id);
+    setCurrentChoiceIndex((i) => i - 1);
+  };
+
   const handleSubmitVotes = async () => {
     let votes;
     if (isRankedChoice) {
       votes = rankedOrder.map((title, index) => ({
-        choiceTitle: title,
+        choiceID: allChoices.find((c) => c.title === title)?.id,
         value: index + 1, // 1-based rank
       }));
     } else {
       votes = allChoices.map((c) => ({
-        choiceTitle: c.title,
+        choiceID: c.id,
         value: localVotes[c.title] ?? 0,
       }));
     }
     try {
-      await submitVotes(sessionState.code, sessionState.myName, votes);
-      submitVotesWS();
+      ballotIDRef.current ??= crypto.randomUUID();
+      await submitVotes(sessionState.code, votes, ballotIDRef.current);
+      ballotIDRef.current = null;
       setSessionState((prev) => ({
         ...prev,
         phase: "submitted_votes",
@@ -586,7 +712,7 @@ export default function SessionPage() {
       return;
     }
     try {
-      const res = await addChoice(sessionState.code, sessionState.myName, {
+      const res = await addChoice(sessionState.code, {
         integration: "tmdb",
         integrationID: String(movie.id),
       });
@@ -609,8 +735,8 @@ export default function SessionPage() {
       return;
     }
     try {
-      await addChoice(sessionState.code, sessionState.myName, { title: trimmedTitle, comment: trimmedComment });
-      setChoices((prev) => [...prev, { title: trimmedTitle, comment: trimmedComment }]);
+      const res = await addChoice(sessionState.code, { title: trimmedTitle, comment: trimmedComment });
+      setChoices((prev) => [...prev, res.choice]);
       setNewChoiceTitle("");
       setNewChoiceComment("");
     } catch (e) {
@@ -621,8 +747,10 @@ export default function SessionPage() {
 
   const handleRemoveChoice = async (title) => {
     try {
-      await removeChoice(sessionState.code, sessionState.myName, title);
-      setChoices((prev) => prev.filter((c) => c.title !== title));
+      const choice = choices.find((c) => c.title === title);
+      if (!choice) return;
+      await removeChoice(sessionState.code, choice.id);
+      setChoices((prev) => prev.filter((c) => c.id !== choice.id));
     } catch (e) {
       console.error("Failed to remove choice:", e);
       toast.error("Failed to remove choice");
@@ -631,7 +759,7 @@ export default function SessionPage() {
 
   const handleClearChoices = async () => {
     try {
-      await clearChoices(sessionState.code, sessionState.myName);
+      await clearChoices(sessionState.code);
       setChoices([]);
       toast.success("All choices cleared");
     } catch (e) {
@@ -645,8 +773,10 @@ export default function SessionPage() {
     const trimmedComment = (comment || "").trim();
     if (!trimmedTitle) return;
     try {
-      await updateChoice(sessionState.code, sessionState.myName, oldTitle, trimmedTitle, trimmedComment);
-      setChoices((prev) => prev.map((c) => c.title === oldTitle ? { ...c, title: trimmedTitle, comment: trimmedComment } : c));
+      const choice = choices.find((c) => c.title === oldTitle);
+      if (!choice) return;
+      const res = await updateChoice(sessionState.code, choice.id, trimmedTitle, trimmedComment);
+      setChoices((prev) => prev.map((c) => c.id === choice.id ? res.choice : c));
     } catch (e) {
       console.error("Failed to edit choice:", e);
       toast.error("Failed to edit choice");
@@ -660,7 +790,7 @@ export default function SessionPage() {
     const savedSession = JSON.parse(localStorage.getItem(SESSION_KEY));
 
     // If we have saved session data for this session, try to rejoin
-    if (savedSession?.code === sessionCode && savedSession?.name) {
+    if (savedSession?.code === sessionCode && savedSession?.name && savedSession?.token) {
       getSession(sessionCode)
         .then((response) => {
           const closedAt = new Date(response.Session.closed_at);
@@ -681,7 +811,7 @@ export default function SessionPage() {
           const submitted = {};
           const voted = {};
           response.Session.members.forEach((m) => {
-            ready[m.name] = false;
+            ready[m.name] = Boolean(m.ready);
             if (m.submitted) submitted[m.name] = true;
             if (m.voted) voted[m.name] = true;
           });
@@ -710,10 +840,10 @@ export default function SessionPage() {
           // If this member already submitted/voted, show the waiting screen
           const mySubmitted = submitted[savedSession.name];
           const myVoted = voted[savedSession.name];
-          let effectivePhase = phase;
+          let effectivePhase = phase === "runoff" ? "results" : phase;
           if (phase === "voting" && mySubmitted) {
             effectivePhase = "submitted";
-          } else if (phase === "results" && myVoted) {
+          } else if (effectivePhase === "results" && myVoted) {
             effectivePhase = "submitted_votes";
           }
 
@@ -790,7 +920,7 @@ export default function SessionPage() {
         const isHost = response.Session.members.find((m) => m.name === joinName)?.host || false;
         localStorage.setItem(
           SESSION_KEY,
-          JSON.stringify({ name: joinName, code: sessionCode, title: response.Session.title, host: isHost })
+          JSON.stringify({ name: joinName, code: sessionCode, title: response.Session.title, host: isHost, token: response.Token })
         );
 
         setSessionState({
@@ -989,7 +1119,7 @@ export default function SessionPage() {
                                 if (!trimmed || trimmed === sessionState.myName) return;
                                 setIsSavingName(true);
                                 try {
-                                  await updateMember(sessionState.code, sessionState.myName, trimmed);
+                                  await updateMember(sessionState.code, trimmed);
                                   setIsEditingName(false);
                                   setEditNameValue("");
                                   setEditNameError(null);
@@ -1021,6 +1151,7 @@ export default function SessionPage() {
                             setEditConfig({
                               anonymity: sessionState.config?.anonymity || false,
                               allow_empty_voters: sessionState.config?.allow_empty_voters || false,
+                              live_totals: sessionState.config?.live_totals || false,
                               min_choices: sessionState.config?.min_choices || 0,
                               max_choices: sessionState.config?.max_choices || 0,
                               voting_mode: sessionState.config?.voting_mode || "yes_no",
@@ -1049,6 +1180,10 @@ export default function SessionPage() {
                           <span className="text-muted-foreground">Allow everyone to vote</span>
                           <span>{sessionState.config?.allow_empty_voters ? "Yes" : "No"}</span>
                         </div>
+                        <div className="flex justify-between">
+                          <span className="text-muted-foreground">Show votes while voting</span>
+                          <span>{sessionState.config?.live_totals ? "Yes" : "No"}</span>
+                        </div>
                         <div className="flex justify-between">
                           <span className="text-muted-foreground">Number of choices</span>
                           <span>{sessionState.config?.min_choices || 0} - {sessionState.config?.max_choices || 0}</span>
@@ -1080,6 +1215,14 @@ export default function SessionPage() {
                           />
                           <Label htmlFor="edit-allow-empty">Allow everyone to vote</Label>
                         </div>
+                        <div className="flex items-center space-x-2">
+                          <Checkbox
+                            id="edit-live-totals"
+                            checked={editConfig.live_totals}
+                            onCheckedChange={(checked) => setEditConfig({ ...editConfig, live_totals: Boolean(checked) })}
+                          />
+                          <Label htmlFor="edit-live-totals">Show votes while voting</Label>
+                        </div>
                         <div className="flex flex-col gap-2">
                           <Label>Number of choices</Label>
                           <div className="flex flex-row space-x-4">
@@ -1192,13 +1335,13 @@ export default function SessionPage() {
                               setIsLeavingSession(true);
                               try {
                                 if (sessionState.myName === sessionState.host) {
-                                  await closeSession(sessionState.code, sessionState.myName);
+                                  await closeSession(sessionState.code);
                                   disconnect();
                                   setIsRedirecting(true);
                                   localStorage.removeItem(SESSION_KEY);
                                   router.push("/");
                                 } else {
-                                  await leaveSession(sessionState.code, sessionState.myName);
+                                  await leaveSession(sessionState.code);
                                   localStorage.removeItem(SESSION_KEY);
                                   router.push("/");
                                 }
@@ -1485,6 +1628,20 @@ export default function SessionPage() {
               </p>
             )}
 
+            {/* Everyone's choices, so the same one isn't added twice */}
+            {poolChoices.length > 0 && (
+              <div className="mb-4">
+                <div className="text-sm font-medium mb-1">Added so far ({poolChoices.length})</div>
+                <ul className="flex flex-wrap gap-1 text-xs">
+                  {poolChoices.map((choice) => (
+                    <li key={choice.id} className="px-2 py-0.5 rounded-full bg-muted text-muted-foreground">
+                      {choice.integration === "tmdb" ? tmdbTitleWithYear(choice.title, choice.releaseDate) : choice.title}
+                    </li>
+                  ))}
+                </ul>
+              </div>
+            )}
+
             {/* Validation warning */}
             {choices.length > 0 && (
               choices.length < sessionState.config.min_choices ? (
@@ -1588,6 +1745,16 @@ export default function SessionPage() {
                 {membersWhoHaventSubmitted.length !== 1 ? "s" : ""} to submit their list
               </span>
             </div>
+            {graceCountdown !== null && (
+              <div className="flex items-center justify-between mt-4">
+                <span className="text-sm font-semibold animate-pulse">
+                  Moving on in {graceCountdown}...
+                </span>
+                <Button variant="outline" size="sm" onClick={unsubmit}>
+                  Unsubmit
+                </Button>
+              </div>
+            )}
             <ul className="mt-2 space-y-1 text-sm">
               {sessionState.members.map((m) => (
                 <li key={m} className="flex items-center gap-2">
@@ -1697,7 +1864,7 @@ export default function SessionPage() {
                   variant="outline"
                   className="w-24 border-red-300 text-red-600 hover:bg-red-50"
                   onClick={() => {
-                    setLocalVotes((prev) => ({ ...prev, [allChoices[currentChoiceIndex].title]: 0 }));
+                    swipeVote(allChoices[currentChoiceIndex], 0);
                     if (currentChoiceIndex === allChoices.length - 1) {
                       setInVoteReview(true);
                     } else {
@@ -1711,7 +1878,7 @@ export default function SessionPage() {
                   size="lg"
                   className="w-24 bg-green-600 hover:bg-green-700"
                   onClick={() => {
-                    setLocalVotes((prev) => ({ ...prev, [allChoices[currentChoiceIndex].title]: 1 }));
+                    swipeVote(allChoices[currentChoiceIndex], 1);
                     if (currentChoiceIndex === allChoices.length - 1) {
                       setInVoteReview(true);
                     } else {
@@ -1743,6 +1910,11 @@ export default function SessionPage() {
                   <Image src="/arrow-small-right.svg" alt="Next" loading="eager" width={20} height={20} />
                 </Button>
               </div>
+              {currentChoiceIndex > 0 && localVotes[allChoices[currentChoiceIndex - 1]?.title] !== undefined && (
+                <Button variant="ghost" size="sm" onClick={undoSwipe}>
+                  Undo last vote
+                </Button>
+              )}
               {currentChoiceIndex === allChoices.length - 1 && (
                 <Button className="w-full" onClick={() => setInVoteReview(true)}>
                   Review Votes
@@ -1929,7 +2101,7 @@ export default function SessionPage() {
                 variant="outline"
                 className="border-red-300 text-red-600 hover:bg-red-50"
                 onClick={() => {
-                  setLocalVotes((prev) => ({ ...prev, [editingChoiceTitle]: 0 }));
+                  swipeVote(allChoices.find((c) => c.title === editingChoiceTitle), 0);
                   setEditingChoiceTitle(null);
                 }}
               >
@@ -1938,7 +2110,7 @@ export default function SessionPage() {
               <Button
                 className="bg-green-600 hover:bg-green-700"
                 onClick={() => {
-                  setLocalVotes((prev) => ({ ...prev, [editingChoiceTitle]: 1 }));
+                  swipeVote(allChoices.find((c) => c.title === editingChoiceTitle), 1);
                   setEditingChoiceTitle(null);
                 }}
               >
@@ -2012,6 +2184,21 @@ export default function SessionPage() {
                 {membersWhoHaventVoted.length !== 1 ? "s" : ""} to submit their votes
               </span>
             </div>
+            {votingProgress && (
+              <p className="text-sm text-muted-foreground mb-2">
+                {votingProgress.done} of {votingProgress.members} members done
+              </p>
+            )}
+            {graceCountdown !== null && (
+              <div className="flex items-center justify-between mt-4">
+                <span className="text-sm font-semibold animate-pulse">
+                  Moving on in {graceCountdown}...
+                </span>
+                <Button variant="outline" size="sm" onClick={unsubmit}>
+                  Unsubmit
+                </Button>
+              </div>
+            )}
             <ul className="mt-2 space-y-1 text-sm">
               {sessionState.members.map((m) => (
                 <li key={m} className="flex items-center gap-2">
@@ -2025,9 +2212,26 @@ export default function SessionPage() {
                     {m === sessionState.host && <img src="/star-user.svg" alt="Host" title="Host" width={14} height={14} />}
                     {m === sessionState.myName && " (you)"}
                   </span>
+                  {!sessionState.voted[m] && votingProgress?.percent?.[m] > 0 && (
+                    <span className="ml-auto text-xs text-muted-foreground">{votingProgress.percent[m]}%</span>
+                  )}
                 </li>
               ))}
             </ul>
+            {votingProgress?.totals && (
+              <div className="mt-4 space-y-1 text-sm">
+                <div className="font-medium">Votes so far</div>
+                {allChoices.map((c) => {
+                  const t = votingProgress.totals[c.id];
+                  return (
+                    <div key={c.id} className="flex justify-between text-muted-foreground">
+                      <span className="truncate">{c.title}</span>
+                      <span>{sessionState.config?.voting_mode === "yes_no" ? `${t?.yes ?? 0} yes` : `${t?.ballots ?? 0} votes`}</span>
+                    </div>
+                  );
+                })}
+              </div>
+            )}
           </CardContent>
         </Card>
       )}
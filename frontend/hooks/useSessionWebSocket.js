@@ -1,6 +1,7 @@
 "use client";
 
 import { useCallback, useEffect, useRef, useState } from "react";
+import { getMemberToken } from "@/app/api";
 
 // NEXT_PUBLIC_API_ORIGIN is baked in at build time.
 // Empty string → derive from window.location (prod, same-origin via nginx).
@@ -17,6 +18,9 @@ function getWSBaseURL() {
   return "ws://localhost:8080/api";
 }
 
+// Version of the envelope messages are sent in, see backend/websocket/asyncapi.json
+const PROTOCOL_VERSION = 1;
+
 export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
   const [isConnected, setIsConnected] = useState(false);
   const [webSocketError, setWebsocketError] = useState(null);
@@ -26,6 +30,9 @@ export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
   const shouldReconnectRef = useRef(true);
   const connectRef = useRef(null);
   const memberNameRef = useRef(memberName);
+  const lastSeqRef = useRef(0); // seq of the last message seen, so a reconnect gets what it missed
+  const nextIdRef = useRef(0);
+  const pendingRef = useRef(new Map()); // id → resolve, for messages waiting on their ack or error
 
   // Keep handlers ref updated
   useEffect(() => {
@@ -41,7 +48,10 @@ export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
     const name = memberNameRef.current;
     if (!sessionCode || !name) return;
 
-    const url = `${getWSBaseURL()}/session/${sessionCode}/ws?name=${encodeURIComponent(name)}`;
+    let url = `${getWSBaseURL()}/session/${sessionCode}/ws?token=${encodeURIComponent(getMemberToken())}`;
+    if (lastSeqRef.current) {
+      url += `&since=${lastSeqRef.current}`;
+    }
 
     try {
       const ws = new WebSocket(url);
@@ -55,6 +65,12 @@ export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
         setIsConnected(false);
         wsRef.current = null;
 
+        // Messages still waiting won't be answered on a new connection
+        for (const resolve of pendingRef.current.values()) {
+          resolve({ type: "error", code: "disconnected", message: "Connection lost" });
+        }
+        pendingRef.current.clear();
+
         // Reconnect unless it was a clean close or we've disconnected intentionally
         if (!event.wasClean && shouldReconnectRef.current) {
           reconnectTimeoutRef.current = setTimeout(() => {
@@ -72,7 +88,10 @@ export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
       ws.onmessage = (event) => {
         try {
           const message = JSON.parse(event.data);
-          const { onMemberJoined, onMemberLeft, onMemberReady, onPhaseChanged, onConnectedUsers, onMemberSubmitted, onMemberVoted, onSessionClosed, onConfigUpdated, onHostChanged, onForceStartCountdown, onMemberNameChanged } = handlersRef.current;
+          if (message.seq) {
+            lastSeqRef.current = message.seq;
+          }
+          const { onMemberJoined, onMemberLeft, onMemberReady, onPhaseChanged, onConnectedUsers, onMemberSubmitted, onMemberVoted, onSessionClosed, onConfigUpdated, onHostChanged, onForceStartCountdown, onMemberNameChanged, onGraceCountdown, onMemberUnsubmitted, onSessionSnapshot, onVotingProgress, onChoiceAdded, onChoiceUpdated, onChoiceRemoved, onError } = handlersRef.current;
 
           switch (message.type) {
             case "member_joined":
@@ -115,6 +134,36 @@ export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
             case "member_name_changed":
               onMemberNameChanged?.(message.oldName, message.newName);
               break;
+            case "grace_countdown":
+              onGraceCountdown?.(message.action, message.countdown, message.cancelled);
+              break;
+            case "member_unsubmitted":
+              onMemberUnsubmitted?.(message.action, message.memberName);
+              break;
+            case "choice_added":
+              onChoiceAdded?.(message.choice);
+              break;
+            case "choice_updated":
+              onChoiceUpdated?.(message.choice);
+              break;
+            case "choice_removed":
+              onChoiceRemoved?.(message.choiceID);
+              break;
+            case "voting_progress":
+              onVotingProgress?.(message);
+              break;
+            case "session_snapshot":
+              onSessionSnapshot?.(message);
+              break;
+            case "ack":
+              pendingRef.current.get(message.id)?.(message);
+              pendingRef.current.delete(message.id);
+              break;
+            case "error":
+              pendingRef.current.get(message.id)?.(message);
+              pendingRef.current.delete(message.id);
+              onError?.(message.action, message.message, message.code);
+              break;
             default:
               console.log("Unknown message type:", message.type);
           }
@@ -147,35 +196,31 @@ export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
     setIsConnected(false);
   }, []);
 
-  const setReady = useCallback((ready) => {
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: "set_ready", ready }));
+  // send wraps a message in the protocol's envelope. It resolves with the ack or
+  // error the server answers it with.
+  const send = useCallback((type, payload) => {
+    const ws = wsRef.current;
+    if (ws?.readyState !== WebSocket.OPEN) {
+      return Promise.resolve({ type: "error", action: type, code: "disconnected", message: "Not connected" });
     }
+    const id = String(++nextIdRef.current);
+    ws.send(JSON.stringify({ v: PROTOCOL_VERSION, id, type, ...(payload && { payload }) }));
+    return new Promise((resolve) => pendingRef.current.set(id, resolve));
   }, []);
 
-  const submitChoices = useCallback(() => {
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: "submit_choices" }));
-    }
-  }, []);
+  const setReady = useCallback((ready) => send("set_ready", { ready }), [send]);
 
-  const submitVotes = useCallback(() => {
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: "submit_votes" }));
-    }
-  }, []);
+  const submitChoices = useCallback(() => send("submit_choices"), [send]);
 
-  const forceStart = useCallback(() => {
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: "force_start" }));
-    }
-  }, []);
+  const unsubmit = useCallback(() => send("unsubmit"), [send]);
 
-  const cancelForceStart = useCallback(() => {
-    if (wsRef.current?.readyState === WebSocket.OPEN) {
-      wsRef.current.send(JSON.stringify({ type: "cancel_force_start" }));
-    }
-  }, []);
+  const forceStart = useCallback(() => send("force_start"), [send]);
+
+  const cancelForceStart = useCallback(() => send("cancel_force_start"), [send]);
+
+  const castVote = useCallback((choiceID, value) => send("cast_vote", { choiceID, value }), [send]);
+
+  const undoVote = useCallback((choiceID) => send("undo_vote", { choiceID }), [send]);
 
   // Cleanup on unmount
   useEffect(() => {
@@ -191,8 +236,10 @@ export function useSessionWebSocket(sessionCode, memberName, handlers = {}) {
     disconnect,
     setReady,
     submitChoices,
-    submitVotes,
+    unsubmit,
     forceStart,
     cancelForceStart,
+    castVote,
+    undoVote,
   };
 }